@@ -0,0 +1,106 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hessjcg/git-gtool/internal/model"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	authCmd = &cobra.Command{
+		Use:   "auth",
+		Short: "Shows how git-gtool authenticates to Github.",
+	}
+
+	authStatusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "Shows which credentials will be used for Github.",
+		Long: "Tries each credential source in order and shows which one\n" +
+			"will be used, and the Github user it authenticates as.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			cwd, _ := os.Getwd()
+			host, _ := cmd.Flags().GetString("hostname")
+			repo, _ := cmd.Flags().GetString("repo")
+			out := cmd.OutOrStdout()
+
+			target := model.Target{Host: host}
+			if repo != "" {
+				owner, name, ok := strings.Cut(repo, "/")
+				if !ok {
+					return fmt.Errorf("--repo must be owner/name, got %q", repo)
+				}
+				target.Owner, target.Name = owner, name
+			}
+
+			fmt.Fprintf(out, "%v\n", host)
+			var found *model.Credential
+			for _, p := range credentialProviders(cwd) {
+				token, err := p.Token(ctx, target)
+				switch {
+				case err != nil:
+					fmt.Fprintf(out, "    %v: %v\n", p.Name(), err)
+				case found == nil:
+					fmt.Fprintf(out, "  * %v: token found\n", p.Name())
+					found = model.NewCredential(ctx, target, p, token)
+				default:
+					fmt.Fprintf(out, "    %v: token found\n", p.Name())
+				}
+			}
+			if found == nil {
+				return fmt.Errorf("no Github credentials found for %v", host)
+			}
+
+			c, err := model.NewClient(ctx, host, found, model.ClientOptions{})
+			if err != nil {
+				return err
+			}
+			user, _, err := c.Users.Get(ctx, "")
+			if err != nil {
+				fmt.Fprintf(out, "Using %v, which can't read the current user: %v\n", found.Source, err)
+				return nil
+			}
+			fmt.Fprintf(out, "Using %v, logged in as %v\n", found.Source, user.GetLogin())
+			return nil
+		},
+	}
+)
+
+func init() {
+	authStatusCmd.Flags().String("hostname", "github.com", "the Github host to check")
+	authStatusCmd.Flags().String("repo", "", "owner/name of the repository, used to find the Github App installation")
+	authCmd.AddCommand(authStatusCmd)
+}
+
+// credentialProviders returns the Github credential providers configured
+// by the flags and config file.
+func credentialProviders(cwd string) []model.CredentialProvider {
+	var app *model.AppConfig
+	if viper.GetInt64("github.app.id") != 0 {
+		app = &model.AppConfig{
+			ID:             viper.GetInt64("github.app.id"),
+			InstallationID: viper.GetInt64("github.app.installation-id"),
+			PrivateKeyPath: viper.GetString("github.app.private-key"),
+		}
+	}
+	return model.DefaultCredentialProviders(cwd, app)
+}
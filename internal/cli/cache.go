@@ -0,0 +1,69 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/hessjcg/git-gtool/internal/model"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	cacheCmd = &cobra.Command{
+		Use:   "cache",
+		Short: "Manages the cache of Github API responses.",
+	}
+
+	cacheClearCmd = &cobra.Command{
+		Use:   "clear",
+		Short: "Deletes all cached Github API responses.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := cacheDir()
+			if dir == "" {
+				return fmt.Errorf("no cache directory found")
+			}
+			c := &model.CacheTransport{Dir: dir}
+			if err := c.Clear(); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Cleared %v\n", dir)
+			return nil
+		},
+	}
+)
+
+func init() {
+	cacheCmd.AddCommand(cacheClearCmd)
+}
+
+// cacheDir returns the configured directory for cached Github API
+// responses, or "" when caching is turned off.
+func cacheDir() string {
+	if viper.GetBool("github.no-cache") {
+		return ""
+	}
+	if dir := viper.GetString("github.cache-dir"); dir != "" {
+		return dir
+	}
+	dir, err := model.DefaultCacheDir()
+	if err != nil {
+		log.Printf("Not caching Github API responses: %v", err)
+		return ""
+	}
+	return dir
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 
 	"github.com/hessjcg/git-gtool/internal/gitrepo"
 	"github.com/hessjcg/git-gtool/internal/renovatepr"
@@ -29,6 +30,8 @@ import (
 var (
 	cfgFile     string
 	userLicense string
+	dryRun      bool
+	resetState  bool
 
 	rootCmd = &cobra.Command{
 		Use:   "git-gtool",
@@ -43,15 +46,59 @@ var (
 		Short: "Merges open prs from RenovateBot.",
 		Long: "This will run for several minutes until all PRs are merged.\n" +
 			"It iterates over open renovate PRs and attempts to merge them\n" +
-			"one by one.",
+			"one by one.\n" +
+			"With --dry-run, it prints the actions it would take for each\n" +
+			"open renovate PR without changing the repository.",
 		Run: func(cmd *cobra.Command, args []string) {
-			var cwd, _ = os.Getwd()
-			ctx := context.Background()
-			repo, err := gitrepo.OpenGit(ctx, cwd)
+			format := viper.GetString("renovate.report")
+			if !validReportFormat(format) {
+				log.Fatalf("Unknown report format %q, use table, markdown, json or none", format)
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			repo, err := openRepo(ctx)
 			if err != nil {
 				log.Fatalf("Unable to open github client: %v", err)
 			}
-			err = renovatepr.MergePRs(ctx, repo)
+			policy, err := policyRules()
+			if err != nil {
+				log.Fatalf("Unable to read the policy: %v", err)
+			}
+			report, err := renovatepr.MergePRs(ctx, repo, renovatepr.Options{
+				DryRun:         dryRun,
+				AutoMerge:      viper.GetBool("renovate.auto-merge"),
+				Wait:           viper.GetBool("renovate.wait"),
+				Authors:        viper.GetStringSlice("renovate.authors"),
+				BranchPrefixes: viper.GetStringSlice("renovate.branch-prefixes"),
+				MergeMethod:    viper.GetString("renovate.merge-method"),
+				CommitTitle:    viper.GetString("renovate.commit-title"),
+				CommitBody:     viper.GetString("renovate.commit-body"),
+				Parallel:       viper.GetInt("renovate.parallel"),
+				RebaseWith:     viper.GetString("renovate.rebase-with"),
+				RebaseLabel:    viper.GetString("renovate.rebase-label"),
+				Policy:         policy,
+				Strategy:       viper.GetString("renovate.strategy"),
+				ResetState:     resetState,
+
+				Timeout:         viper.GetDuration("renovate.timeout"),
+				PollInterval:    viper.GetDuration("renovate.poll-interval"),
+				MaxPollInterval: viper.GetDuration("renovate.max-poll-interval"),
+				MaxWait:         viper.GetDuration("renovate.max-wait"),
+				MaxIterations:   viper.GetInt("renovate.max-iterations"),
+				MaxErrors:       viper.GetInt("renovate.max-errors"),
+
+				NeutralChecks:    viper.GetString("renovate.neutral-checks"),
+				SkippedChecks:    viper.GetString("renovate.skipped-checks"),
+				NoRequiredChecks: viper.GetString("renovate.no-required-checks"),
+			})
+			if report != nil {
+				if werr := writeReport(cmd.OutOrStdout(), report, format); werr != nil {
+					log.Printf("Unable to write the report: %v", werr)
+				}
+			}
+			if err != nil {
+				log.Fatalf("Unable to merge renovate PRs: %v", err)
+			}
 		},
 	}
 )
@@ -62,10 +109,110 @@ func init() {
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.cobra.yaml)")
 	rootCmd.PersistentFlags().Bool("viper", true, "use Viper for configuration")
-	viper.BindPFlag("author", rootCmd.PersistentFlags().Lookup("author"))
+	rootCmd.PersistentFlags().StringSlice("github-host", nil, "host name of a Github Enterprise server")
+	rootCmd.PersistentFlags().String("remote", "", "git remote to use (default upstream when origin is its fork, otherwise origin)")
+	viper.BindPFlag("github.hosts", rootCmd.PersistentFlags().Lookup("github-host"))
+	rootCmd.PersistentFlags().StringSlice("gitlab-host", nil, "host name of a self-managed GitLab server")
+	viper.BindPFlag("gitlab.hosts", rootCmd.PersistentFlags().Lookup("gitlab-host"))
+	rootCmd.PersistentFlags().StringSlice("gitea-host", nil, "host name of a Gitea or Forgejo server")
+	viper.BindPFlag("gitea.hosts", rootCmd.PersistentFlags().Lookup("gitea-host"))
+	viper.BindPFlag("remote", rootCmd.PersistentFlags().Lookup("remote"))
+	rootCmd.PersistentFlags().Int64("app-id", 0, "authenticate as the Github App with this ID")
+	rootCmd.PersistentFlags().Int64("app-installation-id", 0, "the Github App installation ID")
+	rootCmd.PersistentFlags().String("app-private-key", "", "path to the Github App PEM private key")
+	viper.BindPFlag("github.app.id", rootCmd.PersistentFlags().Lookup("app-id"))
+	viper.BindPFlag("github.app.installation-id", rootCmd.PersistentFlags().Lookup("app-installation-id"))
+	viper.BindPFlag("github.app.private-key", rootCmd.PersistentFlags().Lookup("app-private-key"))
+	rootCmd.PersistentFlags().Bool("no-cache", false, "don't cache Github API responses")
+	rootCmd.PersistentFlags().String("cache-dir", "", "directory for cached Github API responses (default is in the user cache dir)")
+	viper.BindPFlag("github.no-cache", rootCmd.PersistentFlags().Lookup("no-cache"))
+	viper.BindPFlag("github.cache-dir", rootCmd.PersistentFlags().Lookup("cache-dir"))
 	viper.BindPFlag("useViper", rootCmd.PersistentFlags().Lookup("viper"))
 
+	renovatePrs.Flags().BoolVar(&dryRun, "dry-run", false, "print the planned actions without changing the repo")
+	renovatePrs.Flags().BoolVar(&resetState, "reset", false, "forget the PR attempts and failures saved by earlier runs")
+	renovatePrs.Flags().StringSlice("author", renovatepr.DefaultAuthors, "login of the dependency bot, may be a glob or /regex/")
+	renovatePrs.Flags().StringSlice("branch-prefix", nil, "only merge PRs with a head branch starting with this prefix, may be a glob or /regex/")
+	renovatePrs.Flags().String("merge-method", renovatepr.MergeMethodSquash, "merge method: squash, rebase or merge")
+	renovatePrs.Flags().String("commit-title", renovatepr.DefaultCommitTitle, "Go template for the merge commit title")
+	renovatePrs.Flags().String("commit-body", "", "Go template for the merge commit body")
+	renovatePrs.Flags().Bool("auto-merge", false, "approve each PR and enable Github auto-merge on it, then exit")
+	renovatePrs.Flags().Bool("wait", false, "with --auto-merge, wait for Github to merge the PRs")
+	renovatePrs.Flags().Int("parallel", 0, "evaluate all PRs at once with this many workers, 0 merges one PR at a time")
+	renovatePrs.Flags().String("rebase-with", renovatepr.RebaseWithCheckbox, "how to ask Renovate to rebase a stale PR: checkbox or label")
+	renovatePrs.Flags().String("rebase-label", renovatepr.DefaultRebaseLabel, "the label that asks Renovate to rebase a PR")
+	renovatePrs.Flags().String("strategy", renovatepr.DefaultStrategy, "how to order the PRs to attempt: score or oldest")
+	renovatePrs.Flags().String("policy", "", "YAML file with the policy rules (default is renovate.policy in the config file)")
+	renovatePrs.Flags().String("report", "table", "summary to print at the end: table, markdown, json or none")
+	renovatePrs.Flags().Duration("timeout", 0, "stop after this long, 0 for no timeout")
+	renovatePrs.Flags().Duration("poll-interval", renovatepr.DefaultPollInterval, "first wait before polling Github for a change")
+	renovatePrs.Flags().Duration("max-poll-interval", renovatepr.DefaultMaxPollInterval, "longest wait between polls")
+	renovatePrs.Flags().Duration("max-wait", renovatepr.DefaultMaxWait, "longest wait for checks or a rebase before trying again")
+	renovatePrs.Flags().Int("max-iterations", renovatepr.DefaultMaxIterations, "most PRs to attempt")
+	renovatePrs.Flags().Int("max-errors", renovatepr.DefaultMaxErrors, "most errors in a row before giving up")
+	renovatePrs.Flags().String("neutral-checks", string(renovatepr.DefaultCheckPolicy.Neutral), "what a neutral required check counts as: success, failure or pending")
+	renovatePrs.Flags().String("skipped-checks", string(renovatepr.DefaultCheckPolicy.Skipped), "what a skipped required check counts as: success, failure or pending")
+	renovatePrs.Flags().String("no-required-checks", renovatepr.NoChecksFail, "what to do when the branch has no required checks: fail to stop with an error, or reported to require every check reported on a PR to pass")
+	viper.BindPFlag("renovate.authors", renovatePrs.Flags().Lookup("author"))
+	viper.BindPFlag("renovate.branch-prefixes", renovatePrs.Flags().Lookup("branch-prefix"))
+	viper.BindPFlag("renovate.merge-method", renovatePrs.Flags().Lookup("merge-method"))
+	viper.BindPFlag("renovate.commit-title", renovatePrs.Flags().Lookup("commit-title"))
+	viper.BindPFlag("renovate.commit-body", renovatePrs.Flags().Lookup("commit-body"))
+	viper.BindPFlag("renovate.auto-merge", renovatePrs.Flags().Lookup("auto-merge"))
+	viper.BindPFlag("renovate.wait", renovatePrs.Flags().Lookup("wait"))
+	viper.BindPFlag("renovate.parallel", renovatePrs.Flags().Lookup("parallel"))
+	viper.BindPFlag("renovate.rebase-with", renovatePrs.Flags().Lookup("rebase-with"))
+	viper.BindPFlag("renovate.rebase-label", renovatePrs.Flags().Lookup("rebase-label"))
+	viper.BindPFlag("renovate.strategy", renovatePrs.Flags().Lookup("strategy"))
+	viper.BindPFlag("renovate.policy-file", renovatePrs.Flags().Lookup("policy"))
+	viper.BindPFlag("renovate.report", renovatePrs.Flags().Lookup("report"))
+	viper.BindPFlag("renovate.timeout", renovatePrs.Flags().Lookup("timeout"))
+	viper.BindPFlag("renovate.poll-interval", renovatePrs.Flags().Lookup("poll-interval"))
+	viper.BindPFlag("renovate.max-poll-interval", renovatePrs.Flags().Lookup("max-poll-interval"))
+	viper.BindPFlag("renovate.max-wait", renovatePrs.Flags().Lookup("max-wait"))
+	viper.BindPFlag("renovate.max-iterations", renovatePrs.Flags().Lookup("max-iterations"))
+	viper.BindPFlag("renovate.max-errors", renovatePrs.Flags().Lookup("max-errors"))
+	viper.BindPFlag("renovate.neutral-checks", renovatePrs.Flags().Lookup("neutral-checks"))
+	viper.BindPFlag("renovate.skipped-checks", renovatePrs.Flags().Lookup("skipped-checks"))
+	viper.BindPFlag("renovate.no-required-checks", renovatePrs.Flags().Lookup("no-required-checks"))
+
 	rootCmd.AddCommand(renovatePrs)
+	rootCmd.AddCommand(authCmd)
+	rootCmd.AddCommand(cacheCmd)
+	rootCmd.AddCommand(renovateCmd)
+}
+
+// openRepo opens the git repository in the working directory using the
+// configured Github, GitLab and Gitea hosts, remote and credentials.
+func openRepo(ctx context.Context) (*gitrepo.GitRepo, error) {
+	cwd, _ := os.Getwd()
+	return gitrepo.OpenGit(ctx, cwd, gitrepo.Options{
+		GithubHosts: viper.GetStringSlice("github.hosts"),
+		GitlabHosts: viper.GetStringSlice("gitlab.hosts"),
+		GiteaHosts:  viper.GetStringSlice("gitea.hosts"),
+		Remote:      viper.GetString("remote"),
+		Credentials: credentialProviders(cwd),
+		CacheDir:    cacheDir(),
+	})
+}
+
+// policyRules reads the policy rules from the rules key of the file set by
+// --policy, or from renovate.policy in the config file.
+func policyRules() ([]renovatepr.PolicyRule, error) {
+	v, key := viper.GetViper(), "renovate.policy"
+	if f := viper.GetString("renovate.policy-file"); f != "" {
+		v, key = viper.New(), "rules"
+		v.SetConfigFile(f)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, err
+		}
+	}
+	var rules []renovatepr.PolicyRule
+	err := v.UnmarshalKey(key, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse %v: %v", key, err)
+	}
+	return rules, nil
 }
 
 func initConfig() {
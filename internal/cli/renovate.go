@@ -0,0 +1,97 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/hessjcg/git-gtool/internal/renovatepr"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	renovateCmd = &cobra.Command{
+		Use:   "renovate",
+		Short: "Shows the open Renovate PRs.",
+	}
+
+	renovateListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Lists the open Renovate PRs and the dependencies they update.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, _ := cmd.Flags().GetString("format")
+			if format != "table" && format != "json" {
+				return fmt.Errorf("unknown format %q, use table or json", format)
+			}
+			ctx := context.Background()
+			repo, err := openRepo(ctx)
+			if err != nil {
+				return err
+			}
+			prs, err := renovatepr.ListPRs(ctx, repo, renovatepr.Options{
+				Authors:        viper.GetStringSlice("renovate.authors"),
+				BranchPrefixes: viper.GetStringSlice("renovate.branch-prefixes"),
+			})
+			if err != nil {
+				return err
+			}
+			if format == "json" {
+				return writeJSON(cmd.OutOrStdout(), prs)
+			}
+			return writeUpdatesTable(cmd.OutOrStdout(), prs)
+		},
+	}
+)
+
+func init() {
+	renovateListCmd.Flags().String("format", "table", "output format: table or json")
+	renovateCmd.AddCommand(renovateListCmd)
+}
+
+// writeJSON writes v as indented JSON.
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeUpdatesTable writes one line for each dependency update.
+func writeUpdatesTable(w io.Writer, prs []renovatepr.RenovatePr) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PR\tPACKAGE\tFROM\tTO\tUPDATE\tDATASOURCE\tGROUPED")
+	for _, pr := range prs {
+		if len(pr.Updates) == 0 {
+			fmt.Fprintf(tw, "#%d\t%v\t\t\t\t\t\n", pr.Number, pr.Title)
+			continue
+		}
+		for _, u := range pr.Updates {
+			fmt.Fprintf(tw, "#%d\t%v\t%v\t%v\t%v\t%v\t%v\n",
+				pr.Number, u.Package, u.From, u.To, orDash(u.UpdateType), orDash(u.Datasource), u.Grouped)
+		}
+	}
+	return tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
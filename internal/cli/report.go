@@ -0,0 +1,167 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hessjcg/git-gtool/internal/renovatepr"
+)
+
+func validReportFormat(format string) bool {
+	switch format {
+	case "table", "markdown", "json", "none":
+		return true
+	}
+	return false
+}
+
+// writeReport writes the end of run report in format.
+func writeReport(w io.Writer, r *renovatepr.Report, format string) error {
+	switch format {
+	case "json":
+		return writeJSON(w, r)
+	case "markdown":
+		return writeReportMarkdown(w, r)
+	case "none":
+		return nil
+	}
+	return writeReportTable(w, r)
+}
+
+// writeReportTable writes one line for each PR, with a line for each failed
+// check below its PR.
+func writeReportTable(w io.Writer, r *renovatepr.Report) error {
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, reportHeadline(r))
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PR\tOUTCOME\tDETAILS\tTITLE")
+	for _, pr := range r.Merged {
+		fmt.Fprintf(tw, "#%d\tmerged\t%v\t%v\n", pr.Number, orDash(shortSHA(pr.SHA)), pr.Title)
+	}
+	for _, pr := range r.Queued {
+		fmt.Fprintf(tw, "#%d\tqueued\t-\t%v\n", pr.Number, pr.Title)
+	}
+	for _, pr := range r.AutoMerge {
+		fmt.Fprintf(tw, "#%d\tauto-merge\t-\t%v\n", pr.Number, pr.Title)
+	}
+	for _, pr := range r.Planned {
+		fmt.Fprintf(tw, "#%d\tplanned\t-\t%v\n", pr.Number, pr.Title)
+	}
+	for _, pr := range r.Failed {
+		fmt.Fprintf(tw, "#%d\tfailed\t%v\t%v\n", pr.Number, orDash(checkNames(pr.Checks)), pr.Title)
+		for _, c := range pr.Checks {
+			if c.URL != "" {
+				fmt.Fprintf(tw, "\t\t%v\t%v\n", c.Name, c.URL)
+			}
+		}
+	}
+	for _, pr := range r.Skipped {
+		fmt.Fprintf(tw, "#%d\tskipped\t%v\t%v\n", pr.Number, pr.Reason, pr.Title)
+	}
+	return tw.Flush()
+}
+
+// writeReportMarkdown writes the report as markdown to paste into an issue.
+func writeReportMarkdown(w io.Writer, r *renovatepr.Report) error {
+	fmt.Fprintf(w, "## Renovate PRs\n\n%v\n", reportHeadline(r))
+	if len(r.Merged) > 0 {
+		fmt.Fprintf(w, "\n### Merged\n\n| PR | Title | Commit |\n| --- | --- | --- |\n")
+		for _, pr := range r.Merged {
+			fmt.Fprintf(w, "| %v | %v | %v |\n", markdownPr(pr.ReportPr), markdownCell(pr.Title), orDash(shortSHA(pr.SHA)))
+		}
+	}
+	if len(r.Queued) > 0 {
+		fmt.Fprintf(w, "\n### Queued\n\n| PR | Title |\n| --- | --- |\n")
+		for _, pr := range r.Queued {
+			fmt.Fprintf(w, "| %v | %v |\n", markdownPr(pr), markdownCell(pr.Title))
+		}
+	}
+	if len(r.AutoMerge) > 0 {
+		fmt.Fprintf(w, "\n### Auto-merge\n\n| PR | Title |\n| --- | --- |\n")
+		for _, pr := range r.AutoMerge {
+			fmt.Fprintf(w, "| %v | %v |\n", markdownPr(pr), markdownCell(pr.Title))
+		}
+	}
+	if len(r.Planned) > 0 {
+		fmt.Fprintf(w, "\n### Planned\n\n| PR | Title |\n| --- | --- |\n")
+		for _, pr := range r.Planned {
+			fmt.Fprintf(w, "| %v | %v |\n", markdownPr(pr), markdownCell(pr.Title))
+		}
+	}
+	if len(r.Failed) > 0 {
+		fmt.Fprintf(w, "\n### Failed checks\n\n| PR | Title | Checks |\n| --- | --- | --- |\n")
+		for _, pr := range r.Failed {
+			var checks []string
+			for _, c := range pr.Checks {
+				if c.URL != "" {
+					checks = append(checks, fmt.Sprintf("[%v](%v)", markdownCell(c.Name), c.URL))
+				} else {
+					checks = append(checks, markdownCell(c.Name))
+				}
+			}
+			fmt.Fprintf(w, "| %v | %v | %v |\n", markdownPr(pr.ReportPr), markdownCell(pr.Title), orDash(strings.Join(checks, ", ")))
+		}
+	}
+	if len(r.Skipped) > 0 {
+		fmt.Fprintf(w, "\n### Skipped\n\n| PR | Title | Reason |\n| --- | --- | --- |\n")
+		for _, pr := range r.Skipped {
+			fmt.Fprintf(w, "| %v | %v | %v |\n", markdownPr(pr.ReportPr), markdownCell(pr.Title), markdownCell(pr.Reason))
+		}
+	}
+	return nil
+}
+
+// reportHeadline counts the PRs in each outcome and the time spent.
+func reportHeadline(r *renovatepr.Report) string {
+	merged, n := "Merged", len(r.Merged)
+	if r.DryRun {
+		merged, n = "Dry run, would merge", len(r.Planned)
+	}
+	return fmt.Sprintf("%v %d PRs, %d queued, %d set to auto-merge, %d failed checks, %d skipped in %v.",
+		merged, n, len(r.Queued), len(r.AutoMerge), len(r.Failed), len(r.Skipped), r.Duration().Round(time.Second))
+}
+
+func markdownPr(pr renovatepr.ReportPr) string {
+	if pr.URL == "" {
+		return fmt.Sprintf("#%d", pr.Number)
+	}
+	return fmt.Sprintf("[#%d](%v)", pr.Number, pr.URL)
+}
+
+// markdownCell escapes the characters that would break a table cell.
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+func checkNames(checks []renovatepr.Check) string {
+	var names []string
+	for _, c := range checks {
+		names = append(names, c.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
@@ -0,0 +1,233 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package forge defines the operations on a code forge, like Github, that
+// the commands need. Commands use these interfaces instead of a forge's API
+// client, so they can be tested against a fake and run on other forges.
+package forge
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrNotSupported is returned for an operation the forge does not have,
+	// like a merge queue.
+	ErrNotSupported = fmt.Errorf("not supported by this forge")
+	// ErrCanMergeNow is returned by EnableAutoMerge when the PR can already
+	// be merged, so the forge refuses to wait for it.
+	ErrCanMergeNow = fmt.Errorf("the PR can be merged now")
+)
+
+// Forge is a code forge with one repository that commands operate on.
+type Forge interface {
+	PullRequests
+	Checks
+	Workflows
+
+	// Repository returns the repository the forge operates on.
+	Repository() *Repository
+}
+
+// PullRequests reads and changes the pull requests of the repository. Forges
+// that call them merge requests use the same operations.
+type PullRequests interface {
+	// ListPullRequests returns the pull requests with state open, closed or
+	// all, that target the base branch, oldest first.
+	ListPullRequests(ctx context.Context, state, base string) ([]*PullRequest, error)
+	// GetPullRequest returns the pull request with number, including the
+	// fields only known for a single PR, like Mergeable.
+	GetPullRequest(ctx context.Context, number int) (*PullRequest, error)
+	// ListFiles returns the names of the files that the PR changes.
+	ListFiles(ctx context.Context, number int) ([]string, error)
+	// ListCommits returns the commits of the PR.
+	ListCommits(ctx context.Context, number int) ([]*Commit, error)
+	// ListReviews returns the reviews of the PR.
+	ListReviews(ctx context.Context, number int) ([]*Review, error)
+	// Approve adds an approving review with body to the PR.
+	Approve(ctx context.Context, pr *PullRequest, body string) error
+	// EditBody replaces the body of the PR.
+	EditBody(ctx context.Context, pr *PullRequest, body string) error
+	// AddLabel adds a label to the PR.
+	AddLabel(ctx context.Context, pr *PullRequest, label string) error
+	// Merge merges the PR.
+	Merge(ctx context.Context, pr *PullRequest, opts MergeOptions) (*MergeResult, error)
+	// EnableAutoMerge makes the forge merge the PR once its checks pass.
+	EnableAutoMerge(ctx context.Context, pr *PullRequest, opts MergeOptions) error
+	// InMergeQueue returns true when the PR is in the merge queue.
+	InMergeQueue(ctx context.Context, pr *PullRequest) (bool, error)
+	// Enqueue adds the PR to the merge queue and returns its position.
+	Enqueue(ctx context.Context, pr *PullRequest) (int, error)
+}
+
+// Checks reads the checks reported on commits and the checks that a branch
+// requires.
+type Checks interface {
+	// ListStatuses returns the latest commit status of each context on the
+	// commit sha.
+	ListStatuses(ctx context.Context, sha string) ([]*Status, error)
+	// ListCheckRuns returns the latest check runs on the commit sha.
+	ListCheckRuns(ctx context.Context, sha string) ([]*CheckRun, error)
+	// BranchRules returns the merge requirements of the branch.
+	BranchRules(ctx context.Context, branch string) (*BranchRules, error)
+}
+
+// Workflows reads and approves CI workflow runs.
+type Workflows interface {
+	// ListPendingWorkflowRuns returns the workflow runs on branch that wait
+	// for a maintainer to approve them.
+	ListPendingWorkflowRuns(ctx context.Context, branch string) ([]*WorkflowRun, error)
+	// ApproveWorkflowRun approves the run so that it starts.
+	ApproveWorkflowRun(ctx context.Context, run *WorkflowRun) error
+}
+
+// Repository is a repository on the forge.
+type Repository struct {
+	Owner         string
+	Name          string
+	FullName      string
+	DefaultBranch string
+	URL           string
+	// AllowSquashMerge, AllowMergeCommit and AllowRebaseMerge are nil when
+	// the forge did not report the setting.
+	AllowSquashMerge *bool
+	AllowMergeCommit *bool
+	AllowRebaseMerge *bool
+}
+
+// PullRequest is a pull request, or a merge request.
+type PullRequest struct {
+	Number int
+	// ID the global ID of the PR in the forge's API, like a Github node ID.
+	ID        string
+	Title     string
+	Body      string
+	URL       string
+	Author    string
+	Labels    []string
+	CreatedAt time.Time
+	// State open or closed.
+	State          string
+	Merged         bool
+	MergeCommitSHA string
+	HeadRef        string
+	HeadSHA        string
+	BaseRef        string
+	// Mergeable nil while the forge has not yet computed it.
+	Mergeable *bool
+	// MergeableState is like the Github mergeable_state: clean, behind,
+	// dirty, blocked, unstable or unknown.
+	MergeableState string
+	// Rebaseable nil when not known.
+	Rebaseable *bool
+	// AutoMerge true when the forge will merge the PR when its checks pass.
+	AutoMerge bool
+}
+
+// Commit is a commit of a PR.
+type Commit struct {
+	SHA         string
+	AuthorName  string
+	AuthorEmail string
+}
+
+// Review is a review of a PR.
+type Review struct {
+	ID     int64
+	Author string
+	// State like APPROVED, COMMENTED or CHANGES_REQUESTED.
+	State string
+}
+
+// Status is a commit status.
+type Status struct {
+	Context string
+	// State success, pending, failure or error.
+	State string
+	URL   string
+}
+
+// CheckRun is a check run, or a CI job on forges without check runs.
+type CheckRun struct {
+	Name string
+	// AppID the app that created the check run, 0 when not known.
+	AppID int64
+	// Status queued, in_progress or completed.
+	Status string
+	// Conclusion when completed, like success, failure, neutral or skipped.
+	Conclusion string
+	URL        string
+}
+
+// WorkflowRun is a CI workflow run.
+type WorkflowRun struct {
+	ID         int64
+	URL        string
+	HeadBranch string
+	HeadSHA    string
+	Status     string
+}
+
+// RequiredCheck is a check that must pass before a PR is merged.
+type RequiredCheck struct {
+	Context string
+	// AppID the app that must report the check, nil for any source.
+	AppID *int64
+}
+
+// BranchRules are the merge requirements of a branch.
+type BranchRules struct {
+	// Checks the required checks.
+	Checks []RequiredCheck
+	// MergeQueue true when PRs must be merged using the merge queue.
+	MergeQueue bool
+}
+
+// AddCheck adds a required check unless it is already required.
+func (b *BranchRules) AddCheck(c RequiredCheck) {
+	for _, e := range b.Checks {
+		if e.Context == c.Context && appID(e.AppID) == appID(c.AppID) {
+			return
+		}
+	}
+	b.Checks = append(b.Checks, c)
+}
+
+func appID(id *int64) int64 {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
+
+// MergeOptions configures how a PR is merged.
+type MergeOptions struct {
+	// Method squash, rebase or merge.
+	Method string
+	// Title and Body of the merge commit. The forge chooses them when empty.
+	Title string
+	Body  string
+	// SHA the head commit the PR must still have.
+	SHA string
+}
+
+// MergeResult is the result of merging a PR.
+type MergeResult struct {
+	Merged bool
+	// SHA the merge commit.
+	SHA     string
+	Message string
+}
@@ -0,0 +1,305 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package forgetest provides an in-memory forge.Forge for tests. Tests set
+// up the pull requests and checks, run the code under test, then inspect the
+// PRs and the recorded calls.
+package forgetest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+)
+
+// Forge is an in-memory forge. Set the fields before using it, and lock Mu
+// to read or change them while it is in use.
+type Forge struct {
+	Mu sync.Mutex
+
+	Repo forge.Repository
+	// PRs the pull requests by number.
+	PRs map[int]*forge.PullRequest
+	// Files, Commits and Reviews of each PR by number.
+	Files   map[int][]string
+	Commits map[int][]*forge.Commit
+	Reviews map[int][]*forge.Review
+	// Statuses and CheckRuns by commit SHA.
+	Statuses  map[string][]*forge.Status
+	CheckRuns map[string][]*forge.CheckRun
+	// Rules by branch. Branches without rules have none.
+	Rules map[string]*forge.BranchRules
+	// WorkflowRuns waiting for approval. Approved runs are removed.
+	WorkflowRuns []*forge.WorkflowRun
+	// Queue the numbers of the PRs in the merge queue.
+	Queue []int
+	// OnGet when set is called with Mu held each time a PR is read with
+	// GetPullRequest, so tests can change it over time.
+	OnGet func(pr *forge.PullRequest)
+	// Calls describes each change made through the forge, in order.
+	Calls []string
+}
+
+var _ forge.Forge = (*Forge)(nil)
+
+// New returns an empty Forge for the repository owner/name with the default
+// branch main.
+func New(owner, name string) *Forge {
+	return &Forge{
+		Repo: forge.Repository{
+			Owner:         owner,
+			Name:          name,
+			FullName:      owner + "/" + name,
+			DefaultBranch: "main",
+		},
+		PRs:       map[int]*forge.PullRequest{},
+		Files:     map[int][]string{},
+		Commits:   map[int][]*forge.Commit{},
+		Reviews:   map[int][]*forge.Review{},
+		Statuses:  map[string][]*forge.Status{},
+		CheckRuns: map[string][]*forge.CheckRun{},
+		Rules:     map[string]*forge.BranchRules{},
+	}
+}
+
+// AddPR adds an open PR targeting the default branch, filling in the
+// fields that are not set.
+func (f *Forge) AddPR(pr *forge.PullRequest) {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+	if pr.State == "" {
+		pr.State = "open"
+	}
+	if pr.BaseRef == "" {
+		pr.BaseRef = f.Repo.DefaultBranch
+	}
+	if pr.HeadSHA == "" {
+		pr.HeadSHA = fmt.Sprintf("sha-%d", pr.Number)
+	}
+	if pr.ID == "" {
+		pr.ID = fmt.Sprintf("PR_%d", pr.Number)
+	}
+	f.PRs[pr.Number] = pr
+}
+
+// record adds a call. Must be called with Mu held.
+func (f *Forge) record(format string, args ...any) {
+	f.Calls = append(f.Calls, fmt.Sprintf(format, args...))
+}
+
+// pr returns the PR with number. Must be called with Mu held.
+func (f *Forge) pr(number int) (*forge.PullRequest, error) {
+	pr, ok := f.PRs[number]
+	if !ok {
+		return nil, fmt.Errorf("PR #%d not found", number)
+	}
+	return pr, nil
+}
+
+// clone copies pr so the caller can't change the forge's copy.
+func clone(pr *forge.PullRequest) *forge.PullRequest {
+	c := *pr
+	c.Labels = append([]string(nil), pr.Labels...)
+	return &c
+}
+
+func (f *Forge) Repository() *forge.Repository {
+	r := f.Repo
+	return &r
+}
+
+func (f *Forge) ListPullRequests(_ context.Context, state, base string) ([]*forge.PullRequest, error) {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+	var prs []*forge.PullRequest
+	for _, pr := range f.PRs {
+		if (state == "all" || pr.State == state) && (base == "" || pr.BaseRef == base) {
+			prs = append(prs, clone(pr))
+		}
+	}
+	sort.Slice(prs, func(i, j int) bool { return prs[i].Number < prs[j].Number })
+	return prs, nil
+}
+
+func (f *Forge) GetPullRequest(_ context.Context, number int) (*forge.PullRequest, error) {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+	pr, err := f.pr(number)
+	if err != nil {
+		return nil, err
+	}
+	if f.OnGet != nil {
+		f.OnGet(pr)
+	}
+	return clone(pr), nil
+}
+
+func (f *Forge) ListFiles(_ context.Context, number int) ([]string, error) {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+	return append([]string(nil), f.Files[number]...), nil
+}
+
+func (f *Forge) ListCommits(_ context.Context, number int) ([]*forge.Commit, error) {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+	return append([]*forge.Commit(nil), f.Commits[number]...), nil
+}
+
+func (f *Forge) ListReviews(_ context.Context, number int) ([]*forge.Review, error) {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+	return append([]*forge.Review(nil), f.Reviews[number]...), nil
+}
+
+func (f *Forge) Approve(_ context.Context, pr *forge.PullRequest, body string) error {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+	if _, err := f.pr(pr.Number); err != nil {
+		return err
+	}
+	f.Reviews[pr.Number] = append(f.Reviews[pr.Number], &forge.Review{
+		ID:    int64(len(f.Reviews[pr.Number]) + 1),
+		State: "APPROVED",
+	})
+	f.record("approve #%d", pr.Number)
+	return nil
+}
+
+func (f *Forge) EditBody(_ context.Context, pr *forge.PullRequest, body string) error {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+	p, err := f.pr(pr.Number)
+	if err != nil {
+		return err
+	}
+	p.Body = body
+	f.record("edit body #%d", pr.Number)
+	return nil
+}
+
+func (f *Forge) AddLabel(_ context.Context, pr *forge.PullRequest, label string) error {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+	p, err := f.pr(pr.Number)
+	if err != nil {
+		return err
+	}
+	p.Labels = append(p.Labels, label)
+	f.record("add label %v #%d", label, pr.Number)
+	return nil
+}
+
+func (f *Forge) Merge(_ context.Context, pr *forge.PullRequest, opts forge.MergeOptions) (*forge.MergeResult, error) {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+	p, err := f.pr(pr.Number)
+	if err != nil {
+		return nil, err
+	}
+	if p.State != "open" {
+		return &forge.MergeResult{Message: "PR is not open"}, nil
+	}
+	if opts.SHA != "" && opts.SHA != p.HeadSHA {
+		return &forge.MergeResult{Message: "head branch was modified"}, nil
+	}
+	p.State = "closed"
+	p.Merged = true
+	p.MergeCommitSHA = fmt.Sprintf("merge-%d", p.Number)
+	f.record("merge #%d %v", pr.Number, opts.Method)
+	return &forge.MergeResult{Merged: true, SHA: p.MergeCommitSHA, Message: "merged"}, nil
+}
+
+func (f *Forge) EnableAutoMerge(_ context.Context, pr *forge.PullRequest, opts forge.MergeOptions) error {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+	p, err := f.pr(pr.Number)
+	if err != nil {
+		return err
+	}
+	p.AutoMerge = true
+	f.record("auto-merge #%d %v", pr.Number, opts.Method)
+	return nil
+}
+
+func (f *Forge) InMergeQueue(_ context.Context, pr *forge.PullRequest) (bool, error) {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+	for _, n := range f.Queue {
+		if n == pr.Number {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *Forge) Enqueue(_ context.Context, pr *forge.PullRequest) (int, error) {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+	f.Queue = append(f.Queue, pr.Number)
+	f.record("enqueue #%d", pr.Number)
+	return len(f.Queue), nil
+}
+
+func (f *Forge) ListStatuses(_ context.Context, sha string) ([]*forge.Status, error) {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+	return append([]*forge.Status(nil), f.Statuses[sha]...), nil
+}
+
+func (f *Forge) ListCheckRuns(_ context.Context, sha string) ([]*forge.CheckRun, error) {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+	return append([]*forge.CheckRun(nil), f.CheckRuns[sha]...), nil
+}
+
+func (f *Forge) BranchRules(_ context.Context, branch string) (*forge.BranchRules, error) {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+	r, ok := f.Rules[branch]
+	if !ok {
+		return &forge.BranchRules{}, nil
+	}
+	c := *r
+	c.Checks = append([]forge.RequiredCheck(nil), r.Checks...)
+	return &c, nil
+}
+
+func (f *Forge) ListPendingWorkflowRuns(_ context.Context, branch string) ([]*forge.WorkflowRun, error) {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+	var runs []*forge.WorkflowRun
+	for _, r := range f.WorkflowRuns {
+		if r.HeadBranch == branch {
+			runs = append(runs, r)
+		}
+	}
+	return runs, nil
+}
+
+func (f *Forge) ApproveWorkflowRun(_ context.Context, run *forge.WorkflowRun) error {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+	for i, r := range f.WorkflowRuns {
+		if r.ID == run.ID {
+			f.WorkflowRuns = append(f.WorkflowRuns[:i], f.WorkflowRuns[i+1:]...)
+			f.record("approve run %d", run.ID)
+			return nil
+		}
+	}
+	return fmt.Errorf("workflow run %d not found", run.ID)
+}
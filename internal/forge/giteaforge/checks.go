@@ -0,0 +1,126 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package giteaforge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+)
+
+// combinedStatus is the latest status of each context on a commit.
+type combinedStatus struct {
+	// State the combined state, empty when there are no statuses.
+	State    string `json:"state"`
+	Statuses []*struct {
+		Context   string `json:"context"`
+		Status    string `json:"status"`
+		TargetURL string `json:"target_url"`
+	} `json:"statuses"`
+}
+
+// combinedStatus gets every page of the combined status of the commit sha.
+func (f *Forge) combinedStatus(ctx context.Context, sha string) (*combinedStatus, error) {
+	all := &combinedStatus{}
+	q := url.Values{"limit": {strconv.Itoa(perPage)}}
+	for page := 1; ; page++ {
+		q.Set("page", strconv.Itoa(page))
+		var pg combinedStatus
+		res, err := f.do(ctx, "GET", f.path+"/commits/"+url.PathEscape(sha)+"/status", q, nil, &pg)
+		if err != nil {
+			return nil, fmt.Errorf("can't get status: %v %v %v", f.repo.FullName, sha, err)
+		}
+		all.State = pg.State
+		all.Statuses = append(all.Statuses, pg.Statuses...)
+		if !hasNextPage(res) || len(pg.Statuses) == 0 {
+			return all, nil
+		}
+	}
+}
+
+// ListStatuses returns the latest status of each context. Gitea blocks
+// merges on a warning, so warnings are failures.
+func (f *Forge) ListStatuses(ctx context.Context, sha string) ([]*forge.Status, error) {
+	cs, err := f.combinedStatus(ctx, sha)
+	if err != nil {
+		return nil, err
+	}
+	var statuses []*forge.Status
+	for _, s := range cs.Statuses {
+		state := s.Status
+		if state == "warning" {
+			state = "failure"
+		}
+		statuses = append(statuses, &forge.Status{Context: s.Context, State: state, URL: s.TargetURL})
+	}
+	return statuses, nil
+}
+
+// ListCheckRuns returns nothing, Gitea only has commit statuses.
+func (f *Forge) ListCheckRuns(ctx context.Context, sha string) ([]*forge.CheckRun, error) {
+	return nil, nil
+}
+
+// branchProtection is a branch protection rule from the Gitea API.
+type branchProtection struct {
+	// RuleName the branch name or glob the rule applies to. Older servers
+	// only set BranchName.
+	RuleName            string   `json:"rule_name"`
+	BranchName          string   `json:"branch_name"`
+	EnableStatusCheck   bool     `json:"enable_status_check"`
+	StatusCheckContexts []string `json:"status_check_contexts"`
+}
+
+// BranchRules returns the status checks required by the protection rules
+// that match branch. Only repository admins can read the rules, so for
+// other users there are no required checks.
+func (f *Forge) BranchRules(ctx context.Context, branch string) (*forge.BranchRules, error) {
+	ps, err := list[branchProtection](ctx, f, f.path+"/branch_protections", nil)
+	if code := statusCode(err); code == http.StatusForbidden || code == http.StatusNotFound {
+		return &forge.BranchRules{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't get branch protection for %v: %v", branch, err)
+	}
+	rules := &forge.BranchRules{}
+	for _, p := range ps {
+		name := p.RuleName
+		if name == "" {
+			name = p.BranchName
+		}
+		if ok, _ := path.Match(name, branch); !ok || !p.EnableStatusCheck {
+			continue
+		}
+		for _, c := range p.StatusCheckContexts {
+			rules.AddCheck(forge.RequiredCheck{Context: c})
+		}
+	}
+	return rules, nil
+}
+
+// ListPendingWorkflowRuns returns nothing. The Gitea API can't approve
+// Actions runs.
+func (f *Forge) ListPendingWorkflowRuns(ctx context.Context, branch string) ([]*forge.WorkflowRun, error) {
+	return nil, nil
+}
+
+func (f *Forge) ApproveWorkflowRun(ctx context.Context, run *forge.WorkflowRun) error {
+	return forge.ErrNotSupported
+}
@@ -0,0 +1,228 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package giteaforge implements forge.Forge using the Gitea REST API, which
+// Forgejo also serves. CI systems, including Gitea Actions, report commit
+// statuses, so the forge has no check runs.
+package giteaforge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+)
+
+// perPage is the page size of list requests, the default most that Gitea
+// allows.
+const perPage = 50
+
+// Forge is a Gitea repository.
+type Forge struct {
+	client *http.Client
+	base   string
+	path   string
+	repo   *forge.Repository
+
+	// mu guards autoMerge.
+	mu sync.Mutex
+	// autoMerge the PRs scheduled to merge when their checks succeed. Gitea
+	// does not report scheduled merges on the PR.
+	autoMerge map[int]bool
+}
+
+var _ forge.Forge = (*Forge)(nil)
+
+// APIURL returns the REST API url of the Gitea server on host.
+func APIURL(host string) string {
+	return "https://" + host + "/api/v1/"
+}
+
+// New returns the Forge for the repository owner/name on the Gitea API at
+// baseURL, using client for the API calls. It reads the repository to check
+// that it exists.
+func New(ctx context.Context, client *http.Client, baseURL, owner, name string) (*Forge, error) {
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	if _, err := url.Parse(baseURL); err != nil {
+		return nil, fmt.Errorf("bad Gitea API url %q: %v", baseURL, err)
+	}
+	f := &Forge{
+		client:    client,
+		base:      baseURL,
+		path:      "repos/" + url.PathEscape(owner) + "/" + url.PathEscape(name),
+		autoMerge: map[int]bool{},
+	}
+	var r repository
+	_, err := f.do(ctx, "GET", f.path, nil, nil, &r)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving Gitea repo %v/%v: %v", owner, name, err)
+	}
+	f.repo = fromRepository(&r)
+	return f, nil
+}
+
+func (f *Forge) Repository() *forge.Repository {
+	return f.repo
+}
+
+// Error is an error response from the Gitea API.
+type Error struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v %v: %d %v", e.Method, e.URL, e.StatusCode, e.Message)
+}
+
+// statusCode returns the HTTP status of an error response, or 0 when err
+// is not one.
+func statusCode(err error) int {
+	if e, ok := err.(*Error); ok {
+		return e.StatusCode
+	}
+	return 0
+}
+
+// do sends a request to the API path relative to the base url, with body
+// encoded as JSON when not nil, and decodes the response into out when not
+// nil.
+func (f *Forge) do(ctx context.Context, method, path string, query url.Values, body, out any) (*http.Response, error) {
+	u, err := url.Parse(f.base + path)
+	if err != nil {
+		return nil, err
+	}
+	if query != nil {
+		u.RawQuery = query.Encode()
+	}
+
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return res, err
+	}
+	if res.StatusCode >= 300 {
+		var e struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(b, &e) != nil || e.Message == "" {
+			e.Message = strings.TrimSpace(string(b))
+		}
+		return res, &Error{Method: method, URL: path, StatusCode: res.StatusCode, Message: e.Message}
+	}
+	if out != nil && len(b) > 0 {
+		err = json.Unmarshal(b, out)
+		if err != nil {
+			return res, fmt.Errorf("can't parse response from %v %v: %v", method, path, err)
+		}
+	}
+	return res, nil
+}
+
+// hasNextPage returns true when the Link header of res has a next page.
+func hasNextPage(res *http.Response) bool {
+	return strings.Contains(res.Header.Get("Link"), `rel="next"`)
+}
+
+// list gets every page of the list at path.
+func list[T any](ctx context.Context, f *Forge, path string, query url.Values) ([]*T, error) {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("limit", strconv.Itoa(perPage))
+	var items []*T
+	for page := 1; ; page++ {
+		q.Set("page", strconv.Itoa(page))
+		var pg []*T
+		res, err := f.do(ctx, "GET", path, q, nil, &pg)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, pg...)
+		if !hasNextPage(res) || len(pg) == 0 {
+			return items, nil
+		}
+	}
+}
+
+// user is a Gitea user.
+type user struct {
+	ID    int64  `json:"id"`
+	Login string `json:"login"`
+}
+
+// repository is a repository from the Gitea API.
+type repository struct {
+	Name                      string `json:"name"`
+	FullName                  string `json:"full_name"`
+	Owner                     user   `json:"owner"`
+	DefaultBranch             string `json:"default_branch"`
+	HTMLURL                   string `json:"html_url"`
+	AllowMergeCommits         bool   `json:"allow_merge_commits"`
+	AllowRebase               bool   `json:"allow_rebase"`
+	AllowSquashMerge          bool   `json:"allow_squash_merge"`
+	AllowFastForwardOnlyMerge bool   `json:"allow_fast_forward_only_merge"`
+}
+
+// fromRepository converts a Gitea repository.
+func fromRepository(r *repository) *forge.Repository {
+	return &forge.Repository{
+		Owner:            r.Owner.Login,
+		Name:             r.Name,
+		FullName:         r.FullName,
+		DefaultBranch:    r.DefaultBranch,
+		URL:              r.HTMLURL,
+		AllowSquashMerge: boolPtr(r.AllowSquashMerge),
+		AllowMergeCommit: boolPtr(r.AllowMergeCommits),
+		AllowRebaseMerge: boolPtr(r.AllowRebase),
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,222 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package giteaforge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+	"github.com/hessjcg/git-gtool/internal/giteatest"
+)
+
+// newForge returns a Forge for the repository on the stand-in server.
+func newForge(t *testing.T, s *giteatest.Server) *Forge {
+	t.Helper()
+	f, err := New(context.Background(), http.DefaultClient, s.BaseURL, s.Owner, s.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestRepository(t *testing.T) {
+	s := giteatest.NewServer(t, "infra", "widget")
+	repo := newForge(t, s).Repository()
+	if repo.Owner != "infra" || repo.Name != "widget" || repo.FullName != "infra/widget" || repo.DefaultBranch != "main" {
+		t.Errorf("got repository %+v, want infra/widget on main", repo)
+	}
+	if !*repo.AllowSquashMerge || !*repo.AllowMergeCommit || !*repo.AllowRebaseMerge {
+		t.Errorf("got squash %v, merge %v, rebase %v, want all allowed",
+			*repo.AllowSquashMerge, *repo.AllowMergeCommit, *repo.AllowRebaseMerge)
+	}
+}
+
+func TestListPullRequests(t *testing.T) {
+	s := giteatest.NewServer(t, "infra", "widget")
+	s.PageSize = 2
+	for i := 1; i <= 4; i++ {
+		s.AddPR(&giteatest.PullRequest{Number: i, Title: fmt.Sprintf("update module %d", i), Labels: []string{"dependencies"}})
+	}
+	s.AddPR(&giteatest.PullRequest{Number: 5, HasConflicts: true})
+	f := newForge(t, s)
+
+	prs, err := f.ListPullRequests(context.Background(), "open", "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, pr := range prs {
+		got = append(got, pr.Number)
+	}
+	if fmt.Sprint(got) != "[1 2 3 4 5]" {
+		t.Fatalf("got open PRs %v, want [1 2 3 4 5] across pages", got)
+	}
+	pr := prs[0]
+	want := s.PR(1)
+	if pr.Author != "renovate-bot" || pr.HeadRef != want.HeadRef || pr.HeadSHA != want.SHA || pr.BaseRef != "main" ||
+		pr.State != "open" || fmt.Sprint(pr.Labels) != "[dependencies]" || pr.MergeableState != "clean" {
+		t.Errorf("got %+v, want the fields of PR 1", pr)
+	}
+	if pr := prs[4]; *pr.Mergeable || pr.MergeableState != "dirty" {
+		t.Errorf("got mergeable %v %v, want #5 with conflicts", *pr.Mergeable, pr.MergeableState)
+	}
+
+	prs, err = f.ListPullRequests(context.Background(), "open", "release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prs) != 0 {
+		t.Errorf("got %d PRs on the release branch, want none", len(prs))
+	}
+}
+
+func TestChecks(t *testing.T) {
+	s := giteatest.NewServer(t, "infra", "widget")
+	s.RequiredContexts = []string{"ci/build"}
+	s.AddPR(&giteatest.PullRequest{
+		Number: 1,
+		Statuses: []giteatest.Status{
+			{Context: "ci/build", State: "success"},
+			{Context: "ci/lint", State: "warning"},
+			{Context: "ci/e2e", State: "pending"},
+		},
+	})
+	f := newForge(t, s)
+	ctx := context.Background()
+
+	statuses, err := f.ListStatuses(ctx, s.PR(1).SHA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, st := range statuses {
+		got = append(got, st.Context+"="+st.State)
+	}
+	if want := "[ci/build=success ci/lint=failure ci/e2e=pending]"; fmt.Sprint(got) != want {
+		t.Errorf("got statuses %v, want %v", got, want)
+	}
+
+	rules, err := f.BranchRules(ctx, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules.Checks) != 1 || rules.Checks[0].Context != "ci/build" {
+		t.Errorf("got rules %+v, want ci/build required", rules)
+	}
+	rules, err = f.BranchRules(ctx, "release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules.Checks) != 0 {
+		t.Errorf("got rules %+v for an unprotected branch, want none", rules)
+	}
+}
+
+func TestApproveAndMerge(t *testing.T) {
+	s := giteatest.NewServer(t, "infra", "widget")
+	s.RequiredApprovals = 1
+	s.AddPR(&giteatest.PullRequest{Number: 1})
+	f := newForge(t, s)
+	ctx := context.Background()
+
+	pr, err := f.GetPullRequest(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Merge(ctx, pr, forge.MergeOptions{Method: "squash", SHA: pr.HeadSHA})
+	if err == nil {
+		t.Fatal("got no error merging without an approval")
+	}
+	err = f.Approve(ctx, pr, "LGTM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reviews, err := f.ListReviews(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reviews) != 1 || reviews[0].Author != "merge-bot" || reviews[0].State != "APPROVED" {
+		t.Errorf("got reviews %v, want an approval by merge-bot", reviews)
+	}
+
+	_, err = f.Merge(ctx, pr, forge.MergeOptions{Method: "squash", SHA: "stale"})
+	if err == nil {
+		t.Fatal("got no error merging a stale commit")
+	}
+	res, err := f.Merge(ctx, pr, forge.MergeOptions{Method: "squash", Title: "update module", Body: "details", SHA: pr.HeadSHA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := s.PR(1)
+	if !res.Merged || res.SHA != got.MergeCommitSHA {
+		t.Errorf("got %+v, want merged as %v", res, got.MergeCommitSHA)
+	}
+	if got.MergeStyle != "squash" || got.MergeTitle != "update module" || got.MergeMessage != "details" {
+		t.Errorf("got style %v title %q message %q, want a squash with the message", got.MergeStyle, got.MergeTitle, got.MergeMessage)
+	}
+}
+
+func TestAddLabel(t *testing.T) {
+	s := giteatest.NewServer(t, "infra", "widget")
+	s.AddPR(&giteatest.PullRequest{Number: 1})
+	f := newForge(t, s)
+	ctx := context.Background()
+	pr, _ := f.GetPullRequest(ctx, 1)
+
+	err := f.AddLabel(ctx, pr, "dependencies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.PR(1).Labels; fmt.Sprint(got) != "[dependencies]" {
+		t.Errorf("got labels %v, want [dependencies]", got)
+	}
+	err = f.AddLabel(ctx, pr, "missing")
+	if err == nil {
+		t.Error("got no error adding a label the repository does not have")
+	}
+}
+
+func TestEnableAutoMerge(t *testing.T) {
+	s := giteatest.NewServer(t, "infra", "widget")
+	s.AddPR(&giteatest.PullRequest{Number: 1, Statuses: []giteatest.Status{{Context: "ci/build", State: "success"}}})
+	s.AddPR(&giteatest.PullRequest{Number: 2, Statuses: []giteatest.Status{{Context: "ci/build", State: "pending"}}})
+	f := newForge(t, s)
+	ctx := context.Background()
+
+	pr, _ := f.GetPullRequest(ctx, 1)
+	err := f.EnableAutoMerge(ctx, pr, forge.MergeOptions{Method: "merge"})
+	if !errors.Is(err, forge.ErrCanMergeNow) {
+		t.Errorf("got %v, want ErrCanMergeNow for passed checks", err)
+	}
+
+	pr, _ = f.GetPullRequest(ctx, 2)
+	err = f.EnableAutoMerge(ctx, pr, forge.MergeOptions{Method: "merge"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, _ = f.GetPullRequest(ctx, 2)
+	if !pr.AutoMerge || pr.State != "open" || !s.PR(2).MergeWhenChecksSucceed {
+		t.Fatalf("got auto-merge %v state %v, want scheduled to merge when the checks succeed", pr.AutoMerge, pr.State)
+	}
+	s.SetStatus(2, giteatest.Status{Context: "ci/build", State: "success"})
+	pr, _ = f.GetPullRequest(ctx, 2)
+	if !pr.Merged || pr.AutoMerge {
+		t.Errorf("got #2 merged %v auto-merge %v, want merged after the checks succeeded", pr.Merged, pr.AutoMerge)
+	}
+}
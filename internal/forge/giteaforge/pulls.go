@@ -0,0 +1,306 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package giteaforge
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+)
+
+// pullRequest is a pull request from the Gitea API.
+type pullRequest struct {
+	ID      int64  `json:"id"`
+	Number  int    `json:"number"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	HTMLURL string `json:"html_url"`
+	User    user   `json:"user"`
+	Labels  []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	CreatedAt time.Time `json:"created_at"`
+	// State open or closed.
+	State          string `json:"state"`
+	Merged         bool   `json:"merged"`
+	MergeCommitSHA string `json:"merge_commit_sha"`
+	// Mergeable false when the PR has conflicts, or while Gitea checks it.
+	Mergeable bool   `json:"mergeable"`
+	Head      branch `json:"head"`
+	Base      branch `json:"base"`
+}
+
+// branch is the head or base of a pull request.
+type branch struct {
+	Ref string `json:"ref"`
+	SHA string `json:"sha"`
+}
+
+// pullPath returns the API path of the pull request number.
+func (f *Forge) pullPath(number int) string {
+	return f.path + "/pulls/" + strconv.Itoa(number)
+}
+
+// ListPullRequests lists the pull requests. The Gitea API can't filter by
+// base branch, so they are filtered here.
+func (f *Forge) ListPullRequests(ctx context.Context, state, base string) ([]*forge.PullRequest, error) {
+	ps, err := list[pullRequest](ctx, f, f.path+"/pulls", url.Values{
+		"state": {state},
+		"sort":  {"oldest"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't list PRs: %v %v", f.repo.FullName, err)
+	}
+	var prs []*forge.PullRequest
+	for _, p := range ps {
+		if base == "" || p.Base.Ref == base {
+			prs = append(prs, f.fromPullRequest(p))
+		}
+	}
+	return prs, nil
+}
+
+func (f *Forge) GetPullRequest(ctx context.Context, number int) (*forge.PullRequest, error) {
+	var p pullRequest
+	_, err := f.do(ctx, "GET", f.pullPath(number), nil, nil, &p)
+	if err != nil {
+		return nil, err
+	}
+	return f.fromPullRequest(&p), nil
+}
+
+func (f *Forge) ListFiles(ctx context.Context, number int) ([]string, error) {
+	fs, err := list[struct {
+		Filename string `json:"filename"`
+	}](ctx, f, f.pullPath(number)+"/files", nil)
+	if err != nil {
+		return nil, fmt.Errorf("can't list files: %v %v %v", f.repo.FullName, number, err)
+	}
+	var files []string
+	for _, file := range fs {
+		files = append(files, file.Filename)
+	}
+	return files, nil
+}
+
+func (f *Forge) ListCommits(ctx context.Context, number int) ([]*forge.Commit, error) {
+	cs, err := list[struct {
+		SHA    string `json:"sha"`
+		Commit struct {
+			Author struct {
+				Name  string `json:"name"`
+				Email string `json:"email"`
+			} `json:"author"`
+		} `json:"commit"`
+	}](ctx, f, f.pullPath(number)+"/commits", nil)
+	if err != nil {
+		return nil, fmt.Errorf("can't list commits: %v %v %v", f.repo.FullName, number, err)
+	}
+	var commits []*forge.Commit
+	for _, c := range cs {
+		commits = append(commits, &forge.Commit{SHA: c.SHA, AuthorName: c.Commit.Author.Name, AuthorEmail: c.Commit.Author.Email})
+	}
+	return commits, nil
+}
+
+// reviewStates maps the Gitea review states to the Github ones.
+var reviewStates = map[string]string{
+	"APPROVED":        "APPROVED",
+	"REQUEST_CHANGES": "CHANGES_REQUESTED",
+	"COMMENT":         "COMMENTED",
+	"PENDING":         "PENDING",
+}
+
+func (f *Forge) ListReviews(ctx context.Context, number int) ([]*forge.Review, error) {
+	rs, err := list[struct {
+		ID        int64  `json:"id"`
+		User      user   `json:"user"`
+		State     string `json:"state"`
+		Dismissed bool   `json:"dismissed"`
+	}](ctx, f, f.pullPath(number)+"/reviews", nil)
+	if err != nil {
+		return nil, fmt.Errorf("can't list reviews: %v %v %v", f.repo.FullName, number, err)
+	}
+	var reviews []*forge.Review
+	for _, r := range rs {
+		state := reviewStates[r.State]
+		if state == "" {
+			state = r.State
+		}
+		if r.Dismissed {
+			state = "DISMISSED"
+		}
+		reviews = append(reviews, &forge.Review{ID: r.ID, Author: r.User.Login, State: state})
+	}
+	return reviews, nil
+}
+
+func (f *Forge) Approve(ctx context.Context, pr *forge.PullRequest, body string) error {
+	_, err := f.do(ctx, "POST", f.pullPath(pr.Number)+"/reviews", nil, map[string]string{
+		"event":     "APPROVED",
+		"body":      body,
+		"commit_id": pr.HeadSHA,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("can't approve %v: %v", pr.Number, err)
+	}
+	return nil
+}
+
+func (f *Forge) EditBody(ctx context.Context, pr *forge.PullRequest, body string) error {
+	_, err := f.do(ctx, "PATCH", f.pullPath(pr.Number), nil, map[string]string{"body": body}, nil)
+	return err
+}
+
+// AddLabel adds the repository label to the PR. Older Gitea servers only
+// take label IDs, so the label is looked up by name.
+func (f *Forge) AddLabel(ctx context.Context, pr *forge.PullRequest, label string) error {
+	labels, err := list[struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	}](ctx, f, f.path+"/labels", nil)
+	if err != nil {
+		return fmt.Errorf("can't list labels: %v %v", f.repo.FullName, err)
+	}
+	for _, l := range labels {
+		if l.Name == label {
+			_, err = f.do(ctx, "POST", f.path+"/issues/"+strconv.Itoa(pr.Number)+"/labels", nil,
+				map[string][]int64{"labels": {l.ID}}, nil)
+			return err
+		}
+	}
+	return fmt.Errorf("no label %q in %v", label, f.repo.FullName)
+}
+
+// mergeStyles maps the merge methods to the Gitea merge styles.
+var mergeStyles = map[string]string{
+	"merge":  "merge",
+	"squash": "squash",
+	"rebase": "rebase",
+}
+
+// mergeBody returns the parameters of a merge using opts.
+func mergeBody(opts forge.MergeOptions) (map[string]any, error) {
+	style, ok := mergeStyles[opts.Method]
+	if !ok {
+		return nil, fmt.Errorf("unknown merge method %q", opts.Method)
+	}
+	body := map[string]any{"Do": style}
+	if opts.Title != "" {
+		body["MergeTitleField"] = opts.Title
+		body["MergeMessageField"] = opts.Body
+	}
+	if opts.SHA != "" {
+		body["head_commit_id"] = opts.SHA
+	}
+	return body, nil
+}
+
+func (f *Forge) Merge(ctx context.Context, pr *forge.PullRequest, opts forge.MergeOptions) (*forge.MergeResult, error) {
+	body, err := mergeBody(opts)
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.do(ctx, "POST", f.pullPath(pr.Number)+"/merge", nil, body, nil)
+	if err != nil {
+		return nil, err
+	}
+	// The response is empty, the merge commit is on the merged PR.
+	var p pullRequest
+	_, err = f.do(ctx, "GET", f.pullPath(pr.Number), nil, nil, &p)
+	if err != nil {
+		return nil, err
+	}
+	if !p.Merged {
+		return &forge.MergeResult{Message: fmt.Sprintf("PR is %v", p.State)}, nil
+	}
+	return &forge.MergeResult{Merged: true, SHA: p.MergeCommitSHA, Message: "merged"}, nil
+}
+
+// EnableAutoMerge schedules the PR to merge when its checks succeed. Gitea
+// would merge a PR with passing checks right away, so those return
+// forge.ErrCanMergeNow.
+func (f *Forge) EnableAutoMerge(ctx context.Context, pr *forge.PullRequest, opts forge.MergeOptions) error {
+	status, err := f.combinedStatus(ctx, pr.HeadSHA)
+	if err != nil {
+		return err
+	}
+	if status.State == "" || status.State == "success" {
+		return forge.ErrCanMergeNow
+	}
+	body, err := mergeBody(opts)
+	if err != nil {
+		return err
+	}
+	body["head_commit_id"] = pr.HeadSHA
+	body["merge_when_checks_succeed"] = true
+	_, err = f.do(ctx, "POST", f.pullPath(pr.Number)+"/merge", nil, body, nil)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.autoMerge[pr.Number] = true
+	return nil
+}
+
+// InMergeQueue returns false, Gitea has no merge queue.
+func (f *Forge) InMergeQueue(ctx context.Context, pr *forge.PullRequest) (bool, error) {
+	return false, nil
+}
+
+func (f *Forge) Enqueue(ctx context.Context, pr *forge.PullRequest) (int, error) {
+	return 0, forge.ErrNotSupported
+}
+
+// fromPullRequest converts a Gitea pull request. Gitea only reports whether
+// the PR has conflicts, not whether it is behind or blocked. AutoMerge is
+// set for the open PRs that this forge scheduled to merge.
+func (f *Forge) fromPullRequest(p *pullRequest) *forge.PullRequest {
+	pr := &forge.PullRequest{
+		Number:         p.Number,
+		ID:             strconv.FormatInt(p.ID, 10),
+		Title:          p.Title,
+		Body:           p.Body,
+		URL:            p.HTMLURL,
+		Author:         p.User.Login,
+		CreatedAt:      p.CreatedAt,
+		State:          p.State,
+		Merged:         p.Merged,
+		MergeCommitSHA: p.MergeCommitSHA,
+		HeadRef:        p.Head.Ref,
+		HeadSHA:        p.Head.SHA,
+		BaseRef:        p.Base.Ref,
+		Mergeable:      boolPtr(p.Mergeable),
+		MergeableState: "clean",
+		Rebaseable:     boolPtr(p.Mergeable),
+	}
+	if !p.Mergeable {
+		pr.MergeableState = "dirty"
+	}
+	for _, l := range p.Labels {
+		pr.Labels = append(pr.Labels, l.Name)
+	}
+	if p.State == "open" {
+		f.mu.Lock()
+		pr.AutoMerge = f.autoMerge[p.Number]
+		f.mu.Unlock()
+	}
+	return pr
+}
@@ -0,0 +1,158 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubforge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/google/go-github/v51/github"
+	"github.com/hessjcg/git-gtool/internal/forge"
+	"github.com/hessjcg/git-gtool/internal/model"
+)
+
+func (f *Forge) ListStatuses(ctx context.Context, sha string) ([]*forge.Status, error) {
+	g := &model.ListGenerator[github.RepoStatus]{
+		Retrieve: func(ctx context.Context, opts github.ListOptions) ([]*github.RepoStatus, *github.Response, error) {
+			pg, res, err := f.client.Repositories.GetCombinedStatus(ctx, f.repo.Owner, f.repo.Name, sha, &opts)
+			if err != nil {
+				return nil, res, err
+			}
+			return pg.Statuses, res, err
+		},
+	}
+	items, err := model.Collect(g.All(ctx), 0)
+	if err != nil {
+		return nil, fmt.Errorf("can't list statuses: %v %v %v", f.repo.FullName, sha, err)
+	}
+	var statuses []*forge.Status
+	for _, s := range items {
+		statuses = append(statuses, FromStatus(s))
+	}
+	return statuses, nil
+}
+
+// ListCheckRuns returns the latest check runs on the commit sha, which
+// confusingly is a different API from statuses.
+func (f *Forge) ListCheckRuns(ctx context.Context, sha string) ([]*forge.CheckRun, error) {
+	g := &model.ListGenerator[github.CheckRun]{
+		Retrieve: func(ctx context.Context, opts github.ListOptions) ([]*github.CheckRun, *github.Response, error) {
+			pg, res, err := f.client.Checks.ListCheckRunsForRef(ctx, f.repo.Owner, f.repo.Name, sha, &github.ListCheckRunsOptions{
+				Filter:      github.String("latest"),
+				ListOptions: opts,
+			})
+			if err != nil {
+				return nil, res, err
+			}
+			return pg.CheckRuns, res, err
+		},
+	}
+	items, err := model.Collect(g.All(ctx), 0)
+	if err != nil {
+		return nil, fmt.Errorf("can't list check runs: %v %v %v", f.repo.FullName, sha, err)
+	}
+	var runs []*forge.CheckRun
+	for _, r := range items {
+		runs = append(runs, FromCheckRun(r))
+	}
+	return runs, nil
+}
+
+// rule is a rule that applies to a branch, from the repository rulesets.
+type rule struct {
+	Type       string          `json:"type"`
+	Parameters json.RawMessage `json:"parameters"`
+}
+
+// requiredStatusChecksRule holds the parameters of a required_status_checks
+// rule.
+type requiredStatusChecksRule struct {
+	RequiredStatusChecks []struct {
+		Context       string `json:"context"`
+		IntegrationID *int64 `json:"integration_id"`
+	} `json:"required_status_checks"`
+}
+
+// BranchRules returns the rules for branch combined from classic branch
+// protection and from the repository rulesets.
+func (f *Forge) BranchRules(ctx context.Context, branch string) (*forge.BranchRules, error) {
+	rules := &forge.BranchRules{}
+
+	required, _, err := f.client.Repositories.GetRequiredStatusChecks(ctx, f.repo.Owner, f.repo.Name, branch)
+	switch {
+	case isNotFound(err):
+		// The branch is not protected, or protection has no required checks.
+	case err != nil:
+		return nil, fmt.Errorf("can't get branch protection for %v: %v", branch, err)
+	default:
+		for _, c := range required.Checks {
+			rules.AddCheck(FromRequiredCheck(c))
+		}
+	}
+
+	// The rules API is not in go-github v51.
+	req, err := f.client.NewRequest("GET", fmt.Sprintf("repos/%v/%v/rules/branches/%v", f.repo.Owner, f.repo.Name, url.PathEscape(branch)), nil)
+	if err != nil {
+		return nil, err
+	}
+	var rs []*rule
+	_, err = f.client.Do(ctx, req, &rs)
+	if isNotFound(err) {
+		// Github Enterprise servers without rulesets.
+		return rules, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't get rules for %v: %v", branch, err)
+	}
+	for _, r := range rs {
+		switch r.Type {
+		case "required_status_checks":
+			var p requiredStatusChecksRule
+			err = json.Unmarshal(r.Parameters, &p)
+			if err != nil {
+				return nil, fmt.Errorf("can't parse required_status_checks rule for %v: %v", branch, err)
+			}
+			for _, c := range p.RequiredStatusChecks {
+				rules.AddCheck(forge.RequiredCheck{Context: c.Context, AppID: c.IntegrationID})
+			}
+		case "merge_queue":
+			rules.MergeQueue = true
+		}
+	}
+	return rules, nil
+}
+
+// FromStatus converts a Github commit status.
+func FromStatus(s *github.RepoStatus) *forge.Status {
+	return &forge.Status{Context: s.GetContext(), State: s.GetState(), URL: s.GetTargetURL()}
+}
+
+// FromCheckRun converts a Github check run.
+func FromCheckRun(r *github.CheckRun) *forge.CheckRun {
+	return &forge.CheckRun{
+		Name:       r.GetName(),
+		AppID:      r.GetApp().GetID(),
+		Status:     r.GetStatus(),
+		Conclusion: r.GetConclusion(),
+		URL:        r.GetHTMLURL(),
+	}
+}
+
+// FromRequiredCheck converts a required check from Github branch protection.
+func FromRequiredCheck(c *github.RequiredStatusCheck) forge.RequiredCheck {
+	return forge.RequiredCheck{Context: c.Context, AppID: c.AppID}
+}
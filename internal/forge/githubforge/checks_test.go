@@ -0,0 +1,121 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubforge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-github/v51/github"
+)
+
+// rulesServer serves the branch protection and rules APIs for main from the
+// recorded payloads. A payload named "" responds with 404.
+func rulesServer(t *testing.T, protection, rules string) *Forge {
+	serve := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if name == "" {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"message": "Not Found"}`)
+				return
+			}
+			b, err := os.ReadFile(filepath.Join("testdata", name))
+			if err != nil {
+				t.Error(err)
+			}
+			w.Write(b)
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/example/widget/branches/main/protection/required_status_checks", serve(protection))
+	mux.HandleFunc("/repos/example/widget/rules/branches/main", serve(rules))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+	return New(client, &github.Repository{
+		Owner:    &github.User{Login: github.String("example")},
+		Name:     github.String("widget"),
+		FullName: github.String("example/widget"),
+	})
+}
+
+func TestBranchRules(t *testing.T) {
+	tests := []struct {
+		name       string
+		protection string
+		rules      string
+		want       []string
+		mergeQueue bool
+	}{
+		{
+			name:       "protection and rulesets",
+			protection: "required_status_checks.json",
+			rules:      "branch_rules.json",
+			want: []string{
+				"ci/circleci: build/0", "build/15368", "docs/15368", "release-notes/15368",
+				"renovate/stability-days/0", "license/fossa/0",
+			},
+			mergeQueue: true,
+		},
+		{
+			name:       "rulesets only",
+			rules:      "branch_rules.json",
+			want:       []string{"build/15368", "ci/circleci: build/0", "license/fossa/0"},
+			mergeQueue: true,
+		},
+		{
+			name:       "no rulesets api",
+			protection: "required_status_checks.json",
+			want: []string{
+				"ci/circleci: build/0", "build/15368", "docs/15368", "release-notes/15368",
+				"renovate/stability-days/0",
+			},
+		},
+		{
+			name: "unprotected",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := rulesServer(t, tc.protection, tc.rules)
+			rules, err := f.BranchRules(context.Background(), "main")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, c := range rules.Checks {
+				var id int64
+				if c.AppID != nil {
+					id = *c.AppID
+				}
+				got = append(got, fmt.Sprintf("%v/%d", c.Context, id))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("got checks %q, want %q", got, tc.want)
+			}
+			if rules.MergeQueue != tc.mergeQueue {
+				t.Errorf("got merge queue %v, want %v", rules.MergeQueue, tc.mergeQueue)
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package githubforge implements forge.Forge using the Github REST and
+// GraphQL APIs.
+package githubforge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v51/github"
+	"github.com/hessjcg/git-gtool/internal/forge"
+	"github.com/hessjcg/git-gtool/internal/model"
+)
+
+var approve = "APPROVE"
+
+// Forge is a Github repository.
+type Forge struct {
+	client *github.Client
+	repo   *forge.Repository
+}
+
+var _ forge.Forge = (*Forge)(nil)
+
+// New returns the Forge for repo, using client for the API calls.
+func New(client *github.Client, repo *github.Repository) *Forge {
+	return &Forge{client: client, repo: FromRepository(repo)}
+}
+
+func (f *Forge) Repository() *forge.Repository {
+	return f.repo
+}
+
+func (f *Forge) ListPullRequests(ctx context.Context, state, base string) ([]*forge.PullRequest, error) {
+	g := &model.ListGenerator[github.PullRequest]{
+		Retrieve: func(ctx context.Context, opts github.ListOptions) ([]*github.PullRequest, *github.Response, error) {
+			return f.client.PullRequests.List(ctx, f.repo.Owner, f.repo.Name, &github.PullRequestListOptions{
+				Sort:        "created",
+				Direction:   "asc",
+				State:       state,
+				Base:        base,
+				ListOptions: opts,
+			})
+		},
+	}
+	items, err := model.Collect(g.All(ctx), 0)
+	if err != nil {
+		return nil, fmt.Errorf("can't list PRs: %v %v", f.repo.FullName, err)
+	}
+	var prs []*forge.PullRequest
+	for _, pr := range items {
+		prs = append(prs, FromPullRequest(pr))
+	}
+	return prs, nil
+}
+
+func (f *Forge) GetPullRequest(ctx context.Context, number int) (*forge.PullRequest, error) {
+	pr, _, err := f.client.PullRequests.Get(ctx, f.repo.Owner, f.repo.Name, number)
+	if err != nil {
+		return nil, err
+	}
+	return FromPullRequest(pr), nil
+}
+
+func (f *Forge) ListFiles(ctx context.Context, number int) ([]string, error) {
+	g := &model.ListGenerator[github.CommitFile]{
+		Retrieve: func(ctx context.Context, opts github.ListOptions) ([]*github.CommitFile, *github.Response, error) {
+			return f.client.PullRequests.ListFiles(ctx, f.repo.Owner, f.repo.Name, number, &opts)
+		},
+	}
+	items, err := model.Collect(g.All(ctx), 0)
+	if err != nil {
+		return nil, fmt.Errorf("can't list files: %v %v %v", f.repo.FullName, number, err)
+	}
+	var files []string
+	for _, file := range items {
+		files = append(files, file.GetFilename())
+	}
+	return files, nil
+}
+
+func (f *Forge) ListCommits(ctx context.Context, number int) ([]*forge.Commit, error) {
+	g := &model.ListGenerator[github.RepositoryCommit]{
+		Retrieve: func(ctx context.Context, opts github.ListOptions) ([]*github.RepositoryCommit, *github.Response, error) {
+			return f.client.PullRequests.ListCommits(ctx, f.repo.Owner, f.repo.Name, number, &opts)
+		},
+	}
+	items, err := model.Collect(g.All(ctx), 0)
+	if err != nil {
+		return nil, fmt.Errorf("can't list commits: %v %v %v", f.repo.FullName, number, err)
+	}
+	var commits []*forge.Commit
+	for _, c := range items {
+		a := c.GetCommit().GetAuthor()
+		commits = append(commits, &forge.Commit{SHA: c.GetSHA(), AuthorName: a.GetName(), AuthorEmail: a.GetEmail()})
+	}
+	return commits, nil
+}
+
+func (f *Forge) ListReviews(ctx context.Context, number int) ([]*forge.Review, error) {
+	g := &model.ListGenerator[github.PullRequestReview]{
+		Retrieve: func(ctx context.Context, opts github.ListOptions) ([]*github.PullRequestReview, *github.Response, error) {
+			return f.client.PullRequests.ListReviews(ctx, f.repo.Owner, f.repo.Name, number, &opts)
+		},
+	}
+	items, err := model.Collect(g.All(ctx), 0)
+	if err != nil {
+		return nil, fmt.Errorf("can't get review: %v", err)
+	}
+	var reviews []*forge.Review
+	for _, r := range items {
+		reviews = append(reviews, &forge.Review{ID: r.GetID(), Author: r.GetUser().GetLogin(), State: r.GetState()})
+	}
+	return reviews, nil
+}
+
+func (f *Forge) Approve(ctx context.Context, pr *forge.PullRequest, body string) error {
+	review := &github.PullRequestReviewRequest{
+		NodeID:   github.String(pr.ID),
+		Body:     &body,
+		CommitID: github.String(pr.HeadSHA),
+		Event:    &approve,
+	}
+	created, _, err := f.client.PullRequests.CreateReview(ctx, f.repo.Owner, f.repo.Name, pr.Number, review)
+	if err != nil {
+		return fmt.Errorf("can't create review: %v %v %v %v", f.repo.FullName, pr.Number, pr.Title, err)
+	}
+	// Reviews created with an event are usually submitted already, and Github
+	// refuses to submit them again.
+	_, _, err = f.client.PullRequests.SubmitReview(ctx, f.repo.Owner, f.repo.Name, pr.Number, created.GetID(), review)
+	if err != nil && !isUnprocessable(err) {
+		return fmt.Errorf("can't submit review: %v %v %v %v", f.repo.FullName, pr.Number, pr.Title, err)
+	}
+	return nil
+}
+
+func (f *Forge) EditBody(ctx context.Context, pr *forge.PullRequest, body string) error {
+	_, _, err := f.client.PullRequests.Edit(ctx, f.repo.Owner, f.repo.Name, pr.Number, &github.PullRequest{
+		Body: &body,
+	})
+	if err != nil {
+		return fmt.Errorf("can't edit PR body: %v %v %v", f.repo.FullName, pr.Number, err)
+	}
+	return nil
+}
+
+func (f *Forge) AddLabel(ctx context.Context, pr *forge.PullRequest, label string) error {
+	_, _, err := f.client.Issues.AddLabelsToIssue(ctx, f.repo.Owner, f.repo.Name, pr.Number, []string{label})
+	if err != nil {
+		return fmt.Errorf("can't add label %v: %v %v %v", label, f.repo.FullName, pr.Number, err)
+	}
+	return nil
+}
+
+func (f *Forge) Merge(ctx context.Context, pr *forge.PullRequest, opts forge.MergeOptions) (*forge.MergeResult, error) {
+	res, _, err := f.client.PullRequests.Merge(ctx, f.repo.Owner, f.repo.Name, pr.Number, opts.Body, &github.PullRequestOptions{
+		MergeMethod: opts.Method,
+		CommitTitle: opts.Title,
+		SHA:         opts.SHA,
+	})
+	if res == nil {
+		return nil, err
+	}
+	return &forge.MergeResult{Merged: res.GetMerged(), SHA: res.GetSHA(), Message: res.GetMessage()}, err
+}
+
+func (f *Forge) EnableAutoMerge(ctx context.Context, pr *forge.PullRequest, opts forge.MergeOptions) error {
+	vars := map[string]any{
+		"id":     pr.ID,
+		"method": strings.ToUpper(opts.Method),
+		"sha":    pr.HeadSHA,
+		"title":  opts.Title,
+	}
+	if opts.Body != "" {
+		vars["body"] = opts.Body
+	}
+	err := model.GraphQL(ctx, f.client, `mutation($id: ID!, $method: PullRequestMergeMethod, $sha: GitObjectID, $title: String, $body: String) {
+  enablePullRequestAutoMerge(input: {pullRequestId: $id, mergeMethod: $method, expectedHeadOid: $sha, commitHeadline: $title, commitBody: $body}) {
+    clientMutationId
+  }
+}`, vars, nil)
+	if err != nil && strings.Contains(err.Error(), "clean status") {
+		return forge.ErrCanMergeNow
+	}
+	return err
+}
+
+func (f *Forge) InMergeQueue(ctx context.Context, pr *forge.PullRequest) (bool, error) {
+	var out struct {
+		Node struct {
+			IsInMergeQueue bool `json:"isInMergeQueue"`
+		} `json:"node"`
+	}
+	err := model.GraphQL(ctx, f.client, `query($id: ID!) {
+  node(id: $id) { ... on PullRequest { isInMergeQueue } }
+}`, map[string]any{"id": pr.ID}, &out)
+	if err != nil {
+		return false, fmt.Errorf("can't check if #%d is in the merge queue: %v", pr.Number, err)
+	}
+	return out.Node.IsInMergeQueue, nil
+}
+
+func (f *Forge) Enqueue(ctx context.Context, pr *forge.PullRequest) (int, error) {
+	var out struct {
+		EnqueuePullRequest struct {
+			MergeQueueEntry struct {
+				Position int `json:"position"`
+			} `json:"mergeQueueEntry"`
+		} `json:"enqueuePullRequest"`
+	}
+	err := model.GraphQL(ctx, f.client, `mutation($id: ID!, $sha: GitObjectID) {
+  enqueuePullRequest(input: {pullRequestId: $id, expectedHeadOid: $sha}) {
+    mergeQueueEntry { position }
+  }
+}`, map[string]any{"id": pr.ID, "sha": pr.HeadSHA}, &out)
+	if err != nil {
+		return 0, err
+	}
+	return out.EnqueuePullRequest.MergeQueueEntry.Position, nil
+}
+
+func (f *Forge) ListPendingWorkflowRuns(ctx context.Context, branch string) ([]*forge.WorkflowRun, error) {
+	g := &model.ListGenerator[github.WorkflowRun]{
+		Retrieve: func(ctx context.Context, opts github.ListOptions) ([]*github.WorkflowRun, *github.Response, error) {
+			r, res, err := f.client.Actions.ListRepositoryWorkflowRuns(ctx, f.repo.Owner, f.repo.Name, &github.ListWorkflowRunsOptions{
+				Event:       "pull_request",
+				Status:      "action_required",
+				Branch:      branch,
+				ListOptions: opts,
+			})
+			if err != nil {
+				return nil, res, err
+			}
+			return r.WorkflowRuns, res, err
+		},
+	}
+	items, err := model.Collect(g.All(ctx), 0)
+	if err != nil {
+		return nil, err
+	}
+	var runs []*forge.WorkflowRun
+	for _, r := range items {
+		runs = append(runs, &forge.WorkflowRun{
+			ID:         r.GetID(),
+			URL:        r.GetURL(),
+			HeadBranch: r.GetHeadBranch(),
+			HeadSHA:    r.GetHeadSHA(),
+			Status:     r.GetStatus(),
+		})
+	}
+	return runs, nil
+}
+
+func (f *Forge) ApproveWorkflowRun(ctx context.Context, run *forge.WorkflowRun) error {
+	req, err := f.client.NewRequest("POST", run.URL+"/approve", nil)
+	if err != nil {
+		return err
+	}
+	_, err = f.client.Do(ctx, req, nil)
+	if err != nil {
+		return fmt.Errorf("can't approve workflow: %v", err)
+	}
+	return nil
+}
+
+// FromRepository converts a Github repository.
+func FromRepository(r *github.Repository) *forge.Repository {
+	return &forge.Repository{
+		Owner:            r.GetOwner().GetLogin(),
+		Name:             r.GetName(),
+		FullName:         r.GetFullName(),
+		DefaultBranch:    r.GetDefaultBranch(),
+		URL:              r.GetHTMLURL(),
+		AllowSquashMerge: r.AllowSquashMerge,
+		AllowMergeCommit: r.AllowMergeCommit,
+		AllowRebaseMerge: r.AllowRebaseMerge,
+	}
+}
+
+// FromPullRequest converts a Github pull request.
+func FromPullRequest(pr *github.PullRequest) *forge.PullRequest {
+	p := &forge.PullRequest{
+		Number:         pr.GetNumber(),
+		ID:             pr.GetNodeID(),
+		Title:          pr.GetTitle(),
+		Body:           pr.GetBody(),
+		URL:            pr.GetHTMLURL(),
+		Author:         pr.GetUser().GetLogin(),
+		CreatedAt:      pr.GetCreatedAt().Time,
+		State:          pr.GetState(),
+		Merged:         pr.GetMerged(),
+		MergeCommitSHA: pr.GetMergeCommitSHA(),
+		HeadRef:        pr.GetHead().GetRef(),
+		HeadSHA:        pr.GetHead().GetSHA(),
+		BaseRef:        pr.GetBase().GetRef(),
+		Mergeable:      pr.Mergeable,
+		MergeableState: pr.GetMergeableState(),
+		Rebaseable:     pr.Rebaseable,
+		AutoMerge:      pr.AutoMerge != nil,
+	}
+	for _, l := range pr.Labels {
+		p.Labels = append(p.Labels, l.GetName())
+	}
+	return p
+}
+
+// isNotFound returns true when err is a 404 response from the Github API.
+func isNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// isUnprocessable returns true when err is a 422 response from the Github
+// API.
+func isUnprocessable(err error) bool {
+	return hasStatus(err, http.StatusUnprocessableEntity)
+}
+
+func hasStatus(err error, status int) bool {
+	var e *github.ErrorResponse
+	return errors.As(err, &e) && e.Response != nil && e.Response.StatusCode == status
+}
@@ -0,0 +1,147 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitlabforge
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+)
+
+// PipelineCheck is the name of the check run that reports the latest
+// pipeline of a commit. It is required when the project only allows merges
+// after the pipeline succeeds.
+const PipelineCheck = "pipeline"
+
+// pipeline is a CI pipeline from the GitLab API.
+type pipeline struct {
+	ID     int64  `json:"id"`
+	SHA    string `json:"sha"`
+	Ref    string `json:"ref"`
+	Status string `json:"status"`
+	WebURL string `json:"web_url"`
+}
+
+// commitStatus is a commit status from the GitLab API. The jobs of the
+// pipelines report their status on the commit, as well as external CI.
+type commitStatus struct {
+	Name         string `json:"name"`
+	Status       string `json:"status"`
+	TargetURL    string `json:"target_url"`
+	AllowFailure bool   `json:"allow_failure"`
+}
+
+func (f *Forge) ListStatuses(ctx context.Context, sha string) ([]*forge.Status, error) {
+	ss, err := list[commitStatus](ctx, f, f.project+"/repository/commits/"+url.PathEscape(sha)+"/statuses", nil)
+	if err != nil {
+		return nil, fmt.Errorf("can't list statuses: %v %v %v", f.repo.FullName, sha, err)
+	}
+	var statuses []*forge.Status
+	for _, s := range ss {
+		statuses = append(statuses, fromCommitStatus(s))
+	}
+	return statuses, nil
+}
+
+// ListCheckRuns returns the latest pipeline on the commit sha as the check
+// run PipelineCheck, or nothing when there is no pipeline.
+func (f *Forge) ListCheckRuns(ctx context.Context, sha string) ([]*forge.CheckRun, error) {
+	var ps []*pipeline
+	_, err := f.do(ctx, "GET", f.project+"/pipelines", url.Values{
+		"sha":      {sha},
+		"order_by": {"id"},
+		"sort":     {"desc"},
+		"per_page": {"1"},
+	}, nil, &ps)
+	if err != nil {
+		return nil, fmt.Errorf("can't list pipelines: %v %v %v", f.repo.FullName, sha, err)
+	}
+	if len(ps) == 0 {
+		return nil, nil
+	}
+	return []*forge.CheckRun{fromPipeline(ps[0])}, nil
+}
+
+// BranchRules requires PipelineCheck when the project only allows merges
+// after the pipeline succeeds. The approval rules are not checks, GitLab
+// reports them in the merge status of each merge request.
+func (f *Forge) BranchRules(ctx context.Context, branch string) (*forge.BranchRules, error) {
+	p, err := f.getProject(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can't get merge settings for %v: %v", f.repo.FullName, err)
+	}
+	rules := &forge.BranchRules{}
+	if p.OnlyAllowMergeIfPipelineSucceeds {
+		rules.AddCheck(forge.RequiredCheck{Context: PipelineCheck})
+	}
+	return rules, nil
+}
+
+// ListPendingWorkflowRuns returns nothing. GitLab pipelines don't wait for
+// approval the way Github Actions runs from forks do.
+func (f *Forge) ListPendingWorkflowRuns(ctx context.Context, branch string) ([]*forge.WorkflowRun, error) {
+	return nil, nil
+}
+
+func (f *Forge) ApproveWorkflowRun(ctx context.Context, run *forge.WorkflowRun) error {
+	return forge.ErrNotSupported
+}
+
+// fromCommitStatus converts a GitLab commit status. Jobs that are allowed to
+// fail count as successful, and skipped jobs don't block the merge.
+func fromCommitStatus(s *commitStatus) *forge.Status {
+	st := &forge.Status{Context: s.Name, URL: s.TargetURL}
+	switch s.Status {
+	case "success", "skipped":
+		st.State = "success"
+	case "failed":
+		st.State = "failure"
+		if s.AllowFailure {
+			st.State = "success"
+		}
+	case "canceled":
+		st.State = "error"
+	default:
+		// created, waiting_for_resource, preparing, pending, running,
+		// scheduled and manual.
+		st.State = "pending"
+	}
+	return st
+}
+
+// fromPipeline converts a GitLab pipeline to a check run.
+func fromPipeline(p *pipeline) *forge.CheckRun {
+	r := &forge.CheckRun{Name: PipelineCheck, Status: "completed", URL: p.WebURL}
+	switch p.Status {
+	case "success":
+		r.Conclusion = "success"
+	case "failed":
+		r.Conclusion = "failure"
+	case "canceled":
+		r.Conclusion = "cancelled"
+	case "skipped":
+		r.Conclusion = "skipped"
+	case "manual":
+		r.Conclusion = "action_required"
+	case "running":
+		r.Status = "in_progress"
+	default:
+		// created, waiting_for_resource, preparing, pending and scheduled.
+		r.Status = "queued"
+	}
+	return r
+}
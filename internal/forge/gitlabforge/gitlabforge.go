@@ -0,0 +1,229 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gitlabforge implements forge.Forge using the GitLab REST API.
+// Merge requests are the forge's pull requests, numbered by their project
+// iid, and the latest pipeline of a commit is reported as a check run named
+// PipelineCheck.
+package gitlabforge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+)
+
+// perPage is the page size of list requests, the most GitLab allows.
+const perPage = 100
+
+// Forge is a GitLab project.
+type Forge struct {
+	client  *http.Client
+	base    string
+	project string
+	repo    *forge.Repository
+}
+
+var _ forge.Forge = (*Forge)(nil)
+
+// APIURL returns the REST API url of the GitLab server on host.
+func APIURL(host string) string {
+	return "https://" + host + "/api/v4/"
+}
+
+// New returns the Forge for the project owner/name on the GitLab API at
+// baseURL, using client for the API calls. Owner is the full path of the
+// project's group. It reads the project to check that it exists.
+func New(ctx context.Context, client *http.Client, baseURL, owner, name string) (*Forge, error) {
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	if _, err := url.Parse(baseURL); err != nil {
+		return nil, fmt.Errorf("bad GitLab API url %q: %v", baseURL, err)
+	}
+	f := &Forge{
+		client:  client,
+		base:    baseURL,
+		project: "projects/" + url.PathEscape(owner+"/"+name),
+	}
+	p, err := f.getProject(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving GitLab project %v/%v: %v", owner, name, err)
+	}
+	f.repo = fromProject(p)
+	return f, nil
+}
+
+func (f *Forge) Repository() *forge.Repository {
+	return f.repo
+}
+
+// Error is an error response from the GitLab API.
+type Error struct {
+	Method     string
+	URL        string
+	StatusCode int
+	// Message the message or error field of the response, which GitLab
+	// sometimes sends as an object.
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v %v: %d %v", e.Method, e.URL, e.StatusCode, e.Message)
+}
+
+// do sends a request to the API path relative to the base url, with body
+// encoded as JSON when not nil, and decodes the response into out when not
+// nil.
+func (f *Forge) do(ctx context.Context, method, path string, query url.Values, body, out any) (*http.Response, error) {
+	// Parse the joined url to keep the escaped slashes in the project id.
+	u, err := url.Parse(f.base + path)
+	if err != nil {
+		return nil, err
+	}
+	if query != nil {
+		u.RawQuery = query.Encode()
+	}
+
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return res, err
+	}
+	if res.StatusCode >= 300 {
+		return res, &Error{Method: method, URL: path, StatusCode: res.StatusCode, Message: errorMessage(b)}
+	}
+	if out != nil {
+		err = json.Unmarshal(b, out)
+		if err != nil {
+			return res, fmt.Errorf("can't parse response from %v %v: %v", method, path, err)
+		}
+	}
+	return res, nil
+}
+
+// errorMessage returns the message from a GitLab error response body.
+func errorMessage(b []byte) string {
+	var e struct {
+		Message json.RawMessage `json:"message"`
+		Error   string          `json:"error"`
+	}
+	if json.Unmarshal(b, &e) != nil {
+		return strings.TrimSpace(string(b))
+	}
+	if e.Error != "" {
+		return e.Error
+	}
+	var s string
+	if json.Unmarshal(e.Message, &s) == nil {
+		return s
+	}
+	return string(e.Message)
+}
+
+// list gets every page of the list at path. GitLab sends the number of the
+// next page in the X-Next-Page header, which is empty on the last page.
+func list[T any](ctx context.Context, f *Forge, path string, query url.Values) ([]*T, error) {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("per_page", strconv.Itoa(perPage))
+	var items []*T
+	for page := "1"; page != ""; {
+		q.Set("page", page)
+		var pg []*T
+		res, err := f.do(ctx, "GET", path, q, nil, &pg)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, pg...)
+		page = res.Header.Get("X-Next-Page")
+	}
+	return items, nil
+}
+
+// project is a project from the GitLab API.
+type project struct {
+	Path              string `json:"path"`
+	PathWithNamespace string `json:"path_with_namespace"`
+	Namespace         struct {
+		FullPath string `json:"full_path"`
+	} `json:"namespace"`
+	DefaultBranch string `json:"default_branch"`
+	WebURL        string `json:"web_url"`
+	// MergeMethod merge, rebase_merge or ff.
+	MergeMethod string `json:"merge_method"`
+	// SquashOption never, always, default_on or default_off.
+	SquashOption                     string `json:"squash_option"`
+	OnlyAllowMergeIfPipelineSucceeds bool   `json:"only_allow_merge_if_pipeline_succeeds"`
+}
+
+func (f *Forge) getProject(ctx context.Context) (*project, error) {
+	var p project
+	_, err := f.do(ctx, "GET", f.project, nil, nil, &p)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// fromProject converts a GitLab project. GitLab merges with the method set
+// on the project, and can squash unless squashing is turned off, so a merge
+// commit is allowed unless the project only fast-forwards, and a rebase
+// merge only when it does.
+func fromProject(p *project) *forge.Repository {
+	squash := p.SquashOption != "never"
+	ff := p.MergeMethod == "ff"
+	mergeCommit := !ff
+	return &forge.Repository{
+		Owner:            p.Namespace.FullPath,
+		Name:             p.Path,
+		FullName:         p.PathWithNamespace,
+		DefaultBranch:    p.DefaultBranch,
+		URL:              p.WebURL,
+		AllowSquashMerge: &squash,
+		AllowMergeCommit: &mergeCommit,
+		AllowRebaseMerge: &ff,
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitlabforge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+	"github.com/hessjcg/git-gtool/internal/gitlabtest"
+)
+
+// newForge returns a Forge for the project on the stand-in server.
+func newForge(t *testing.T, s *gitlabtest.Server) *Forge {
+	t.Helper()
+	f, err := New(context.Background(), http.DefaultClient, s.BaseURL, s.Owner, s.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestRepository(t *testing.T) {
+	s := gitlabtest.NewServer(t, "infra/mirrors", "widget")
+	s.MergeMethod = "ff"
+	repo := newForge(t, s).Repository()
+	if repo.Owner != "infra/mirrors" || repo.Name != "widget" || repo.FullName != "infra/mirrors/widget" || repo.DefaultBranch != "main" {
+		t.Errorf("got repository %+v, want infra/mirrors/widget on main", repo)
+	}
+	if !*repo.AllowSquashMerge || *repo.AllowMergeCommit || !*repo.AllowRebaseMerge {
+		t.Errorf("got squash %v, merge %v, rebase %v, want a fast-forward project that can squash",
+			*repo.AllowSquashMerge, *repo.AllowMergeCommit, *repo.AllowRebaseMerge)
+	}
+}
+
+func TestListPullRequests(t *testing.T) {
+	s := gitlabtest.NewServer(t, "example", "widget")
+	s.PageSize = 2
+	for i := 1; i <= 4; i++ {
+		s.AddMR(&gitlabtest.MergeRequest{IID: i, Title: fmt.Sprintf("update module %d", i), Labels: []string{"deps"}})
+	}
+	s.AddMR(&gitlabtest.MergeRequest{IID: 5, State: "merged"})
+	f := newForge(t, s)
+
+	prs, err := f.ListPullRequests(context.Background(), "open", "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, pr := range prs {
+		got = append(got, pr.Number)
+	}
+	if fmt.Sprint(got) != "[1 2 3 4]" {
+		t.Fatalf("got open merge requests %v, want [1 2 3 4] across pages", got)
+	}
+	pr := prs[0]
+	mr := s.MR(1)
+	if pr.Author != "renovate-bot" || pr.HeadRef != mr.SourceBranch || pr.HeadSHA != mr.SHA || pr.BaseRef != "main" ||
+		pr.State != "open" || fmt.Sprint(pr.Labels) != "[deps]" {
+		t.Errorf("got %+v, want the fields of merge request 1", pr)
+	}
+
+	prs, err = f.ListPullRequests(context.Background(), "closed", "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prs) != 1 || !prs[0].Merged || prs[0].MergeCommitSHA == "" {
+		t.Errorf("got closed merge requests %v, want the merged #5", prs)
+	}
+}
+
+func TestFromMergeRequest(t *testing.T) {
+	tests := []struct {
+		status    string
+		mergeable string
+		state     string
+	}{
+		{status: "mergeable", mergeable: "true", state: "clean"},
+		{status: "checking", mergeable: "<nil>", state: "unknown"},
+		{status: "need_rebase", mergeable: "true", state: "behind"},
+		{status: "conflict", mergeable: "false", state: "dirty"},
+		{status: "not_approved", mergeable: "true", state: "blocked"},
+		{status: "ci_still_running", mergeable: "true", state: "blocked"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.status, func(t *testing.T) {
+			pr := fromMergeRequest(&mergeRequest{IID: 1, State: "opened", DetailedMergeStatus: tc.status})
+			mergeable := "<nil>"
+			if pr.Mergeable != nil {
+				mergeable = fmt.Sprint(*pr.Mergeable)
+			}
+			if mergeable != tc.mergeable || pr.MergeableState != tc.state {
+				t.Errorf("got mergeable %v %v, want %v %v", mergeable, pr.MergeableState, tc.mergeable, tc.state)
+			}
+		})
+	}
+}
+
+func TestChecks(t *testing.T) {
+	s := gitlabtest.NewServer(t, "example", "widget")
+	s.OnlyAllowMergeIfPipelineSucceeds = true
+	s.AddMR(&gitlabtest.MergeRequest{
+		IID: 1,
+		Statuses: []gitlabtest.Status{
+			{Name: "build", Status: "success"},
+			{Name: "lint", Status: "failed", AllowFailure: true},
+			{Name: "e2e", Status: "failed"},
+			{Name: "deploy", Status: "manual"},
+		},
+		Pipeline: "running",
+	})
+	f := newForge(t, s)
+	ctx := context.Background()
+	sha := s.MR(1).SHA
+
+	statuses, err := f.ListStatuses(ctx, sha)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, st := range statuses {
+		got = append(got, st.Context+"="+st.State)
+	}
+	if want := "[build=success lint=success e2e=failure deploy=pending]"; fmt.Sprint(got) != want {
+		t.Errorf("got statuses %v, want %v", got, want)
+	}
+
+	runs, err := f.ListCheckRuns(ctx, sha)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].Name != PipelineCheck || runs[0].Status != "in_progress" {
+		t.Fatalf("got check runs %v, want the running pipeline", runs)
+	}
+	s.SetPipeline(1, "failed")
+	runs, err = f.ListCheckRuns(ctx, sha)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs[0].Status != "completed" || runs[0].Conclusion != "failure" {
+		t.Errorf("got %+v, want the failed pipeline", runs[0])
+	}
+
+	rules, err := f.BranchRules(ctx, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules.Checks) != 1 || rules.Checks[0].Context != PipelineCheck || rules.MergeQueue {
+		t.Errorf("got rules %+v, want the pipeline required", rules)
+	}
+}
+
+func TestApproveAndMerge(t *testing.T) {
+	s := gitlabtest.NewServer(t, "example", "widget")
+	s.AddMR(&gitlabtest.MergeRequest{IID: 1, ApprovalsRequired: 1})
+	f := newForge(t, s)
+	ctx := context.Background()
+
+	pr, err := f.GetPullRequest(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.MergeableState != "blocked" {
+		t.Errorf("got mergeable state %v before approval, want blocked", pr.MergeableState)
+	}
+	err = f.Approve(ctx, pr, "LGTM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reviews, err := f.ListReviews(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reviews) != 1 || reviews[0].Author != "merge-bot" || reviews[0].State != "APPROVED" {
+		t.Errorf("got reviews %v, want an approval by merge-bot", reviews)
+	}
+	if notes := s.MR(1).Notes; fmt.Sprint(notes) != "[LGTM]" {
+		t.Errorf("got notes %q, want the approval message", notes)
+	}
+
+	_, err = f.Merge(ctx, pr, forge.MergeOptions{Method: "squash", SHA: "stale"})
+	if err == nil {
+		t.Fatal("got no error merging a stale commit")
+	}
+	res, err := f.Merge(ctx, pr, forge.MergeOptions{Method: "squash", Title: "update module", Body: "details", SHA: pr.HeadSHA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr := s.MR(1)
+	if !res.Merged || res.SHA != mr.MergeCommitSHA {
+		t.Errorf("got %+v, want merged as %v", res, mr.MergeCommitSHA)
+	}
+	if !mr.Squash || mr.CommitMessage != "update module\n\ndetails" {
+		t.Errorf("got squash %v message %q, want a squash with the message", mr.Squash, mr.CommitMessage)
+	}
+}
+
+func TestEnableAutoMerge(t *testing.T) {
+	s := gitlabtest.NewServer(t, "example", "widget")
+	s.OnlyAllowMergeIfPipelineSucceeds = true
+	s.AddMR(&gitlabtest.MergeRequest{IID: 1, Pipeline: "success"})
+	s.AddMR(&gitlabtest.MergeRequest{IID: 2, Pipeline: "running"})
+	f := newForge(t, s)
+	ctx := context.Background()
+
+	pr, _ := f.GetPullRequest(ctx, 1)
+	err := f.EnableAutoMerge(ctx, pr, forge.MergeOptions{Method: "merge"})
+	if !errors.Is(err, forge.ErrCanMergeNow) {
+		t.Errorf("got %v, want ErrCanMergeNow for a passed pipeline", err)
+	}
+
+	pr, _ = f.GetPullRequest(ctx, 2)
+	err = f.EnableAutoMerge(ctx, pr, forge.MergeOptions{Method: "merge"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, _ = f.GetPullRequest(ctx, 2)
+	if !pr.AutoMerge || pr.State != "open" {
+		t.Fatalf("got auto-merge %v state %v, want set to merge when the pipeline succeeds", pr.AutoMerge, pr.State)
+	}
+	s.SetPipeline(2, "success")
+	pr, _ = f.GetPullRequest(ctx, 2)
+	if !pr.Merged {
+		t.Errorf("got #2 not merged after the pipeline succeeded")
+	}
+}
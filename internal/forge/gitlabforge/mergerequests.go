@@ -0,0 +1,319 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitlabforge
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+)
+
+// mergeRequest is a merge request from the GitLab API.
+type mergeRequest struct {
+	ID          int64     `json:"id"`
+	IID         int       `json:"iid"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	WebURL      string    `json:"web_url"`
+	Author      user      `json:"author"`
+	Labels      []string  `json:"labels"`
+	CreatedAt   time.Time `json:"created_at"`
+	// State opened, closed, locked or merged.
+	State           string `json:"state"`
+	MergeCommitSHA  string `json:"merge_commit_sha"`
+	SquashCommitSHA string `json:"squash_commit_sha"`
+	SourceBranch    string `json:"source_branch"`
+	TargetBranch    string `json:"target_branch"`
+	SHA             string `json:"sha"`
+	// MergeStatus is the older, less detailed DetailedMergeStatus.
+	MergeStatus               string    `json:"merge_status"`
+	DetailedMergeStatus       string    `json:"detailed_merge_status"`
+	HasConflicts              bool      `json:"has_conflicts"`
+	MergeWhenPipelineSucceeds bool      `json:"merge_when_pipeline_succeeds"`
+	HeadPipeline              *pipeline `json:"head_pipeline"`
+}
+
+// user is a GitLab user.
+type user struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// mergeRequestPath returns the API path of the merge request iid.
+func (f *Forge) mergeRequestPath(iid int) string {
+	return f.project + "/merge_requests/" + strconv.Itoa(iid)
+}
+
+// ListPullRequests lists the merge requests. GitLab has separate closed and
+// merged states, which are both closed here.
+func (f *Forge) ListPullRequests(ctx context.Context, state, base string) ([]*forge.PullRequest, error) {
+	q := url.Values{
+		"state":    {"all"},
+		"order_by": {"created_at"},
+		"sort":     {"asc"},
+	}
+	if state == "open" {
+		q.Set("state", "opened")
+	}
+	if base != "" {
+		q.Set("target_branch", base)
+	}
+	mrs, err := list[mergeRequest](ctx, f, f.project+"/merge_requests", q)
+	if err != nil {
+		return nil, fmt.Errorf("can't list merge requests: %v %v", f.repo.FullName, err)
+	}
+	var prs []*forge.PullRequest
+	for _, mr := range mrs {
+		pr := fromMergeRequest(mr)
+		if state == "all" || pr.State == state {
+			prs = append(prs, pr)
+		}
+	}
+	return prs, nil
+}
+
+func (f *Forge) GetPullRequest(ctx context.Context, number int) (*forge.PullRequest, error) {
+	mr, err := f.getMergeRequest(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	return fromMergeRequest(mr), nil
+}
+
+func (f *Forge) getMergeRequest(ctx context.Context, number int) (*mergeRequest, error) {
+	var mr mergeRequest
+	_, err := f.do(ctx, "GET", f.mergeRequestPath(number), nil, nil, &mr)
+	if err != nil {
+		return nil, err
+	}
+	return &mr, nil
+}
+
+func (f *Forge) ListFiles(ctx context.Context, number int) ([]string, error) {
+	diffs, err := list[struct {
+		OldPath     string `json:"old_path"`
+		NewPath     string `json:"new_path"`
+		DeletedFile bool   `json:"deleted_file"`
+	}](ctx, f, f.mergeRequestPath(number)+"/diffs", nil)
+	if err != nil {
+		return nil, fmt.Errorf("can't list files: %v %v %v", f.repo.FullName, number, err)
+	}
+	var files []string
+	for _, d := range diffs {
+		if d.DeletedFile {
+			files = append(files, d.OldPath)
+		} else {
+			files = append(files, d.NewPath)
+		}
+	}
+	return files, nil
+}
+
+func (f *Forge) ListCommits(ctx context.Context, number int) ([]*forge.Commit, error) {
+	cs, err := list[struct {
+		ID          string `json:"id"`
+		AuthorName  string `json:"author_name"`
+		AuthorEmail string `json:"author_email"`
+	}](ctx, f, f.mergeRequestPath(number)+"/commits", nil)
+	if err != nil {
+		return nil, fmt.Errorf("can't list commits: %v %v %v", f.repo.FullName, number, err)
+	}
+	var commits []*forge.Commit
+	for _, c := range cs {
+		commits = append(commits, &forge.Commit{SHA: c.ID, AuthorName: c.AuthorName, AuthorEmail: c.AuthorEmail})
+	}
+	return commits, nil
+}
+
+// approvals is the approval state of a merge request.
+type approvals struct {
+	ApprovedBy []struct {
+		User user `json:"user"`
+	} `json:"approved_by"`
+}
+
+// ListReviews returns an APPROVED review for each user that approved the
+// merge request. GitLab has no other kinds of review.
+func (f *Forge) ListReviews(ctx context.Context, number int) ([]*forge.Review, error) {
+	var a approvals
+	_, err := f.do(ctx, "GET", f.mergeRequestPath(number)+"/approvals", nil, nil, &a)
+	if err != nil {
+		return nil, fmt.Errorf("can't list approvals: %v %v %v", f.repo.FullName, number, err)
+	}
+	var reviews []*forge.Review
+	for _, u := range a.ApprovedBy {
+		reviews = append(reviews, &forge.Review{ID: u.User.ID, Author: u.User.Username, State: "APPROVED"})
+	}
+	return reviews, nil
+}
+
+// Approve approves the head commit of the merge request, and adds body as
+// a comment since GitLab approvals have no message.
+func (f *Forge) Approve(ctx context.Context, pr *forge.PullRequest, body string) error {
+	_, err := f.do(ctx, "POST", f.mergeRequestPath(pr.Number)+"/approve", nil, map[string]string{"sha": pr.HeadSHA}, nil)
+	if err != nil {
+		return fmt.Errorf("can't approve %v: %v", pr.Number, err)
+	}
+	if body == "" {
+		return nil
+	}
+	_, err = f.do(ctx, "POST", f.mergeRequestPath(pr.Number)+"/notes", nil, map[string]string{"body": body}, nil)
+	return err
+}
+
+func (f *Forge) EditBody(ctx context.Context, pr *forge.PullRequest, body string) error {
+	_, err := f.do(ctx, "PUT", f.mergeRequestPath(pr.Number), nil, map[string]string{"description": body}, nil)
+	return err
+}
+
+func (f *Forge) AddLabel(ctx context.Context, pr *forge.PullRequest, label string) error {
+	_, err := f.do(ctx, "PUT", f.mergeRequestPath(pr.Number), nil, map[string]string{"add_labels": label}, nil)
+	return err
+}
+
+// mergeRequestBody returns the parameters of a merge using opts. The merge
+// method of the project decides between a merge commit and a fast-forward,
+// so only squash is chosen per merge request.
+func mergeRequestBody(opts forge.MergeOptions) map[string]any {
+	body := map[string]any{
+		"squash": opts.Method == "squash",
+	}
+	if opts.SHA != "" {
+		body["sha"] = opts.SHA
+	}
+	if opts.Title != "" {
+		message := opts.Title
+		if opts.Body != "" {
+			message += "\n\n" + opts.Body
+		}
+		if opts.Method == "squash" {
+			body["squash_commit_message"] = message
+		} else {
+			body["merge_commit_message"] = message
+		}
+	}
+	return body
+}
+
+func (f *Forge) Merge(ctx context.Context, pr *forge.PullRequest, opts forge.MergeOptions) (*forge.MergeResult, error) {
+	var mr mergeRequest
+	_, err := f.do(ctx, "PUT", f.mergeRequestPath(pr.Number)+"/merge", nil, mergeRequestBody(opts), &mr)
+	if err != nil {
+		return nil, err
+	}
+	if mr.State != "merged" {
+		return &forge.MergeResult{Message: fmt.Sprintf("merge request is %v", mr.State)}, nil
+	}
+	return &forge.MergeResult{Merged: true, SHA: mergeSHA(&mr), Message: "merged"}, nil
+}
+
+// EnableAutoMerge sets the merge request to merge when the pipeline
+// succeeds. GitLab would merge a merge request without a running pipeline
+// right away, so those return forge.ErrCanMergeNow.
+func (f *Forge) EnableAutoMerge(ctx context.Context, pr *forge.PullRequest, opts forge.MergeOptions) error {
+	mr, err := f.getMergeRequest(ctx, pr.Number)
+	if err != nil {
+		return err
+	}
+	if mr.HeadPipeline == nil || mr.HeadPipeline.Status == "success" {
+		return forge.ErrCanMergeNow
+	}
+	if opts.SHA == "" {
+		opts.SHA = pr.HeadSHA
+	}
+	body := mergeRequestBody(opts)
+	body["merge_when_pipeline_succeeds"] = true
+	_, err = f.do(ctx, "PUT", f.mergeRequestPath(pr.Number)+"/merge", nil, body, nil)
+	return err
+}
+
+// InMergeQueue returns false, merge trains are not supported.
+func (f *Forge) InMergeQueue(ctx context.Context, pr *forge.PullRequest) (bool, error) {
+	return false, nil
+}
+
+func (f *Forge) Enqueue(ctx context.Context, pr *forge.PullRequest) (int, error) {
+	return 0, forge.ErrNotSupported
+}
+
+// mergeSHA returns the commit that landed the merge request on the target
+// branch.
+func mergeSHA(mr *mergeRequest) string {
+	switch {
+	case mr.MergeCommitSHA != "":
+		return mr.MergeCommitSHA
+	case mr.SquashCommitSHA != "":
+		return mr.SquashCommitSHA
+	}
+	// A fast-forward merge lands the head commit.
+	return mr.SHA
+}
+
+// fromMergeRequest converts a GitLab merge request.
+func fromMergeRequest(mr *mergeRequest) *forge.PullRequest {
+	pr := &forge.PullRequest{
+		Number:         mr.IID,
+		ID:             strconv.FormatInt(mr.ID, 10),
+		Title:          mr.Title,
+		Body:           mr.Description,
+		URL:            mr.WebURL,
+		Author:         mr.Author.Username,
+		Labels:         mr.Labels,
+		CreatedAt:      mr.CreatedAt,
+		State:          "closed",
+		Merged:         mr.State == "merged",
+		HeadRef:        mr.SourceBranch,
+		HeadSHA:        mr.SHA,
+		BaseRef:        mr.TargetBranch,
+		AutoMerge:      mr.MergeWhenPipelineSucceeds,
+		Rebaseable:     boolPtr(!mr.HasConflicts),
+		MergeableState: "unknown",
+	}
+	if mr.State == "opened" {
+		pr.State = "open"
+	}
+	if pr.Merged {
+		pr.MergeCommitSHA = mergeSHA(mr)
+	}
+
+	status := mr.DetailedMergeStatus
+	if status == "" {
+		status = mr.MergeStatus
+	}
+	switch status {
+	case "mergeable", "can_be_merged":
+		pr.Mergeable, pr.MergeableState = boolPtr(true), "clean"
+	case "checking", "unchecked", "preparing", "approvals_syncing", "cannot_be_merged_recheck":
+		// GitLab has not yet computed it.
+	case "conflict", "cannot_be_merged":
+		pr.Mergeable, pr.MergeableState = boolPtr(false), "dirty"
+	case "need_rebase":
+		pr.Mergeable, pr.MergeableState = boolPtr(true), "behind"
+	default:
+		// Like a blocked Github PR, the merge request has no conflicts but
+		// waits for approvals, discussions, the pipeline or the draft status.
+		// The approvals and checks are evaluated separately.
+		pr.Mergeable, pr.MergeableState = boolPtr(true), "blocked"
+	}
+	return pr
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
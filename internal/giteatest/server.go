@@ -0,0 +1,630 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package giteatest is an in-process stand-in for the parts of the Gitea
+// REST API used to merge dependency bot pull requests. It keeps a stateful
+// model of one repository, so tests can run the merge loop against it
+// offline.
+package giteatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	// rebaseCheckbox is the unchecked rebase/retry checkbox that Renovate
+	// adds to the PR body.
+	rebaseCheckbox = "- [ ] <!-- rebase-check -->"
+	// rebaseChecked is the checkbox after it was ticked.
+	rebaseChecked = "- [x] <!-- rebase-check -->"
+	// RebaseBody is a PR body with Renovate's rebase/retry checkbox.
+	RebaseBody = "Renovate update\n\n---\n\n - [ ] <!-- rebase-check -->If you want to rebase/retry this PR, check this box\n"
+)
+
+// PullRequest is the model of one pull request on the server.
+type PullRequest struct {
+	Number  int
+	Title   string
+	Body    string
+	Author  string
+	HeadRef string
+	SHA     string
+	Labels  []string
+	// Files the names of the files the PR changes.
+	Files []string
+	// HasConflicts true when the head branch conflicts with the base.
+	HasConflicts bool
+	// Reviews the reviews of the PR, in order.
+	Reviews []Review
+
+	// State open or closed.
+	State          string
+	Merged         bool
+	MergeCommitSHA string
+	// MergeStyle, MergeTitle and MergeMessage are the merge parameters.
+	MergeStyle   string
+	MergeTitle   string
+	MergeMessage string
+	// MergeWhenChecksSucceed true when the PR is scheduled to merge.
+	MergeWhenChecksSucceed bool
+
+	// Statuses are reported on the head commit, and carried over when
+	// Renovate rebases the PR.
+	Statuses []Status
+	// Rebases counts the rebases Renovate did when asked.
+	Rebases int
+}
+
+// Review is a review of a pull request.
+type Review struct {
+	User string
+	// State APPROVED, REQUEST_CHANGES or COMMENT.
+	State string
+	Body  string
+}
+
+// Status is a commit status, reported by Gitea Actions or external CI.
+type Status struct {
+	Context string
+	// State pending, success, error, failure or warning.
+	State string
+	URL   string
+}
+
+// Server is a Gitea API stand-in for one repository. Its exported fields may
+// be changed by the test before the client is used.
+type Server struct {
+	*httptest.Server
+	t testing.TB
+
+	// BaseURL the url of the REST API on the server.
+	BaseURL string
+	// Owner and Name of the repository.
+	Owner, Name string
+	// DefaultBranch the base branch of the PRs. Defaults to main.
+	DefaultBranch string
+	// Username the user that the client authenticates as.
+	Username string
+	// RequiredContexts the status checks that the default branch protection
+	// requires. There is no branch protection when nil.
+	RequiredContexts []string
+	// RequiredApprovals the approvals that the branch protection requires.
+	RequiredApprovals int
+	// Labels the repository labels.
+	Labels []string
+	// PageSize the most items in a page of a list.
+	PageSize int
+
+	mu       sync.Mutex
+	prs      map[int]*PullRequest
+	nextID   int64
+	requests []string
+}
+
+// NewServer starts a server for the repository owner/name, which is closed
+// at the end of the test.
+func NewServer(t testing.TB, owner, name string) *Server {
+	s := &Server{
+		t:             t,
+		Owner:         owner,
+		Name:          name,
+		DefaultBranch: "main",
+		Username:      "merge-bot",
+		Labels:        []string{"dependencies", "rebase"},
+		PageSize:      50,
+		prs:           map[int]*PullRequest{},
+		nextID:        1000,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	s.BaseURL = s.URL + "/api/v1/"
+	return s
+}
+
+// AddPR adds an open pull request. Missing fields get defaults: a head
+// branch and commit, and the renovate-bot author.
+func (s *Server) AddPR(pr *PullRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pr.HeadRef == "" {
+		pr.HeadRef = fmt.Sprintf("renovate/pr-%d", pr.Number)
+	}
+	if pr.SHA == "" {
+		pr.SHA = s.sha()
+	}
+	if pr.Author == "" {
+		pr.Author = "renovate-bot"
+	}
+	if pr.State == "" {
+		pr.State = "open"
+	}
+	s.prs[pr.Number] = pr
+}
+
+// PR returns a copy of the pull request with number.
+func (s *Server) PR(number int) PullRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.prs[number]
+}
+
+// SetStatus reports a status on the head commit of the pull request with
+// number. A PR scheduled to merge is merged once its checks succeed.
+func (s *Server) SetStatus(number int, status Status) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pr := s.prs[number]
+	found := false
+	for i, st := range pr.Statuses {
+		if st.Context == status.Context {
+			pr.Statuses[i] = status
+			found = true
+		}
+	}
+	if !found {
+		pr.Statuses = append(pr.Statuses, status)
+	}
+	if pr.MergeWhenChecksSucceed && s.combinedState(pr) == "success" && s.mergeable(pr) == "" {
+		s.merge(pr)
+	}
+}
+
+// Requests returns the "METHOD /path" of each request the server received.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// sha returns a new fake commit SHA. Must be called with s.mu held.
+func (s *Server) sha() string {
+	s.nextID++
+	return fmt.Sprintf("%040x", s.nextID)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	prefix := fmt.Sprintf("/api/v1/repos/%v/%v", s.Owner, s.Name)
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		s.notFound(w, r)
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/"), "/")
+	route := r.Method + " " + strings.Join(parts, "/")
+	switch {
+	case route == "GET ":
+		s.write(w, s.repository())
+	case route == "GET pulls":
+		s.listPRs(w, r)
+	case len(parts) >= 2 && parts[0] == "pulls":
+		s.servePR(w, r, parts[1], parts[2:])
+	case route == "GET labels":
+		var labels []map[string]any
+		for i, l := range s.Labels {
+			labels = append(labels, map[string]any{"id": i + 1, "name": l})
+		}
+		page(s, w, r, labels)
+	case r.Method == "POST" && len(parts) == 3 && parts[0] == "issues" && parts[2] == "labels":
+		s.addLabels(w, r, parts[1])
+	case r.Method == "GET" && len(parts) == 3 && parts[0] == "commits" && parts[2] == "status":
+		s.status(w, r, parts[1])
+	case route == "GET branch_protections":
+		s.branchProtections(w, r)
+	default:
+		s.notFound(w, r)
+	}
+}
+
+func (s *Server) servePR(w http.ResponseWriter, r *http.Request, number string, rest []string) {
+	n, _ := strconv.Atoi(number)
+	pr, ok := s.prs[n]
+	if !ok {
+		s.error(w, http.StatusNotFound, "The target couldn't be found.")
+		return
+	}
+	route := r.Method + " " + strings.Join(rest, "/")
+	switch route {
+	case "GET ":
+		s.write(w, s.pullRequest(pr))
+	case "PATCH ":
+		s.editPR(w, r, pr)
+	case "GET files":
+		var files []map[string]any
+		for _, f := range pr.Files {
+			files = append(files, map[string]any{"filename": f, "status": "changed"})
+		}
+		page(s, w, r, files)
+	case "GET commits":
+		page(s, w, r, []map[string]any{{
+			"sha": pr.SHA,
+			"commit": map[string]any{
+				"author": map[string]any{"name": pr.Author, "email": "bot@renovateapp.com"},
+			},
+		}})
+	case "GET reviews":
+		var reviews []map[string]any
+		for i, rv := range pr.Reviews {
+			reviews = append(reviews, s.review(i, rv))
+		}
+		page(s, w, r, reviews)
+	case "POST reviews":
+		s.createReview(w, r, pr)
+	case "POST merge":
+		s.mergePR(w, r, pr)
+	default:
+		s.notFound(w, r)
+	}
+}
+
+func (s *Server) repository() map[string]any {
+	return map[string]any{
+		"id":                  1,
+		"name":                s.Name,
+		"full_name":           s.Owner + "/" + s.Name,
+		"owner":               map[string]any{"id": 1, "login": s.Owner},
+		"default_branch":      s.DefaultBranch,
+		"html_url":            fmt.Sprintf("https://gitea.example.com/%v/%v", s.Owner, s.Name),
+		"allow_merge_commits": true,
+		"allow_rebase":        true,
+		"allow_squash_merge":  true,
+	}
+}
+
+// approvals counts the approvals of pr.
+func (s *Server) approvals(pr *PullRequest) int {
+	n := 0
+	for _, rv := range pr.Reviews {
+		if rv.State == "APPROVED" {
+			n++
+		}
+	}
+	return n
+}
+
+// combinedState computes the combined state of the statuses of pr like
+// Gitea does.
+func (s *Server) combinedState(pr *PullRequest) string {
+	state := ""
+	rank := map[string]int{"": 0, "success": 1, "pending": 2, "warning": 3, "failure": 4, "error": 5}
+	for _, st := range pr.Statuses {
+		if rank[st.State] > rank[state] {
+			state = st.State
+		}
+	}
+	return state
+}
+
+// mergeable returns why the branch protection blocks merging pr, or "".
+func (s *Server) mergeable(pr *PullRequest) string {
+	if pr.HasConflicts {
+		return "Please try again later"
+	}
+	if s.approvals(pr) < s.RequiredApprovals {
+		return "Does not have enough approvals"
+	}
+	for _, c := range s.RequiredContexts {
+		ok := false
+		for _, st := range pr.Statuses {
+			ok = ok || st.Context == c && st.State == "success"
+		}
+		if !ok {
+			return "Not all required status checks successful"
+		}
+	}
+	return ""
+}
+
+func (s *Server) pullRequest(pr *PullRequest) map[string]any {
+	labels := []map[string]any{}
+	for _, l := range pr.Labels {
+		labels = append(labels, map[string]any{"name": l})
+	}
+	res := map[string]any{
+		"id":               pr.Number + 100,
+		"number":           pr.Number,
+		"title":            pr.Title,
+		"body":             pr.Body,
+		"html_url":         fmt.Sprintf("https://gitea.example.com/%v/%v/pulls/%d", s.Owner, s.Name, pr.Number),
+		"user":             map[string]any{"id": 1, "login": pr.Author},
+		"labels":           labels,
+		"created_at":       time.Date(2023, 1, 1, 0, pr.Number, 0, 0, time.UTC),
+		"state":            pr.State,
+		"merged":           pr.Merged,
+		"merge_commit_sha": nil,
+		"mergeable":        pr.State == "open" && !pr.HasConflicts,
+		"head":             map[string]any{"ref": pr.HeadRef, "sha": pr.SHA},
+		"base":             map[string]any{"ref": s.DefaultBranch},
+	}
+	if pr.MergeCommitSHA != "" {
+		res["merge_commit_sha"] = pr.MergeCommitSHA
+	}
+	return res
+}
+
+func (s *Server) review(i int, rv Review) map[string]any {
+	return map[string]any{
+		"id":        i + 1,
+		"user":      map[string]any{"id": i + 1, "login": rv.User},
+		"state":     rv.State,
+		"body":      rv.Body,
+		"dismissed": false,
+	}
+}
+
+func (s *Server) listPRs(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	var numbers []int
+	for n, pr := range s.prs {
+		if state != "" && state != "all" && pr.State != state {
+			continue
+		}
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	var prs []map[string]any
+	for _, n := range numbers {
+		prs = append(prs, s.pullRequest(s.prs[n]))
+	}
+	page(s, w, r, prs)
+}
+
+// editPR updates the body. Ticking the rebase checkbox makes Renovate
+// rebase the PR.
+func (s *Server) editPR(w http.ResponseWriter, r *http.Request, pr *PullRequest) {
+	var req struct {
+		Body *string `json:"body"`
+	}
+	if !s.read(w, r, &req) {
+		return
+	}
+	if req.Body != nil {
+		pr.Body = *req.Body
+		if strings.Contains(pr.Body, rebaseChecked) {
+			s.rebase(pr)
+		}
+	}
+	s.writeStatus(w, http.StatusCreated, s.pullRequest(pr))
+}
+
+// addLabels adds labels by id. Adding the rebase label makes Renovate rebase
+// the PR.
+func (s *Server) addLabels(w http.ResponseWriter, r *http.Request, number string) {
+	n, _ := strconv.Atoi(number)
+	pr, ok := s.prs[n]
+	if !ok {
+		s.error(w, http.StatusNotFound, "The target couldn't be found.")
+		return
+	}
+	var req struct {
+		Labels []int `json:"labels"`
+	}
+	if !s.read(w, r, &req) {
+		return
+	}
+	for _, id := range req.Labels {
+		if id < 1 || id > len(s.Labels) {
+			s.error(w, http.StatusUnprocessableEntity, fmt.Sprintf("label %d does not exist", id))
+			return
+		}
+		if l := s.Labels[id-1]; l == "rebase" {
+			s.rebase(pr)
+		} else {
+			pr.Labels = append(pr.Labels, l)
+		}
+	}
+	s.write(w, []map[string]any{})
+}
+
+// rebase does what Renovate does when asked to rebase: pushes a new head
+// commit that is up to date with the base branch, and resets the checkbox.
+// The statuses are reported again on the new commit.
+func (s *Server) rebase(pr *PullRequest) {
+	pr.SHA = s.sha()
+	pr.Body = strings.Replace(pr.Body, rebaseChecked, rebaseCheckbox, 1)
+	pr.HasConflicts = false
+	pr.Rebases++
+}
+
+func (s *Server) createReview(w http.ResponseWriter, r *http.Request, pr *PullRequest) {
+	var req struct {
+		Event    string `json:"event"`
+		Body     string `json:"body"`
+		CommitID string `json:"commit_id"`
+	}
+	if !s.read(w, r, &req) {
+		return
+	}
+	if req.CommitID != "" && req.CommitID != pr.SHA {
+		s.error(w, http.StatusUnprocessableEntity, "commit_id is not the head of the pull request")
+		return
+	}
+	state := req.Event
+	if state == "" {
+		state = "PENDING"
+	}
+	if state == "APPROVED" && pr.Author == s.Username {
+		s.error(w, http.StatusUnprocessableEntity, "approve your own pull is not allowed")
+		return
+	}
+	pr.Reviews = append(pr.Reviews, Review{User: s.Username, State: state, Body: req.Body})
+	s.write(w, s.review(len(pr.Reviews)-1, pr.Reviews[len(pr.Reviews)-1]))
+}
+
+func (s *Server) mergePR(w http.ResponseWriter, r *http.Request, pr *PullRequest) {
+	var req struct {
+		Do                     string `json:"Do"`
+		MergeTitleField        string `json:"MergeTitleField"`
+		MergeMessageField      string `json:"MergeMessageField"`
+		HeadCommitID           string `json:"head_commit_id"`
+		MergeWhenChecksSucceed bool   `json:"merge_when_checks_succeed"`
+	}
+	if !s.read(w, r, &req) {
+		return
+	}
+	if pr.State != "open" {
+		s.error(w, http.StatusMethodNotAllowed, "The PR is already merged")
+		return
+	}
+	if req.HeadCommitID != "" && req.HeadCommitID != pr.SHA {
+		s.error(w, http.StatusConflict, "head out of date")
+		return
+	}
+	switch req.Do {
+	case "merge", "squash", "rebase":
+	default:
+		s.error(w, http.StatusUnprocessableEntity, fmt.Sprintf("unknown merge style %q", req.Do))
+		return
+	}
+	pr.MergeStyle = req.Do
+	pr.MergeTitle = req.MergeTitleField
+	pr.MergeMessage = req.MergeMessageField
+	if req.MergeWhenChecksSucceed && s.combinedState(pr) != "success" {
+		pr.MergeWhenChecksSucceed = true
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	if reason := s.mergeable(pr); reason != "" {
+		s.error(w, http.StatusMethodNotAllowed, reason)
+		return
+	}
+	s.merge(pr)
+	w.WriteHeader(http.StatusOK)
+}
+
+// merge merges pr. Must be called with s.mu held.
+func (s *Server) merge(pr *PullRequest) {
+	pr.State = "closed"
+	pr.Merged = true
+	pr.MergeCommitSHA = s.sha()
+	pr.MergeWhenChecksSucceed = false
+}
+
+// prForSHA returns the pull request with the head commit sha, or nil.
+func (s *Server) prForSHA(sha string) *PullRequest {
+	for _, pr := range s.prs {
+		if pr.SHA == sha {
+			return pr
+		}
+	}
+	return nil
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request, sha string) {
+	res := map[string]any{"sha": sha, "state": "", "statuses": []map[string]any{}}
+	if pr := s.prForSHA(sha); pr != nil {
+		var statuses []map[string]any
+		for _, st := range pr.Statuses {
+			statuses = append(statuses, map[string]any{
+				"context":    st.Context,
+				"status":     st.State,
+				"target_url": st.URL,
+			})
+		}
+		res["state"] = s.combinedState(pr)
+		res["statuses"] = statuses
+	}
+	s.write(w, res)
+}
+
+func (s *Server) branchProtections(w http.ResponseWriter, r *http.Request) {
+	res := []map[string]any{}
+	if s.RequiredContexts != nil {
+		res = append(res, map[string]any{
+			"rule_name":             s.DefaultBranch,
+			"enable_status_check":   true,
+			"status_check_contexts": s.RequiredContexts,
+			"required_approvals":    s.RequiredApprovals,
+		})
+	}
+	s.write(w, res)
+}
+
+// page writes the page of items requested by the page and limit query
+// parameters, with the Link header that Gitea sends.
+func page[T any](s *Server, w http.ResponseWriter, r *http.Request, items []T) {
+	q := r.URL.Query()
+	size, _ := strconv.Atoi(q.Get("limit"))
+	if size <= 0 || size > s.PageSize {
+		size = s.PageSize
+	}
+	n, _ := strconv.Atoi(q.Get("page"))
+	if n < 1 {
+		n = 1
+	}
+	start := (n - 1) * size
+	if start > len(items) {
+		start = len(items)
+	}
+	end := start + size
+	if end >= len(items) {
+		end = len(items)
+	} else {
+		next := *r.URL
+		q.Set("page", strconv.Itoa(n+1))
+		next.RawQuery = q.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<%v%v>; rel="next"`, s.URL, next.String()))
+	}
+	res := append([]T{}, items[start:end]...)
+	s.write(w, res)
+}
+
+func (s *Server) read(w http.ResponseWriter, r *http.Request, v any) bool {
+	b, err := io.ReadAll(r.Body)
+	if err == nil && len(b) > 0 {
+		err = json.Unmarshal(b, v)
+	}
+	if err != nil {
+		s.error(w, http.StatusBadRequest, fmt.Sprintf("bad request: %v", err))
+		return false
+	}
+	return true
+}
+
+func (s *Server) write(w http.ResponseWriter, v any) {
+	s.writeStatus(w, http.StatusOK, v)
+}
+
+func (s *Server) writeStatus(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.t.Errorf("can't write response: %v", err)
+	}
+}
+
+func (s *Server) error(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// notFound responds with 404 and fails the test, since the code under test
+// used an API that the stand-in does not know.
+func (s *Server) notFound(w http.ResponseWriter, r *http.Request) {
+	s.t.Errorf("giteatest: unexpected request %v %v", r.Method, r.URL)
+	s.error(w, http.StatusNotFound, "The target couldn't be found.")
+}
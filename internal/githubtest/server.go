@@ -0,0 +1,608 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package githubtest is an in-process fake of the parts of the Github REST
+// API used to merge dependency bot PRs. It keeps a stateful model of one
+// repository, so tests can run the merge loop against it offline.
+package githubtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-github/v51/github"
+)
+
+const (
+	// rebaseCheckbox is the unchecked rebase/retry checkbox that Renovate
+	// adds to the PR body.
+	rebaseCheckbox = "- [ ] <!-- rebase-check -->"
+	// rebaseChecked is the checkbox after it was ticked.
+	rebaseChecked = "- [x] <!-- rebase-check -->"
+	// RebaseBody is a PR body with Renovate's rebase/retry checkbox.
+	RebaseBody = "Renovate update\n\n---\n\n - [ ] <!-- rebase-check -->If you want to rebase/retry this PR, check this box\n"
+)
+
+// PullRequest is the model of one PR on the fake server.
+type PullRequest struct {
+	Number  int
+	Title   string
+	Body    string
+	Author  string
+	Branch  string
+	HeadSHA string
+	Labels  []string
+	// Files the names of the files the PR changes.
+	Files []string
+	// Mergeable nil while Github computes whether the PR is mergeable.
+	Mergeable *bool
+	// MergeableState like clean, behind or dirty.
+	MergeableState string
+	// Rebaseable false when the PR can't be merged with the rebase method.
+	Rebaseable bool
+
+	State          string
+	Merged         bool
+	MergeCommitSHA string
+	MergeMethod    string
+	// Reviews the states of the reviews, like APPROVED.
+	Reviews []string
+
+	// Statuses and CheckRuns are reported on the head commit, and carried
+	// over when Renovate rebases the PR.
+	Statuses     []Status
+	CheckRuns    []CheckRun
+	WorkflowRuns []*WorkflowRun
+	// Rebases counts the rebases Renovate did when asked.
+	Rebases int
+}
+
+// Status is a commit status.
+type Status struct {
+	Context string
+	State   string
+	URL     string
+}
+
+// CheckRun is a check run.
+type CheckRun struct {
+	Name       string
+	AppID      int64
+	Status     string
+	Conclusion string
+	URL        string
+}
+
+// WorkflowRun is an Actions workflow run. Runs with the action_required
+// status wait for approval.
+type WorkflowRun struct {
+	ID     int64
+	Status string
+	// Approved true after the run was approved.
+	Approved bool
+	// CheckRuns are reported on the PR when the run is approved.
+	CheckRuns []CheckRun
+}
+
+// Server is a fake Github API server for one repository. Its fields may be
+// changed by the test before the client is used.
+type Server struct {
+	*httptest.Server
+	t testing.TB
+
+	// Client is a Github client that sends its requests to the server.
+	Client *github.Client
+	// Owner and Name of the repository.
+	Owner, Name string
+	// DefaultBranch the base branch of the PRs. Defaults to main.
+	DefaultBranch string
+
+	mu sync.Mutex
+	// ProtectedChecks the contexts required by classic branch protection,
+	// nil when the branch is not protected.
+	ProtectedChecks []string
+	// RulesetChecks the contexts required by the repository rulesets.
+	RulesetChecks []string
+	prs           map[int]*PullRequest
+	nextID        int64
+	requests      []string
+}
+
+// NewServer starts a fake server for the repository owner/name, which is
+// closed at the end of the test.
+func NewServer(t testing.TB, owner, name string) *Server {
+	s := &Server{
+		t:             t,
+		Owner:         owner,
+		Name:          name,
+		DefaultBranch: "main",
+		prs:           map[int]*PullRequest{},
+		nextID:        1000,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	s.Client = github.NewClient(nil)
+	s.Client.BaseURL, _ = url.Parse(s.URL + "/")
+	return s
+}
+
+// AddPR adds an open PR. Missing fields get defaults: a head branch and
+// commit, the renovate[bot] author, and a clean mergeable state.
+func (s *Server) AddPR(pr *PullRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pr.Branch == "" {
+		pr.Branch = fmt.Sprintf("renovate/pr-%d", pr.Number)
+	}
+	if pr.HeadSHA == "" {
+		pr.HeadSHA = s.sha()
+	}
+	if pr.Author == "" {
+		pr.Author = "renovate[bot]"
+	}
+	if pr.State == "" {
+		pr.State = "open"
+	}
+	if pr.Mergeable == nil && pr.MergeableState == "" {
+		pr.Mergeable = github.Bool(true)
+		pr.MergeableState = "clean"
+		pr.Rebaseable = true
+	}
+	for _, run := range pr.WorkflowRuns {
+		if run.ID == 0 {
+			s.nextID++
+			run.ID = s.nextID
+		}
+	}
+	s.prs[pr.Number] = pr
+}
+
+// PR returns a copy of the PR with number.
+func (s *Server) PR(number int) PullRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.prs[number]
+}
+
+// Requests returns the "METHOD /path" of each request the server received.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// sha returns a new fake commit SHA. Must be called with s.mu held.
+func (s *Server) sha() string {
+	s.nextID++
+	return fmt.Sprintf("%040x", s.nextID)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	prefix := fmt.Sprintf("/repos/%v/%v", s.Owner, s.Name)
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		s.notFound(w, r)
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/"), "/")
+	route := r.Method + " " + strings.Join(parts, "/")
+	switch {
+	case route == "GET ":
+		s.write(w, s.repository())
+	case route == "GET pulls":
+		s.listPrs(w, r)
+	case len(parts) >= 2 && parts[0] == "pulls":
+		s.servePr(w, r, parts[1], parts[2:])
+	case r.Method == "POST" && len(parts) == 3 && parts[0] == "issues" && parts[2] == "labels":
+		s.addLabels(w, r, parts[1])
+	case r.Method == "GET" && len(parts) == 3 && parts[0] == "commits" && parts[2] == "status":
+		s.combinedStatus(w, parts[1])
+	case r.Method == "GET" && len(parts) == 3 && parts[0] == "commits" && parts[2] == "check-runs":
+		s.checkRuns(w, parts[1])
+	case route == "GET actions/runs":
+		s.workflowRuns(w, r)
+	case r.Method == "POST" && len(parts) == 4 && parts[0] == "actions" && parts[1] == "runs" && parts[3] == "approve":
+		s.approveRun(w, r, parts[2])
+	case r.Method == "GET" && strings.HasPrefix(strings.Join(parts, "/"), "branches/") && strings.HasSuffix(r.URL.Path, "/protection/required_status_checks"):
+		s.requiredStatusChecks(w, r)
+	case r.Method == "GET" && len(parts) == 3 && parts[0] == "rules" && parts[1] == "branches":
+		s.rules(w)
+	default:
+		s.notFound(w, r)
+	}
+}
+
+func (s *Server) servePr(w http.ResponseWriter, r *http.Request, number string, rest []string) {
+	n, _ := strconv.Atoi(number)
+	pr, ok := s.prs[n]
+	if !ok {
+		s.error(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	route := r.Method + " " + strings.Join(rest, "/")
+	switch {
+	case route == "GET ":
+		s.write(w, s.pullRequest(pr))
+	case route == "PATCH ":
+		s.editPr(w, r, pr)
+	case route == "GET files":
+		var files []*github.CommitFile
+		for _, f := range pr.Files {
+			files = append(files, &github.CommitFile{Filename: github.String(f)})
+		}
+		s.write(w, files)
+	case route == "GET commits":
+		s.write(w, []*github.RepositoryCommit{{
+			SHA:    github.String(pr.HeadSHA),
+			Author: &github.User{Login: github.String(pr.Author)},
+			Commit: &github.Commit{Author: &github.CommitAuthor{
+				Name:  github.String(pr.Author),
+				Email: github.String("bot@renovateapp.com"),
+			}},
+		}})
+	case route == "GET reviews":
+		var reviews []*github.PullRequestReview
+		for i, state := range pr.Reviews {
+			reviews = append(reviews, &github.PullRequestReview{ID: github.Int64(int64(i + 1)), State: github.String(state)})
+		}
+		s.write(w, reviews)
+	case route == "POST reviews":
+		var req github.PullRequestReviewRequest
+		if !s.read(w, r, &req) {
+			return
+		}
+		state := "COMMENTED"
+		if req.GetEvent() == "APPROVE" {
+			state = "APPROVED"
+		}
+		pr.Reviews = append(pr.Reviews, state)
+		s.write(w, &github.PullRequestReview{ID: github.Int64(int64(len(pr.Reviews))), State: github.String(state)})
+	case r.Method == "POST" && len(rest) == 3 && rest[0] == "reviews" && rest[2] == "events":
+		s.error(w, http.StatusUnprocessableEntity, "Can not submit a review that is not pending")
+	case route == "PUT merge":
+		s.mergePr(w, r, pr)
+	default:
+		s.notFound(w, r)
+	}
+}
+
+func (s *Server) repository() *github.Repository {
+	return &github.Repository{
+		ID:               github.Int64(1),
+		NodeID:           github.String("R_1"),
+		Name:             github.String(s.Name),
+		FullName:         github.String(s.Owner + "/" + s.Name),
+		Owner:            &github.User{Login: github.String(s.Owner)},
+		DefaultBranch:    github.String(s.DefaultBranch),
+		HTMLURL:          github.String(fmt.Sprintf("https://github.com/%v/%v", s.Owner, s.Name)),
+		AllowSquashMerge: github.Bool(true),
+		AllowMergeCommit: github.Bool(true),
+		AllowRebaseMerge: github.Bool(true),
+	}
+}
+
+func (s *Server) pullRequest(pr *PullRequest) *github.PullRequest {
+	res := &github.PullRequest{
+		Number:         github.Int(pr.Number),
+		NodeID:         github.String(fmt.Sprintf("PR_%d", pr.Number)),
+		Title:          github.String(pr.Title),
+		Body:           github.String(pr.Body),
+		State:          github.String(pr.State),
+		HTMLURL:        github.String(fmt.Sprintf("https://github.com/%v/%v/pull/%d", s.Owner, s.Name, pr.Number)),
+		User:           &github.User{Login: github.String(pr.Author)},
+		Head:           &github.PullRequestBranch{Ref: github.String(pr.Branch), SHA: github.String(pr.HeadSHA)},
+		Base:           &github.PullRequestBranch{Ref: github.String(s.DefaultBranch)},
+		Mergeable:      pr.Mergeable,
+		MergeableState: github.String(pr.MergeableState),
+		Rebaseable:     github.Bool(pr.Rebaseable),
+		Merged:         github.Bool(pr.Merged),
+	}
+	if pr.MergeCommitSHA != "" {
+		res.MergeCommitSHA = github.String(pr.MergeCommitSHA)
+	}
+	for _, l := range pr.Labels {
+		res.Labels = append(res.Labels, &github.Label{Name: github.String(l)})
+	}
+	return res
+}
+
+// listPrs lists the PRs in the order of the sort and direction params. The
+// PR numbers follow the order the PRs were created in, and like Github the
+// list is newest first unless the direction is asc.
+func (s *Server) listPrs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var numbers []int
+	for n, pr := range s.prs {
+		if q.Get("state") != "" && q.Get("state") != "all" && pr.State != q.Get("state") {
+			continue
+		}
+		if q.Get("base") != "" && q.Get("base") != s.DefaultBranch {
+			continue
+		}
+		numbers = append(numbers, n)
+	}
+	if by := q.Get("sort"); by != "" && by != "created" {
+		s.error(w, http.StatusUnprocessableEntity, fmt.Sprintf("Sort %q is not supported", by))
+		return
+	}
+	if q.Get("direction") == "asc" {
+		sort.Ints(numbers)
+	} else {
+		sort.Sort(sort.Reverse(sort.IntSlice(numbers)))
+	}
+	prs := []*github.PullRequest{}
+	for _, n := range numbers {
+		prs = append(prs, s.pullRequest(s.prs[n]))
+	}
+	s.write(w, prs)
+}
+
+// editPr updates the PR body. Ticking the rebase checkbox makes Renovate
+// rebase the PR.
+func (s *Server) editPr(w http.ResponseWriter, r *http.Request, pr *PullRequest) {
+	var req github.PullRequest
+	if !s.read(w, r, &req) {
+		return
+	}
+	if req.Body != nil {
+		pr.Body = req.GetBody()
+	}
+	if strings.Contains(pr.Body, rebaseChecked) {
+		s.rebase(pr)
+	}
+	s.write(w, s.pullRequest(pr))
+}
+
+// addLabels adds labels to a PR. Adding the rebase label makes Renovate
+// rebase the PR.
+func (s *Server) addLabels(w http.ResponseWriter, r *http.Request, number string) {
+	n, _ := strconv.Atoi(number)
+	pr, ok := s.prs[n]
+	if !ok {
+		s.error(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	var labels []string
+	if !s.read(w, r, &labels) {
+		return
+	}
+	for _, l := range labels {
+		if l == "rebase" {
+			s.rebase(pr)
+			continue
+		}
+		pr.Labels = append(pr.Labels, l)
+	}
+	var res []*github.Label
+	for _, l := range pr.Labels {
+		res = append(res, &github.Label{Name: github.String(l)})
+	}
+	s.write(w, res)
+}
+
+// rebase does what Renovate does when asked to rebase: pushes a new head
+// commit that is up to date with the base branch, and resets the checkbox.
+func (s *Server) rebase(pr *PullRequest) {
+	pr.HeadSHA = s.sha()
+	pr.Body = strings.Replace(pr.Body, rebaseChecked, rebaseCheckbox, 1)
+	pr.Mergeable = github.Bool(true)
+	pr.MergeableState = "clean"
+	pr.Rebaseable = true
+	pr.Rebases++
+}
+
+func (s *Server) mergePr(w http.ResponseWriter, r *http.Request, pr *PullRequest) {
+	var req struct {
+		CommitMessage string `json:"commit_message"`
+		CommitTitle   string `json:"commit_title"`
+		MergeMethod   string `json:"merge_method"`
+		SHA           string `json:"sha"`
+	}
+	if !s.read(w, r, &req) {
+		return
+	}
+	switch {
+	case pr.State != "open":
+		s.error(w, http.StatusMethodNotAllowed, "Pull Request is not open")
+		return
+	case req.SHA != "" && req.SHA != pr.HeadSHA:
+		s.error(w, http.StatusConflict, "Head branch was modified. Review and try the merge again.")
+		return
+	case !pr.Rebaseable && req.MergeMethod == "rebase":
+		s.error(w, http.StatusMethodNotAllowed, "This branch can't be rebased")
+		return
+	case pr.Mergeable == nil || !*pr.Mergeable:
+		s.error(w, http.StatusMethodNotAllowed, "Pull Request is not mergeable")
+		return
+	}
+	pr.State = "closed"
+	pr.Merged = true
+	pr.MergeMethod = req.MergeMethod
+	pr.MergeCommitSHA = s.sha()
+	s.write(w, &github.PullRequestMergeResult{
+		SHA:     github.String(pr.MergeCommitSHA),
+		Merged:  github.Bool(true),
+		Message: github.String("Pull Request successfully merged"),
+	})
+}
+
+// prForSHA returns the open PR with the head commit sha, or nil.
+func (s *Server) prForSHA(sha string) *PullRequest {
+	for _, pr := range s.prs {
+		if pr.HeadSHA == sha {
+			return pr
+		}
+	}
+	return nil
+}
+
+func (s *Server) combinedStatus(w http.ResponseWriter, sha string) {
+	res := &github.CombinedStatus{SHA: github.String(sha), State: github.String("pending")}
+	if pr := s.prForSHA(sha); pr != nil {
+		for _, st := range pr.Statuses {
+			res.Statuses = append(res.Statuses, &github.RepoStatus{
+				Context:   github.String(st.Context),
+				State:     github.String(st.State),
+				TargetURL: github.String(st.URL),
+			})
+		}
+	}
+	res.TotalCount = github.Int(len(res.Statuses))
+	s.write(w, res)
+}
+
+func (s *Server) checkRuns(w http.ResponseWriter, sha string) {
+	res := &github.ListCheckRunsResults{}
+	if pr := s.prForSHA(sha); pr != nil {
+		for i, c := range pr.CheckRuns {
+			run := &github.CheckRun{
+				ID:      github.Int64(int64(i + 1)),
+				Name:    github.String(c.Name),
+				HeadSHA: github.String(sha),
+				Status:  github.String(c.Status),
+				HTMLURL: github.String(c.URL),
+				App:     &github.App{ID: github.Int64(c.AppID)},
+			}
+			if c.Conclusion != "" {
+				run.Conclusion = github.String(c.Conclusion)
+			}
+			res.CheckRuns = append(res.CheckRuns, run)
+		}
+	}
+	res.Total = github.Int(len(res.CheckRuns))
+	s.write(w, res)
+}
+
+func (s *Server) workflowRuns(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	res := &github.WorkflowRuns{WorkflowRuns: []*github.WorkflowRun{}}
+	for _, pr := range s.prs {
+		if q.Get("branch") != "" && q.Get("branch") != pr.Branch {
+			continue
+		}
+		for _, run := range pr.WorkflowRuns {
+			if q.Get("status") != "" && q.Get("status") != run.Status {
+				continue
+			}
+			res.WorkflowRuns = append(res.WorkflowRuns, &github.WorkflowRun{
+				ID:         github.Int64(run.ID),
+				URL:        github.String(fmt.Sprintf("%v/repos/%v/%v/actions/runs/%d", s.URL, s.Owner, s.Name, run.ID)),
+				HeadBranch: github.String(pr.Branch),
+				HeadSHA:    github.String(pr.HeadSHA),
+				Event:      github.String("pull_request"),
+				Status:     github.String(run.Status),
+			})
+		}
+	}
+	res.TotalCount = github.Int(len(res.WorkflowRuns))
+	s.write(w, res)
+}
+
+// approveRun approves a workflow run, which then reports its check runs.
+func (s *Server) approveRun(w http.ResponseWriter, r *http.Request, id string) {
+	runID, _ := strconv.ParseInt(id, 10, 64)
+	for _, pr := range s.prs {
+		for _, run := range pr.WorkflowRuns {
+			if run.ID != runID {
+				continue
+			}
+			if run.Status != "action_required" {
+				s.error(w, http.StatusForbidden, "This run is not waiting for approval")
+				return
+			}
+			run.Status = "completed"
+			run.Approved = true
+			pr.CheckRuns = append(pr.CheckRuns, run.CheckRuns...)
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, "{}")
+			return
+		}
+	}
+	s.error(w, http.StatusNotFound, "Not Found")
+}
+
+func (s *Server) requiredStatusChecks(w http.ResponseWriter, r *http.Request) {
+	if s.ProtectedChecks == nil {
+		s.error(w, http.StatusNotFound, "Branch not protected")
+		return
+	}
+	res := &github.RequiredStatusChecks{Checks: []*github.RequiredStatusCheck{}}
+	for _, c := range s.ProtectedChecks {
+		res.Checks = append(res.Checks, &github.RequiredStatusCheck{Context: c})
+		res.Contexts = append(res.Contexts, c)
+	}
+	s.write(w, res)
+}
+
+func (s *Server) rules(w http.ResponseWriter) {
+	type check struct {
+		Context string `json:"context"`
+	}
+	rules := []map[string]any{}
+	if len(s.RulesetChecks) > 0 {
+		var checks []check
+		for _, c := range s.RulesetChecks {
+			checks = append(checks, check{Context: c})
+		}
+		rules = append(rules, map[string]any{
+			"type":       "required_status_checks",
+			"parameters": map[string]any{"required_status_checks": checks},
+		})
+	}
+	s.write(w, rules)
+}
+
+func (s *Server) read(w http.ResponseWriter, r *http.Request, v any) bool {
+	b, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(b, v)
+	}
+	if err != nil {
+		s.error(w, http.StatusBadRequest, fmt.Sprintf("Problems parsing JSON: %v", err))
+		return false
+	}
+	return true
+}
+
+func (s *Server) write(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.t.Errorf("can't write response: %v", err)
+	}
+}
+
+func (s *Server) error(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// notFound responds with 404 and fails the test, since the code under test
+// used an API that the fake does not know.
+func (s *Server) notFound(w http.ResponseWriter, r *http.Request) {
+	s.t.Errorf("githubtest: unexpected request %v %v", r.Method, r.URL)
+	s.error(w, http.StatusNotFound, "Not Found")
+}
@@ -0,0 +1,596 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gitlabtest is an in-process stand-in for the parts of the GitLab
+// REST API used to merge dependency bot merge requests. It keeps a stateful
+// model of one project, so tests can run the merge loop against it offline.
+package gitlabtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	// rebaseCheckbox is the unchecked rebase/retry checkbox that Renovate
+	// adds to the merge request description.
+	rebaseCheckbox = "- [ ] <!-- rebase-check -->"
+	// rebaseChecked is the checkbox after it was ticked.
+	rebaseChecked = "- [x] <!-- rebase-check -->"
+	// RebaseBody is a description with Renovate's rebase/retry checkbox.
+	RebaseBody = "Renovate update\n\n---\n\n - [ ] <!-- rebase-check -->If you want to rebase/retry this MR, check this box\n"
+)
+
+// MergeRequest is the model of one merge request on the server.
+type MergeRequest struct {
+	IID          int
+	Title        string
+	Description  string
+	Author       string
+	SourceBranch string
+	SHA          string
+	Labels       []string
+	// Files the names of the files the merge request changes.
+	Files []string
+	// NeedRebase true when the source branch is behind the target branch.
+	NeedRebase bool
+	// HasConflicts true when the source branch conflicts with the target.
+	HasConflicts bool
+	// ApprovalsRequired the number of approvals the approval rules require.
+	ApprovalsRequired int
+	// Approvals the usernames that approved the merge request.
+	Approvals []string
+	// Notes the comments added to the merge request.
+	Notes []string
+
+	// State opened, closed or merged.
+	State                     string
+	MergeCommitSHA            string
+	Squash                    bool
+	CommitMessage             string
+	MergeWhenPipelineSucceeds bool
+
+	// Statuses are reported on the head commit, and carried over when
+	// Renovate rebases the merge request.
+	Statuses []Status
+	// Pipeline the status of the latest pipeline on the head commit, like
+	// running or success. Empty when there is no pipeline.
+	Pipeline string
+	// Rebases counts the rebases Renovate did when asked.
+	Rebases int
+}
+
+// Status is a commit status, reported by a pipeline job or external CI.
+type Status struct {
+	Name         string
+	Status       string
+	URL          string
+	AllowFailure bool
+}
+
+// Server is a GitLab API stand-in for one project. Its exported fields may
+// be changed by the test before the client is used.
+type Server struct {
+	*httptest.Server
+	t testing.TB
+
+	// BaseURL the url of the REST API on the server.
+	BaseURL string
+	// Owner the group path and Name the path of the project.
+	Owner, Name string
+	// DefaultBranch the target branch of the merge requests. Defaults to
+	// main.
+	DefaultBranch string
+	// Username the user that the client authenticates as.
+	Username string
+	// OnlyAllowMergeIfPipelineSucceeds the project merge check.
+	OnlyAllowMergeIfPipelineSucceeds bool
+	// MergeMethod merge, rebase_merge or ff. Defaults to merge.
+	MergeMethod string
+	// PageSize the most items in a page of a list.
+	PageSize int
+
+	mu       sync.Mutex
+	mrs      map[int]*MergeRequest
+	nextID   int64
+	requests []string
+}
+
+// NewServer starts a server for the project owner/name, which is closed at
+// the end of the test.
+func NewServer(t testing.TB, owner, name string) *Server {
+	s := &Server{
+		t:             t,
+		Owner:         owner,
+		Name:          name,
+		DefaultBranch: "main",
+		Username:      "merge-bot",
+		MergeMethod:   "merge",
+		PageSize:      100,
+		mrs:           map[int]*MergeRequest{},
+		nextID:        1000,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	s.BaseURL = s.URL + "/api/v4/"
+	return s
+}
+
+// AddMR adds an open merge request. Missing fields get defaults: a source
+// branch and commit, and the renovate-bot author.
+func (s *Server) AddMR(mr *MergeRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if mr.SourceBranch == "" {
+		mr.SourceBranch = fmt.Sprintf("renovate/mr-%d", mr.IID)
+	}
+	if mr.SHA == "" {
+		mr.SHA = s.sha()
+	}
+	if mr.Author == "" {
+		mr.Author = "renovate-bot"
+	}
+	if mr.State == "" {
+		mr.State = "opened"
+	}
+	s.mrs[mr.IID] = mr
+}
+
+// MR returns a copy of the merge request with iid.
+func (s *Server) MR(iid int) MergeRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.mrs[iid]
+}
+
+// SetPipeline sets the status of the pipeline of the merge request with
+// iid. A successful pipeline merges the merge request when it is set to
+// merge when the pipeline succeeds, and a failed one turns that off.
+func (s *Server) SetPipeline(iid int, status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mr := s.mrs[iid]
+	mr.Pipeline = status
+	if !mr.MergeWhenPipelineSucceeds {
+		return
+	}
+	switch status {
+	case "success":
+		if s.detailedMergeStatus(mr) == "mergeable" {
+			s.merge(mr)
+		}
+	case "failed", "canceled":
+		mr.MergeWhenPipelineSucceeds = false
+	}
+}
+
+// Requests returns the "METHOD /path" of each request the server received.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// sha returns a new fake commit SHA. Must be called with s.mu held.
+func (s *Server) sha() string {
+	s.nextID++
+	return fmt.Sprintf("%040x", s.nextID)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	// The project id is the escaped path, which the server has decoded.
+	prefix := fmt.Sprintf("/api/v4/projects/%v/%v", s.Owner, s.Name)
+	if !strings.HasPrefix(r.URL.Path, prefix) || !strings.Contains(r.URL.RawPath, "%2F") {
+		s.notFound(w, r)
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/"), "/")
+	route := r.Method + " " + strings.Join(parts, "/")
+	switch {
+	case route == "GET ":
+		s.write(w, s.project())
+	case route == "GET merge_requests":
+		s.listMRs(w, r)
+	case len(parts) >= 2 && parts[0] == "merge_requests":
+		s.serveMR(w, r, parts[1], parts[2:])
+	case r.Method == "GET" && len(parts) == 4 && parts[0] == "repository" && parts[1] == "commits" && parts[3] == "statuses":
+		s.statuses(w, r, parts[2])
+	case route == "GET pipelines":
+		s.pipelines(w, r)
+	default:
+		s.notFound(w, r)
+	}
+}
+
+func (s *Server) serveMR(w http.ResponseWriter, r *http.Request, iid string, rest []string) {
+	n, _ := strconv.Atoi(iid)
+	mr, ok := s.mrs[n]
+	if !ok {
+		s.error(w, http.StatusNotFound, "404 Not found")
+		return
+	}
+	route := r.Method + " " + strings.Join(rest, "/")
+	switch route {
+	case "GET ":
+		s.write(w, s.mergeRequest(mr, true))
+	case "PUT ":
+		s.editMR(w, r, mr)
+	case "GET diffs":
+		var diffs []map[string]any
+		for _, f := range mr.Files {
+			diffs = append(diffs, map[string]any{"old_path": f, "new_path": f})
+		}
+		page(s, w, r, diffs)
+	case "GET commits":
+		page(s, w, r, []map[string]any{{
+			"id":           mr.SHA,
+			"author_name":  mr.Author,
+			"author_email": "bot@renovateapp.com",
+		}})
+	case "GET approvals":
+		s.write(w, s.approvals(mr))
+	case "POST approve":
+		s.approve(w, r, mr)
+	case "POST notes":
+		var req struct {
+			Body string `json:"body"`
+		}
+		if !s.read(w, r, &req) {
+			return
+		}
+		mr.Notes = append(mr.Notes, req.Body)
+		s.writeStatus(w, http.StatusCreated, map[string]any{"id": len(mr.Notes), "body": req.Body})
+	case "PUT merge":
+		s.mergeMR(w, r, mr)
+	default:
+		s.notFound(w, r)
+	}
+}
+
+func (s *Server) project() map[string]any {
+	return map[string]any{
+		"id":                                    1,
+		"path":                                  s.Name,
+		"path_with_namespace":                   s.Owner + "/" + s.Name,
+		"namespace":                             map[string]any{"full_path": s.Owner},
+		"default_branch":                        s.DefaultBranch,
+		"web_url":                               fmt.Sprintf("https://gitlab.example.com/%v/%v", s.Owner, s.Name),
+		"merge_method":                          s.MergeMethod,
+		"squash_option":                         "default_off",
+		"only_allow_merge_if_pipeline_succeeds": s.OnlyAllowMergeIfPipelineSucceeds,
+	}
+}
+
+// detailedMergeStatus computes the merge status of mr like GitLab does.
+func (s *Server) detailedMergeStatus(mr *MergeRequest) string {
+	switch {
+	case mr.State != "opened":
+		return "not_open"
+	case mr.HasConflicts:
+		return "conflict"
+	case len(mr.Approvals) < mr.ApprovalsRequired:
+		return "not_approved"
+	case s.OnlyAllowMergeIfPipelineSucceeds && mr.Pipeline != "success":
+		if mr.Pipeline == "running" || mr.Pipeline == "pending" {
+			return "ci_still_running"
+		}
+		return "ci_must_pass"
+	case mr.NeedRebase && s.MergeMethod != "merge":
+		return "need_rebase"
+	}
+	return "mergeable"
+}
+
+// mergeRequest returns the API representation of mr. Only single merge
+// requests have the detailed fields.
+func (s *Server) mergeRequest(mr *MergeRequest, detailed bool) map[string]any {
+	res := map[string]any{
+		"id":                           mr.IID + 100,
+		"iid":                          mr.IID,
+		"title":                        mr.Title,
+		"description":                  mr.Description,
+		"state":                        mr.State,
+		"web_url":                      fmt.Sprintf("https://gitlab.example.com/%v/%v/-/merge_requests/%d", s.Owner, s.Name, mr.IID),
+		"author":                       map[string]any{"id": 1, "username": mr.Author},
+		"labels":                       append([]string{}, mr.Labels...),
+		"created_at":                   time.Date(2023, 1, 1, 0, mr.IID, 0, 0, time.UTC),
+		"source_branch":                mr.SourceBranch,
+		"target_branch":                s.DefaultBranch,
+		"sha":                          mr.SHA,
+		"has_conflicts":                mr.HasConflicts,
+		"merge_when_pipeline_succeeds": mr.MergeWhenPipelineSucceeds,
+		"detailed_merge_status":        s.detailedMergeStatus(mr),
+		"merge_commit_sha":             nil,
+		"squash_commit_sha":            nil,
+	}
+	if mr.MergeCommitSHA != "" {
+		if mr.Squash {
+			res["squash_commit_sha"] = mr.MergeCommitSHA
+		} else {
+			res["merge_commit_sha"] = mr.MergeCommitSHA
+		}
+	}
+	if detailed && mr.Pipeline != "" {
+		res["head_pipeline"] = s.pipeline(mr)
+	}
+	return res
+}
+
+func (s *Server) pipeline(mr *MergeRequest) map[string]any {
+	return map[string]any{
+		"id":      mr.IID + 500,
+		"sha":     mr.SHA,
+		"ref":     mr.SourceBranch,
+		"status":  mr.Pipeline,
+		"web_url": fmt.Sprintf("https://gitlab.example.com/%v/%v/-/pipelines/%d", s.Owner, s.Name, mr.IID+500),
+	}
+}
+
+func (s *Server) listMRs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var iids []int
+	for n, mr := range s.mrs {
+		if q.Get("state") != "" && q.Get("state") != "all" && mr.State != q.Get("state") {
+			continue
+		}
+		if q.Get("target_branch") != "" && q.Get("target_branch") != s.DefaultBranch {
+			continue
+		}
+		iids = append(iids, n)
+	}
+	sort.Ints(iids)
+	var mrs []map[string]any
+	for _, n := range iids {
+		mrs = append(mrs, s.mergeRequest(s.mrs[n], false))
+	}
+	page(s, w, r, mrs)
+}
+
+// editMR updates the description and labels. Ticking the rebase checkbox or
+// adding the rebase label makes Renovate rebase the merge request.
+func (s *Server) editMR(w http.ResponseWriter, r *http.Request, mr *MergeRequest) {
+	var req struct {
+		Description *string `json:"description"`
+		AddLabels   string  `json:"add_labels"`
+	}
+	if !s.read(w, r, &req) {
+		return
+	}
+	if req.Description != nil {
+		mr.Description = *req.Description
+		if strings.Contains(mr.Description, rebaseChecked) {
+			s.rebase(mr)
+		}
+	}
+	for _, l := range strings.Split(req.AddLabels, ",") {
+		switch l {
+		case "":
+		case "rebase":
+			s.rebase(mr)
+		default:
+			mr.Labels = append(mr.Labels, l)
+		}
+	}
+	s.write(w, s.mergeRequest(mr, true))
+}
+
+// rebase does what Renovate does when asked to rebase: pushes a new head
+// commit that is up to date with the target branch, and resets the
+// checkbox. GitLab resets the approvals on a new commit.
+func (s *Server) rebase(mr *MergeRequest) {
+	mr.SHA = s.sha()
+	mr.Description = strings.Replace(mr.Description, rebaseChecked, rebaseCheckbox, 1)
+	mr.NeedRebase = false
+	mr.HasConflicts = false
+	mr.Approvals = nil
+	mr.Rebases++
+}
+
+func (s *Server) approvals(mr *MergeRequest) map[string]any {
+	approvedBy := []map[string]any{}
+	for i, u := range mr.Approvals {
+		approvedBy = append(approvedBy, map[string]any{"user": map[string]any{"id": i + 1, "username": u}})
+	}
+	left := mr.ApprovalsRequired - len(mr.Approvals)
+	if left < 0 {
+		left = 0
+	}
+	return map[string]any{
+		"approved":           left == 0,
+		"approvals_left":     left,
+		"approved_by":        approvedBy,
+		"approvals_required": mr.ApprovalsRequired,
+	}
+}
+
+func (s *Server) approve(w http.ResponseWriter, r *http.Request, mr *MergeRequest) {
+	var req struct {
+		SHA string `json:"sha"`
+	}
+	if !s.read(w, r, &req) {
+		return
+	}
+	if req.SHA != "" && req.SHA != mr.SHA {
+		s.error(w, http.StatusConflict, "SHA does not match HEAD of source branch")
+		return
+	}
+	for _, u := range mr.Approvals {
+		if u == s.Username {
+			s.error(w, http.StatusUnauthorized, "401 Unauthorized")
+			return
+		}
+	}
+	mr.Approvals = append(mr.Approvals, s.Username)
+	s.writeStatus(w, http.StatusCreated, s.approvals(mr))
+}
+
+func (s *Server) mergeMR(w http.ResponseWriter, r *http.Request, mr *MergeRequest) {
+	var req struct {
+		SHA                       string `json:"sha"`
+		Squash                    bool   `json:"squash"`
+		MergeCommitMessage        string `json:"merge_commit_message"`
+		SquashCommitMessage       string `json:"squash_commit_message"`
+		MergeWhenPipelineSucceeds bool   `json:"merge_when_pipeline_succeeds"`
+	}
+	if !s.read(w, r, &req) {
+		return
+	}
+	if mr.State != "opened" {
+		s.error(w, http.StatusMethodNotAllowed, "405 Method Not Allowed")
+		return
+	}
+	if req.SHA != "" && req.SHA != mr.SHA {
+		s.error(w, http.StatusConflict, "SHA does not match HEAD of source branch")
+		return
+	}
+	mr.Squash = req.Squash
+	mr.CommitMessage = req.MergeCommitMessage
+	if req.Squash {
+		mr.CommitMessage = req.SquashCommitMessage
+	}
+	if req.MergeWhenPipelineSucceeds && mr.Pipeline != "" && mr.Pipeline != "success" {
+		mr.MergeWhenPipelineSucceeds = true
+		s.write(w, s.mergeRequest(mr, true))
+		return
+	}
+	switch s.detailedMergeStatus(mr) {
+	case "mergeable":
+	case "conflict":
+		s.error(w, http.StatusNotAcceptable, "Branch cannot be merged")
+		return
+	default:
+		s.error(w, http.StatusMethodNotAllowed, "405 Method Not Allowed")
+		return
+	}
+	s.merge(mr)
+	s.write(w, s.mergeRequest(mr, true))
+}
+
+// merge merges mr. Must be called with s.mu held.
+func (s *Server) merge(mr *MergeRequest) {
+	mr.State = "merged"
+	mr.MergeCommitSHA = s.sha()
+	mr.MergeWhenPipelineSucceeds = false
+}
+
+// mrForSHA returns the merge request with the head commit sha, or nil.
+func (s *Server) mrForSHA(sha string) *MergeRequest {
+	for _, mr := range s.mrs {
+		if mr.SHA == sha {
+			return mr
+		}
+	}
+	return nil
+}
+
+func (s *Server) statuses(w http.ResponseWriter, r *http.Request, sha string) {
+	var res []map[string]any
+	if mr := s.mrForSHA(sha); mr != nil {
+		for _, st := range mr.Statuses {
+			res = append(res, map[string]any{
+				"name":          st.Name,
+				"status":        st.Status,
+				"target_url":    st.URL,
+				"allow_failure": st.AllowFailure,
+				"sha":           sha,
+			})
+		}
+	}
+	page(s, w, r, res)
+}
+
+func (s *Server) pipelines(w http.ResponseWriter, r *http.Request) {
+	res := []map[string]any{}
+	if mr := s.mrForSHA(r.URL.Query().Get("sha")); mr != nil && mr.Pipeline != "" {
+		res = append(res, s.pipeline(mr))
+	}
+	s.write(w, res)
+}
+
+// page writes the page of items requested by the page and per_page query
+// parameters, with the X-Next-Page header that GitLab sends.
+func page[T any](s *Server, w http.ResponseWriter, r *http.Request, items []T) {
+	q := r.URL.Query()
+	size, _ := strconv.Atoi(q.Get("per_page"))
+	if size <= 0 || size > s.PageSize {
+		size = s.PageSize
+	}
+	n, _ := strconv.Atoi(q.Get("page"))
+	if n < 1 {
+		n = 1
+	}
+	start := (n - 1) * size
+	if start > len(items) {
+		start = len(items)
+	}
+	end := start + size
+	if end >= len(items) {
+		end = len(items)
+		w.Header().Set("X-Next-Page", "")
+	} else {
+		w.Header().Set("X-Next-Page", strconv.Itoa(n+1))
+	}
+	res := append([]T{}, items[start:end]...)
+	s.write(w, res)
+}
+
+func (s *Server) read(w http.ResponseWriter, r *http.Request, v any) bool {
+	b, err := io.ReadAll(r.Body)
+	if err == nil && len(b) > 0 {
+		err = json.Unmarshal(b, v)
+	}
+	if err != nil {
+		s.error(w, http.StatusBadRequest, fmt.Sprintf("400 Bad request - %v", err))
+		return false
+	}
+	return true
+}
+
+func (s *Server) write(w http.ResponseWriter, v any) {
+	s.writeStatus(w, http.StatusOK, v)
+}
+
+func (s *Server) writeStatus(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.t.Errorf("can't write response: %v", err)
+	}
+}
+
+func (s *Server) error(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// notFound responds with 404 and fails the test, since the code under test
+// used an API that the stand-in does not know.
+func (s *Server) notFound(w http.ResponseWriter, r *http.Request) {
+	s.t.Errorf("gitlabtest: unexpected request %v %v", r.Method, r.URL)
+	s.error(w, http.StatusNotFound, "404 Not Found")
+}
@@ -21,16 +21,17 @@ import (
 	"os"
 	"os/exec"
 	"path"
-	"regexp"
 	"strings"
 
 	git "github.com/go-git/go-git/v5"
 	"github.com/google/go-github/v51/github"
+	"github.com/hessjcg/git-gtool/internal/forge"
+	"github.com/hessjcg/git-gtool/internal/forge/giteaforge"
+	"github.com/hessjcg/git-gtool/internal/forge/githubforge"
+	"github.com/hessjcg/git-gtool/internal/forge/gitlabforge"
 	"github.com/hessjcg/git-gtool/internal/model"
 )
 
-var githubUrlRegex = regexp.MustCompile("https://github.com/([^\\/]+)/([^\\/]+).git")
-
 type GitRepo struct {
 	// GitCommand full path to the git executable.
 	GitCommand string
@@ -40,13 +41,26 @@ type GitRepo struct {
 	GitDir string
 	// Repo the go-git model for the local repo.
 	Repo *git.Repository
-	// Client the github api client.
+	// Forge the forge hosting the remote repository that commands should
+	// target. Commands should use it instead of Client.
+	Forge forge.Forge
+	// Client the github api client. Nil when the remote is not on Github.
 	Client *github.Client
-	// GithubRepo the remote repository from the Github api.
+	// GithubRepo the remote repository from the Github api that commands
+	// should target. Nil when the remote is not on Github.
 	GithubRepo *github.Repository
-	// Owner the Github repo owner.
+	// RemoteName the name of the git remote for the repository.
+	RemoteName string
+	// ForkRepo the repository of the origin remote when it is a fork,
+	// otherwise nil.
+	ForkRepo *github.Repository
+	// UpstreamRepo the parent repository of ForkRepo, otherwise nil.
+	UpstreamRepo *github.Repository
+	// Host the forge host name, like github.com or a Github Enterprise host.
+	Host string
+	// Owner the repo owner. On GitLab, the full group path.
 	Owner string
-	// Name the Github repo name.
+	// Name the repo name.
 	Name string
 }
 
@@ -55,8 +69,29 @@ func (r *GitRepo) GitExec(args ...string) (string, error) {
 	return Run(r.WorkDir, r.GitCommand, args...)
 }
 
+// Options configures OpenGit.
+type Options struct {
+	// GithubHosts are the host names of Github Enterprise servers. Remotes
+	// on github.com are always recognized.
+	GithubHosts []string
+	// GitlabHosts are the host names of self-managed GitLab servers. Remotes
+	// on gitlab.com are always recognized.
+	GitlabHosts []string
+	// GiteaHosts are the host names of Gitea or Forgejo servers.
+	GiteaHosts []string
+	// Remote the name of the git remote to use. When empty, uses `upstream`
+	// if it is the parent of the `origin` fork, otherwise `origin`.
+	Remote string
+	// Credentials are tried in order to find a token for the forge API.
+	// Defaults to model.DefaultCredentialProviders.
+	Credentials []model.CredentialProvider
+	// CacheDir the directory for the API response cache. When empty,
+	// responses are not cached.
+	CacheDir string
+}
+
 // OpenGit opens the git repository at working directory cwd.
-func OpenGit(ctx context.Context, cwd string) (*GitRepo, error) {
+func OpenGit(ctx context.Context, cwd string, opts Options) (*GitRepo, error) {
 	gitcmd, err := GitExecutablePath(cwd)
 	if err != nil {
 		return nil, err
@@ -83,48 +118,262 @@ func OpenGit(ctx context.Context, cwd string) (*GitRepo, error) {
 		DetectDotGit:          true,
 		EnableDotGitCommonDir: true,
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	cfg, err := repo.Config()
 	if err != nil {
 		return nil, err
 	}
-	origin, ok := cfg.Remotes["origin"]
-	if !ok {
-		return nil, fmt.Errorf("no remote branch found")
-	}
-	var owner, name string
-	for _, u := range origin.URLs {
-		m := githubUrlRegex.FindStringSubmatch(u)
-		if len(m) >= 3 {
-			owner = m[1]
-			name = m[2]
-			break
-		}
+	remotes := map[string][]string{}
+	for name, rc := range cfg.Remotes {
+		remotes[name] = rc.URLs
+	}
+	sel, err := pickRemote(remotes, opts)
+	if err != nil {
+		return nil, err
 	}
 
-	var c *github.Client
-	var r *github.Repository
-	if name != "" && owner != "" {
-		c, err = model.NewClient(ctx, workdir)
+	providers := opts.Credentials
+	if len(providers) == 0 {
+		providers = model.DefaultCredentialProviders(workdir, nil)
+	}
+	if sel.kind != model.ForgeGithub {
+		return openForge(ctx, sel.kind, &GitRepo{
+			GitCommand: gitcmd,
+			WorkDir:    workdir,
+			GitDir:     gitdir,
+			Repo:       repo,
+			RemoteName: sel.name,
+		}, sel.remote, providers, opts)
+	}
 
-		r, _, err = c.Repositories.Get(ctx, owner, name)
+	// Find the fork and upstream repos using a client for the first remote,
+	// then get a client for the remote that was selected.
+	first := sel.target()
+	c, err := githubClient(ctx, first, providers, opts)
+	if err != nil {
+		return nil, err
+	}
+	err = findFork(ctx, sel, remotes, opts, func(ctx context.Context, owner, name string) (*github.Repository, error) {
+		r, _, err := c.Repositories.Get(ctx, owner, name)
+		return r, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if sel.target() != first {
+		c, err = githubClient(ctx, sel.target(), providers, opts)
 		if err != nil {
-			return nil, fmt.Errorf("error retrieving Github repo: %v", err)
+			return nil, err
 		}
 	}
 
 	return &GitRepo{
-		GitCommand: gitcmd,
-		WorkDir:    workdir,
-		GitDir:     gitdir,
-		Repo:       repo,
-		Client:     c,
-		Owner:      owner,
-		Name:       name,
-		GithubRepo: r,
+		GitCommand:   gitcmd,
+		WorkDir:      workdir,
+		GitDir:       gitdir,
+		Repo:         repo,
+		Forge:        githubforge.New(c, sel.repo),
+		Client:       c,
+		Owner:        sel.remote.Owner,
+		Name:         sel.remote.Name,
+		GithubRepo:   sel.repo,
+		RemoteName:   sel.name,
+		ForkRepo:     sel.fork,
+		UpstreamRepo: sel.upstream,
+		Host:         sel.remote.ApiHost(),
 	}, nil
 }
 
+// remoteSelection is the remote that commands target, and the Github
+// repositories found while choosing it.
+type remoteSelection struct {
+	// name the name of the git remote.
+	name   string
+	remote *Remote
+	// kind the kind of forge, one of the model.Forge constants.
+	kind string
+	// repo the Github repository of the remote, nil on other forges.
+	repo *github.Repository
+	// fork the repository of origin when it is a fork, and upstream its
+	// parent, otherwise nil.
+	fork, upstream *github.Repository
+}
+
+// target returns the credential target for the selected remote.
+func (s *remoteSelection) target() model.Target {
+	return model.Target{
+		Forge: s.kind,
+		Host:  s.remote.ApiHost(),
+		Owner: s.remote.Owner,
+		Name:  s.remote.Name,
+	}
+}
+
+// pickRemote selects the remote named by opts.Remote, or origin, from the
+// urls of each git remote by name.
+func pickRemote(remotes map[string][]string, opts Options) (*remoteSelection, error) {
+	name := opts.Remote
+	if name == "" {
+		name = "origin"
+	}
+	urls, ok := remotes[name]
+	if !ok {
+		return nil, fmt.Errorf("no remote named %q found", name)
+	}
+	remote, kind, err := forgeRemote(urls, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &remoteSelection{name: name, remote: remote, kind: kind}, nil
+}
+
+// findFork reads the Github repository of sel with getRepo, and finds the
+// fork and upstream repositories using the origin remote as the fork. When
+// the remote was not chosen by opts.Remote, it switches sel to the upstream
+// remote if that is the parent of the origin fork.
+func findFork(ctx context.Context, sel *remoteSelection, remotes map[string][]string, opts Options,
+	getRepo func(ctx context.Context, owner, name string) (*github.Repository, error)) error {
+	r, err := getRepo(ctx, sel.remote.Owner, sel.remote.Name)
+	if err != nil {
+		return fmt.Errorf("error retrieving Github repo: %v", err)
+	}
+	sel.repo = r
+
+	var forkRepo, upstreamRepo *github.Repository
+	if sel.name == "origin" {
+		forkRepo = r
+	} else if urls, ok := remotes["origin"]; ok {
+		if o, err := githubRemote(urls, opts.GithubHosts); err == nil && o.ApiHost() == sel.remote.ApiHost() {
+			forkRepo, err = getRepo(ctx, o.Owner, o.Name)
+			if err != nil {
+				return fmt.Errorf("error retrieving Github repo for origin: %v", err)
+			}
+		}
+	}
+	if forkRepo == nil || !forkRepo.GetFork() || forkRepo.GetParent() == nil {
+		return nil
+	}
+	upstreamRepo, err = getRepo(ctx, forkRepo.GetParent().GetOwner().GetLogin(), forkRepo.GetParent().GetName())
+	if err != nil {
+		return fmt.Errorf("error retrieving Github repo for the parent of origin: %v", err)
+	}
+	sel.fork = forkRepo
+	sel.upstream = upstreamRepo
+
+	if opts.Remote != "" {
+		return nil
+	}
+	urls, ok := remotes["upstream"]
+	if !ok {
+		return nil
+	}
+	u, err := githubRemote(urls, opts.GithubHosts)
+	if err == nil && u.ApiHost() == sel.remote.ApiHost() && isRepo(upstreamRepo, u) {
+		log.Printf("Using remote upstream, the parent of the origin fork %v", forkRepo.GetFullName())
+		sel.name = "upstream"
+		sel.remote = u
+		sel.repo = upstreamRepo
+	}
+	return nil
+}
+
+// githubClient returns a Github client using the credential for target.
+func githubClient(ctx context.Context, target model.Target, providers []model.CredentialProvider, opts Options) (*github.Client, error) {
+	cred, err := model.FindCredential(ctx, target, providers)
+	if err != nil {
+		return nil, err
+	}
+	return model.NewClient(ctx, target.Host, cred, model.ClientOptions{
+		CacheDir: opts.CacheDir,
+	})
+}
+
+// openForge sets up r for the repository of remote on a GitLab or Gitea
+// forge. These repositories only have a Forge, commands that need the
+// Github client don't work on them, and forks are not detected.
+func openForge(ctx context.Context, kind string, r *GitRepo, remote *Remote, providers []model.CredentialProvider, opts Options) (*GitRepo, error) {
+	cred, err := model.FindCredential(ctx, model.Target{
+		Forge: kind,
+		Host:  remote.ApiHost(),
+		Owner: remote.Owner,
+		Name:  remote.Name,
+	}, providers)
+	if err != nil {
+		return nil, err
+	}
+	client := model.NewHTTPClient(ctx, cred, model.ClientOptions{CacheDir: opts.CacheDir})
+	switch kind {
+	case model.ForgeGitlab:
+		r.Forge, err = gitlabforge.New(ctx, client, gitlabforge.APIURL(remote.ApiHost()), remote.Owner, remote.Name)
+	case model.ForgeGitea:
+		r.Forge, err = giteaforge.New(ctx, client, giteaforge.APIURL(remote.ApiHost()), remote.Owner, remote.Name)
+	default:
+		err = fmt.Errorf("unknown forge %q", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.Host = remote.ApiHost()
+	r.Owner = remote.Owner
+	r.Name = remote.Name
+	return r, nil
+}
+
+// isRepo returns true when the Github repository r is the same repository
+// as the remote.
+func isRepo(r *github.Repository, remote *Remote) bool {
+	return strings.EqualFold(r.GetOwner().GetLogin(), remote.Owner) &&
+		strings.EqualFold(r.GetName(), remote.Name)
+}
+
+// forgeRemote returns the first of the remote urls that is hosted on a
+// recognized forge, and the kind of forge. Github hosts are tried first.
+func forgeRemote(urls []string, opts Options) (*Remote, string, error) {
+	var errs []string
+	for _, u := range urls {
+		remote, err := ParseRemoteURL(u)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		switch {
+		case remote.IsGithub(opts.GithubHosts):
+			return remote, model.ForgeGithub, nil
+		case remote.IsGitlab(opts.GitlabHosts):
+			return remote, model.ForgeGitlab, nil
+		case remote.IsGitea(opts.GiteaHosts):
+			return remote, model.ForgeGitea, nil
+		}
+		errs = append(errs, fmt.Sprintf("remote url %q is not on a recognized Github, GitLab or Gitea host, "+
+			"add Github Enterprise hosts to the github.hosts config, GitLab hosts to gitlab.hosts, "+
+			"or Gitea hosts to gitea.hosts", u))
+	}
+	return nil, "", fmt.Errorf("no Github, GitLab or Gitea remote found: %v", strings.Join(errs, "; "))
+}
+
+// githubRemote returns the first of the remote urls that is hosted on Github
+// or one of the Github Enterprise hosts.
+func githubRemote(urls []string, githubHosts []string) (*Remote, error) {
+	var errs []string
+	for _, u := range urls {
+		remote, err := ParseRemoteURL(u)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if !remote.IsGithub(githubHosts) {
+			errs = append(errs, fmt.Sprintf("remote url %q is not on a recognized Github host, "+
+				"add Github Enterprise hosts to the github.hosts config", u))
+			continue
+		}
+		return remote, nil
+	}
+	return nil, fmt.Errorf("no Github remote found: %v", strings.Join(errs, "; "))
+}
+
 // GitExecutablePath returns the executable using the git
 // extension env variables if possible.
 func GitExecutablePath(cwd string) (string, error) {
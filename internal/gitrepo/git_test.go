@@ -0,0 +1,157 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitrepo
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-github/v51/github"
+	"github.com/hessjcg/git-gtool/internal/model"
+)
+
+// testRepos are the Github repositories for TestSelectRemote. someone/widget
+// is a fork of example/widget.
+var testRepos = map[string]*github.Repository{
+	"example/widget": {
+		FullName: github.String("example/widget"),
+		Name:     github.String("widget"),
+		Owner:    &github.User{Login: github.String("example")},
+	},
+	"someone/widget": {
+		FullName: github.String("someone/widget"),
+		Name:     github.String("widget"),
+		Owner:    &github.User{Login: github.String("someone")},
+		Fork:     github.Bool(true),
+		Parent: &github.Repository{
+			Name:  github.String("widget"),
+			Owner: &github.User{Login: github.String("example")},
+		},
+	},
+}
+
+func getTestRepo(_ context.Context, owner, name string) (*github.Repository, error) {
+	r, ok := testRepos[owner+"/"+name]
+	if !ok {
+		return nil, fmt.Errorf("404 Not Found %v/%v", owner, name)
+	}
+	return r, nil
+}
+
+func TestSelectRemote(t *testing.T) {
+	tests := []struct {
+		name    string
+		remotes map[string][]string
+		remote  string
+		// want the selected remote name and credential target owner/name,
+		// or the error.
+		want     string
+		target   string
+		fork     string
+		upstream string
+		err      string
+	}{
+		{
+			name:    "origin only",
+			remotes: map[string][]string{"origin": {"git@github.com:example/widget.git"}},
+			want:    "origin",
+			target:  "github.com example/widget",
+		},
+		{
+			name: "fork with upstream",
+			remotes: map[string][]string{
+				"origin":   {"git@github.com:someone/widget.git"},
+				"upstream": {"https://github.com/example/widget.git"},
+			},
+			want:     "upstream",
+			target:   "github.com example/widget",
+			fork:     "someone/widget",
+			upstream: "example/widget",
+		},
+		{
+			name:     "fork without upstream",
+			remotes:  map[string][]string{"origin": {"git@github.com:someone/widget.git"}},
+			want:     "origin",
+			target:   "github.com someone/widget",
+			fork:     "someone/widget",
+			upstream: "example/widget",
+		},
+		{
+			name: "explicit remote",
+			remotes: map[string][]string{
+				"origin":   {"git@github.com:someone/widget.git"},
+				"upstream": {"https://github.com/example/widget.git"},
+			},
+			remote:   "origin",
+			want:     "origin",
+			target:   "github.com someone/widget",
+			fork:     "someone/widget",
+			upstream: "example/widget",
+		},
+		{
+			name: "explicit upstream remote",
+			remotes: map[string][]string{
+				"origin":   {"git@github.com:someone/widget.git"},
+				"upstream": {"https://github.com/example/widget.git"},
+			},
+			remote:   "upstream",
+			want:     "upstream",
+			target:   "github.com example/widget",
+			fork:     "someone/widget",
+			upstream: "example/widget",
+		},
+		{
+			name:    "missing remote",
+			remotes: map[string][]string{"origin": {"git@github.com:example/widget.git"}},
+			remote:  "upstream",
+			err:     `no remote named "upstream" found`,
+		},
+		{
+			name:    "no origin",
+			remotes: map[string][]string{},
+			err:     `no remote named "origin" found`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{Remote: tt.remote}
+			sel, err := pickRemote(tt.remotes, opts)
+			if err == nil {
+				err = findFork(context.Background(), sel, tt.remotes, opts, getTestRepo)
+			}
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("got error %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			target := sel.target()
+			if target.Forge != model.ForgeGithub || sel.name != tt.want ||
+				fmt.Sprintf("%v %v/%v", target.Host, target.Owner, target.Name) != tt.target {
+				t.Errorf("got remote %v with target %+v, want %v with %v", sel.name, target, tt.want, tt.target)
+			}
+			if sel.repo.GetFullName() != target.Owner+"/"+target.Name {
+				t.Errorf("got repo %v, want the repo of the target", sel.repo.GetFullName())
+			}
+			if sel.fork.GetFullName() != tt.fork || sel.upstream.GetFullName() != tt.upstream {
+				t.Errorf("got fork %q upstream %q, want %q %q", sel.fork.GetFullName(), sel.upstream.GetFullName(), tt.fork, tt.upstream)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitrepo
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	// GithubHost is the host name of github.com, which is always recognized.
+	GithubHost = "github.com"
+	// GitlabHost is the host name of gitlab.com, which is always recognized.
+	GitlabHost = "gitlab.com"
+)
+
+// scpLikeUrlRegex matches the scp-like syntax used by ssh remotes,
+// for example `git@github.com:owner/name.git`.
+var scpLikeUrlRegex = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):(.+)$`)
+
+// Remote is a repository on a forge, parsed from a git remote URL.
+type Remote struct {
+	// Host the forge host name, without the port.
+	Host string
+	// Port the port of an http or https remote, which the API is also
+	// served on. It is "" for the default port, and for the other schemes
+	// since their port is not the port of the API.
+	Port string
+	// Owner the repo owner. For forges with nested groups, this holds the
+	// full group path.
+	Owner string
+	// Name the repo name without the .git suffix.
+	Name string
+}
+
+// ParseRemoteURL parses a git remote URL in any of these forms:
+//
+//	https://host/owner/name.git
+//	ssh://user@host:port/owner/name.git
+//	git://host/owner/name.git
+//	user@host:owner/name.git
+//
+// The .git suffix is optional.
+func ParseRemoteURL(u string) (*Remote, error) {
+	var host, port, p string
+	if strings.Contains(u, "://") {
+		pu, err := url.Parse(u)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse remote url %q: %v", u, err)
+		}
+		switch pu.Scheme {
+		case "https", "http", "ssh", "git", "git+ssh", "ssh+git":
+		default:
+			return nil, fmt.Errorf("unsupported remote url scheme %q in %q", pu.Scheme, u)
+		}
+		host = pu.Hostname()
+		p = pu.Path
+		if defaultPort := map[string]string{"https": "443", "http": "80"}[pu.Scheme]; defaultPort != "" && pu.Port() != defaultPort {
+			port = pu.Port()
+		}
+	} else if m := scpLikeUrlRegex.FindStringSubmatch(u); m != nil {
+		host = m[1]
+		p = m[2]
+	} else {
+		return nil, fmt.Errorf("unrecognized remote url %q", u)
+	}
+
+	p = strings.TrimSuffix(strings.Trim(p, "/"), ".git")
+	i := strings.LastIndex(p, "/")
+	if host == "" || i <= 0 || i == len(p)-1 {
+		return nil, fmt.Errorf("remote url %q does not contain a host, owner and repo name", u)
+	}
+
+	return &Remote{
+		Host:  strings.ToLower(host),
+		Port:  port,
+		Owner: p[:i],
+		Name:  p[i+1:],
+	}, nil
+}
+
+// IsGithub returns true when the remote is hosted on github.com or one of
+// the Github Enterprise hosts in enterpriseHosts.
+func (r *Remote) IsGithub(enterpriseHosts []string) bool {
+	if r.Host == GithubHost || r.Host == "ssh."+GithubHost || r.Host == "www."+GithubHost {
+		return true
+	}
+	for _, h := range enterpriseHosts {
+		if strings.EqualFold(r.Host, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsGitlab returns true when the remote is hosted on gitlab.com or one of
+// the self-managed GitLab hosts in gitlabHosts.
+func (r *Remote) IsGitlab(gitlabHosts []string) bool {
+	if r.Host == GitlabHost || r.Host == "altssh."+GitlabHost {
+		return true
+	}
+	for _, h := range gitlabHosts {
+		if strings.EqualFold(r.Host, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsGitea returns true when the remote is hosted on one of the Gitea or
+// Forgejo hosts in giteaHosts. There is no public Gitea host that is always
+// recognized.
+func (r *Remote) IsGitea(giteaHosts []string) bool {
+	for _, h := range giteaHosts {
+		if strings.EqualFold(r.Host, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// ApiHost returns the host to use for API calls to the forge, with the port
+// when it is not the default.
+func (r *Remote) ApiHost() string {
+	switch r.Host {
+	case "ssh." + GithubHost, "www." + GithubHost:
+		return GithubHost
+	case "altssh." + GitlabHost:
+		return GitlabHost
+	}
+	if r.Port != "" {
+		return net.JoinHostPort(r.Host, r.Port)
+	}
+	return r.Host
+}
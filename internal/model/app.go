@@ -0,0 +1,152 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// appTokenRefresh is how long before an installation token expires that
+// a new token is requested.
+const appTokenRefresh = 5 * time.Minute
+
+// AppConfig identifies a Github App and its private key.
+type AppConfig struct {
+	// ID the Github App ID.
+	ID int64
+	// InstallationID the ID of the App installation to get a token for.
+	// When 0, uses the installation for the target repository.
+	InstallationID int64
+	// PrivateKeyPath the path to the App's PEM encoded private key.
+	PrivateKeyPath string
+}
+
+// AppProvider gets installation tokens for a Github App. Installation tokens
+// expire after an hour, so the token expiry is set a few minutes early to
+// request a new one before requests start to fail.
+type AppProvider struct {
+	Config AppConfig
+}
+
+func (p *AppProvider) Name() string {
+	return fmt.Sprintf("github app %d", p.Config.ID)
+}
+
+func (p *AppProvider) Token(ctx context.Context, target Target) (*oauth2.Token, error) {
+	if !target.IsGithub() {
+		return nil, errNotGithub(target)
+	}
+	if p.Config.ID == 0 || p.Config.PrivateKeyPath == "" {
+		return nil, fmt.Errorf("app id and private key are required")
+	}
+	key, err := readPrivateKey(p.Config.PrivateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	jwt, err := appJWT(p.Config.ID, key, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewClient(ctx, target.Host, oauth2.StaticTokenSource(staticToken(jwt)), ClientOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	id := p.Config.InstallationID
+	if id == 0 {
+		if target.Owner == "" || target.Name == "" {
+			return nil, fmt.Errorf("installation id is required when the repository is not known")
+		}
+		inst, _, err := c.Apps.FindRepositoryInstallation(ctx, target.Owner, target.Name)
+		if err != nil {
+			return nil, fmt.Errorf("can't find app installation for %v/%v: %v", target.Owner, target.Name, err)
+		}
+		id = inst.GetID()
+	}
+
+	t, _, err := c.Apps.CreateInstallationToken(ctx, id, nil)
+	if err != nil {
+		return nil, fmt.Errorf("can't create installation token: %v", err)
+	}
+	return &oauth2.Token{
+		AccessToken: t.GetToken(),
+		TokenType:   "token",
+		Expiry:      t.GetExpiresAt().Add(-appTokenRefresh),
+	}, nil
+}
+
+// readPrivateKey reads a PKCS1 or PKCS8 PEM encoded RSA private key.
+func readPrivateKey(path string) (*rsa.PrivateKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %v", path)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse private key %v: %v", path, err)
+	}
+	key, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key %v is not an RSA key", path)
+	}
+	return key, nil
+}
+
+// appJWT returns a JWT signed by key that authenticates as the Github App
+// with id appID for 9 minutes. The issued time is backdated to allow for
+// clock drift.
+func appJWT(appID int64, key *rsa.PrivateKey, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]int64{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": appID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("can't sign app JWT: %v", err)
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
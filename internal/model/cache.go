@@ -0,0 +1,234 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// DefaultCacheDir returns the directory for the Github API response cache
+// in the user cache directory.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "git-gtool", "http"), nil
+}
+
+// CacheTransport is an http.RoundTripper that caches GET responses on disk
+// and revalidates them with conditional requests using If-None-Match and
+// If-Modified-Since. Github does not count 304 Not Modified responses
+// against the rate limit. Entries are keyed by URL and the Authorization
+// header so that responses are never shared between tokens.
+type CacheTransport struct {
+	// Dir the directory holding the cached responses.
+	Dir string
+	// Base the transport used to make requests. Defaults to
+	// http.DefaultTransport.
+	Base http.RoundTripper
+}
+
+// cacheEntry is a cached response, stored as JSON.
+type cacheEntry struct {
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *CacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return t.base().RoundTrip(req)
+	}
+
+	path := t.path(req)
+	entry := t.load(path, req)
+
+	r := req
+	if entry != nil {
+		r = req.Clone(req.Context())
+		if etag := entry.Header.Get("ETag"); etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		if lm := entry.Header.Get("Last-Modified"); lm != "" {
+			r.Header.Set("If-Modified-Since", lm)
+		}
+	}
+
+	res, err := t.base().RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotModified && entry != nil {
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		return entry.response(req, res.Header), nil
+	}
+
+	if res.StatusCode != http.StatusOK ||
+		(res.Header.Get("ETag") == "" && res.Header.Get("Last-Modified") == "") {
+		return res, nil
+	}
+
+	// Store the response so that the next request can be revalidated.
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	t.store(path, &cacheEntry{
+		URL:    req.URL.String(),
+		Status: res.StatusCode,
+		Header: res.Header,
+		Body:   body,
+	})
+	return res, nil
+}
+
+var (
+	// shardPattern matches the names of the directories that the cache
+	// entries are spread over, the first 2 hex digits of the key.
+	shardPattern = regexp.MustCompile(`^[0-9a-f]{2}$`)
+	// cacheFilePattern matches the names of the files that CacheTransport
+	// writes, the entries and the temporary files for entries being stored.
+	cacheFilePattern = regexp.MustCompile(`^(?:[0-9a-f]{64}\.json|tmp-[0-9]+)$`)
+)
+
+// Clear deletes all cached responses. Dir can be any directory the user
+// chose, so Clear only deletes the files that CacheTransport writes, and
+// then the directories that are left empty.
+func (t *CacheTransport) Clear() error {
+	shards, err := os.ReadDir(t.Dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, shard := range shards {
+		if !shard.IsDir() || !shardPattern.MatchString(shard.Name()) {
+			continue
+		}
+		dir := filepath.Join(t.Dir, shard.Name())
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if f.Type().IsRegular() && cacheFilePattern.MatchString(f.Name()) {
+				if err := os.Remove(filepath.Join(dir, f.Name())); err != nil {
+					return err
+				}
+			}
+		}
+		// Fails when the directory holds other files, which are kept.
+		os.Remove(dir)
+	}
+	os.Remove(t.Dir)
+	return nil
+}
+
+// path returns the cache file for req.
+func (t *CacheTransport) path(req *http.Request) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n", req.URL.String(), req.Header.Get("Accept"), req.Header.Get("Authorization"))
+	key := hex.EncodeToString(h.Sum(nil))
+	return filepath.Join(t.Dir, key[:2], key+".json")
+}
+
+// load returns the cached entry at path, or nil if there is none.
+func (t *CacheTransport) load(path string, req *http.Request) *cacheEntry {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	e := &cacheEntry{}
+	if err := json.Unmarshal(b, e); err != nil || e.URL != req.URL.String() {
+		return nil
+	}
+	return e
+}
+
+// store writes e to path. The cache is an optimization, so errors are
+// ignored.
+func (t *CacheTransport) store(path string, e *cacheEntry) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+// response builds the response for req from the cached entry, using the
+// headers of the 304 response for anything that it sets, like the rate
+// limit headers.
+func (e *cacheEntry) response(req *http.Request, notModified http.Header) *http.Response {
+	header := e.Header.Clone()
+	for k, v := range notModified {
+		if k == "Content-Length" || k == "Content-Type" {
+			continue
+		}
+		header[k] = v
+	}
+	header.Set("X-From-Cache", "1")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+func (t *CacheTransport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
@@ -0,0 +1,160 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCacheTransport(t *testing.T) {
+	var requests, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("X-RateLimit-Remaining", fmt.Sprint(100-requests))
+		etag := `"v1-` + r.Header.Get("Authorization") + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Link", `<next>; rel="next"`)
+		fmt.Fprintf(w, "body for %v", r.Header.Get("Authorization"))
+	}))
+	defer srv.Close()
+
+	c := &http.Client{Transport: &CacheTransport{Dir: t.TempDir()}}
+	get := func(auth string) *http.Response {
+		req, _ := http.NewRequest("GET", srv.URL+"/repos/o/r/pulls", nil)
+		req.Header.Set("Authorization", auth)
+		res, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	for i, tc := range []struct {
+		auth        string
+		notModified int
+		cached      bool
+	}{
+		{auth: "token a", notModified: 0},
+		{auth: "token a", notModified: 1, cached: true},
+		{auth: "token b", notModified: 1},
+		{auth: "token a", notModified: 2, cached: true},
+	} {
+		res := get(tc.auth)
+		b, _ := io.ReadAll(res.Body)
+		if res.StatusCode != http.StatusOK || string(b) != "body for "+tc.auth {
+			t.Fatalf("request %d: got %v %q", i, res.StatusCode, b)
+		}
+		if notModified != tc.notModified {
+			t.Fatalf("request %d: got %d not modified responses, want %d", i, notModified, tc.notModified)
+		}
+		if got := res.Header.Get("X-From-Cache") == "1"; got != tc.cached {
+			t.Fatalf("request %d: got cached %v, want %v", i, got, tc.cached)
+		}
+		if res.Header.Get("Link") == "" {
+			t.Fatalf("request %d: missing Link header", i)
+		}
+		if want := fmt.Sprint(100 - requests); res.Header.Get("X-RateLimit-Remaining") != want {
+			t.Fatalf("request %d: got rate limit %v, want the latest %v", i, res.Header.Get("X-RateLimit-Remaining"), want)
+		}
+	}
+}
+
+func TestCacheTransportClear(t *testing.T) {
+	dir := t.TempDir() + "/http"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, "ok")
+	}))
+	defer srv.Close()
+
+	ct := &CacheTransport{Dir: dir}
+	res, err := (&http.Client{Transport: ct}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if _, err := os.Stat(dir); err != nil {
+		t.Fatalf("got %v, want cache dir to exist", err)
+	}
+	if err := ct.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("got %v, want cache dir to be removed", err)
+	}
+}
+
+func TestCacheTransportClearKeepsOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, "ok")
+	}))
+	defer srv.Close()
+
+	ct := &CacheTransport{Dir: dir}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	entry := ct.path(req)
+
+	// The cache dir is shared with files that are not cached responses,
+	// also in another entry dir.
+	shard := "00"
+	if filepath.Base(filepath.Dir(entry)) == shard {
+		shard = "01"
+	}
+	keep := []string{filepath.Join(dir, "notes.txt"), filepath.Join(dir, shard, "notes.txt")}
+	for _, f := range keep {
+		if err := os.MkdirAll(filepath.Dir(f), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(f, []byte("keep"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := (&http.Client{Transport: ct}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if _, err := os.Stat(entry); err != nil {
+		t.Fatalf("got %v, want the response cached", err)
+	}
+	if err := ct.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(entry); !os.IsNotExist(err) {
+		t.Fatalf("got %v, want the cached response removed", err)
+	}
+	if _, err := os.Stat(filepath.Dir(entry)); !os.IsNotExist(err) {
+		t.Fatalf("got %v, want the empty entry dir removed", err)
+	}
+	for _, f := range keep {
+		if _, err := os.Stat(f); err != nil {
+			t.Errorf("got %v, want %v kept", err, f)
+		}
+	}
+}
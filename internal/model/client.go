@@ -16,29 +16,58 @@ package model
 
 import (
 	"context"
-	"log"
-	"os/exec"
-	"strings"
+	"net/http"
 
 	"github.com/google/go-github/v51/github"
 	"golang.org/x/oauth2"
 )
 
-// NewClient returns a new Github client that uses the same credentials
-// as the `gh` Github command line client.
-func NewClient(ctx context.Context, cwd string) (*github.Client, error) {
-	cmd := exec.Command("gh", "auth", "token")
-	cmd.Dir = cwd
-	output, err := cmd.Output()
-	if err != nil {
-		log.Fatalf("Unable to get github token using gh")
+// ClientOptions configures NewClient.
+type ClientOptions struct {
+	// CacheDir the directory for the response cache. When empty, responses
+	// are not cached.
+	CacheDir string
+}
+
+// NewClient returns a new Github client for host that authenticates using
+// tokens from ts. When host is not github.com, the client uses the Github
+// Enterprise API on that host. Requests wait for rate limits to reset and
+// failed idempotent requests are retried, see RateLimitTransport. GET
+// responses are cached when opts.CacheDir is set, see CacheTransport.
+func NewClient(ctx context.Context, host string, ts oauth2.TokenSource, opts ClientOptions) (*github.Client, error) {
+	tc := newHTTPClient(ts, NewRateLimitTransport(baseTransport(ctx)), opts)
+	if isGithubDotCom(host) {
+		return github.NewClient(tc), nil
+	}
+	return github.NewEnterpriseClient("https://"+host+"/api/v3/", "https://"+host+"/api/uploads/", tc)
+}
+
+// NewHTTPClient returns an http client for forges that don't have a Github
+// client. It sends tokens from ts as bearer tokens, and caches GET responses
+// like NewClient. It does not wait for rate limits, since RateLimitTransport
+// only knows the Github rate limit headers.
+func NewHTTPClient(ctx context.Context, ts oauth2.TokenSource, opts ClientOptions) *http.Client {
+	return newHTTPClient(ts, baseTransport(ctx), opts)
+}
+
+// newHTTPClient returns an http client that sends requests through t.
+func newHTTPClient(ts oauth2.TokenSource, t http.RoundTripper, opts ClientOptions) *http.Client {
+	if opts.CacheDir != "" {
+		t = &CacheTransport{Dir: opts.CacheDir, Base: t}
+	}
+	return &http.Client{
+		Transport: &oauth2.Transport{
+			Source: oauth2.ReuseTokenSource(nil, ts),
+			Base:   t,
+		},
+	}
+}
+
+// baseTransport returns the transport of the http client set in ctx using
+// the oauth2.HTTPClient key, or the default transport.
+func baseTransport(ctx context.Context) http.RoundTripper {
+	if c, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok && c.Transport != nil {
+		return c.Transport
 	}
-	token := strings.Trim(string(output), "\n\r ")
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: token},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-
-	client := github.NewClient(tc)
-	return client, nil
+	return http.DefaultTransport
 }
@@ -0,0 +1,306 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"gopkg.in/yaml.v3"
+)
+
+// The kinds of forge that a Target can be on.
+const (
+	// ForgeGithub is github.com or a Github Enterprise server.
+	ForgeGithub = "github"
+	// ForgeGitlab is gitlab.com or a self-managed GitLab server.
+	ForgeGitlab = "gitlab"
+	// ForgeGitea is a Gitea or Forgejo server.
+	ForgeGitea = "gitea"
+)
+
+// Target identifies the forge host, and when known, the repository that a
+// token is needed for.
+type Target struct {
+	// Forge the kind of forge, one of the Forge constants. Empty means
+	// ForgeGithub.
+	Forge string
+	// Host the forge host name.
+	Host string
+	// Owner the repository owner, may be empty.
+	Owner string
+	// Name the repository name, may be empty.
+	Name string
+}
+
+// IsGithub returns true when the target is on Github.
+func (t Target) IsGithub() bool {
+	return t.Forge == "" || t.Forge == ForgeGithub
+}
+
+// forgeName returns the name of the target's forge for messages.
+func (t Target) forgeName() string {
+	switch t.Forge {
+	case ForgeGitlab:
+		return "GitLab"
+	case ForgeGitea:
+		return "Gitea"
+	}
+	return "Github"
+}
+
+// errNotGithub is returned by the providers that only have Github tokens.
+func errNotGithub(t Target) error {
+	return fmt.Errorf("%v is not a Github host", t.Host)
+}
+
+// Credential is a source of forge tokens and the provider it came from.
+// Tokens that expire are requested again from the provider before they
+// expire.
+type Credential struct {
+	oauth2.TokenSource
+	// Source the name of the CredentialProvider that found the token.
+	Source string
+}
+
+// CredentialProvider finds a token for a forge.
+type CredentialProvider interface {
+	// Name describes where this provider looks for a token.
+	Name() string
+	// Token returns a token for t, or an error if there is none.
+	Token(ctx context.Context, t Target) (*oauth2.Token, error)
+}
+
+// DefaultCredentialProviders returns the providers to try in order: the
+// environment, the `gh` hosts.yml file, the `gh` command, and then the git
+// credential helpers. When app is not nil, Github App installation tokens
+// are tried first. cwd is the directory used to run commands.
+func DefaultCredentialProviders(cwd string, app *AppConfig) []CredentialProvider {
+	var p []CredentialProvider
+	if app != nil {
+		p = append(p, &AppProvider{Config: *app})
+	}
+	return append(p,
+		&EnvProvider{},
+		&GhHostsProvider{},
+		&GhCommandProvider{Dir: cwd},
+		&GitCredentialProvider{Dir: cwd},
+	)
+}
+
+// FindCredential returns the credential from the first provider that has
+// a token for t. If none do, the error lists why each provider failed.
+func FindCredential(ctx context.Context, t Target, providers []CredentialProvider) (*Credential, error) {
+	var errs []string
+	for _, p := range providers {
+		token, err := p.Token(ctx, t)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", p.Name(), err))
+			continue
+		}
+		return NewCredential(ctx, t, p, token), nil
+	}
+	return nil, fmt.Errorf("no %v credentials found for %v:\n  %v", t.forgeName(), t.Host, strings.Join(errs, "\n  "))
+}
+
+// NewCredential returns a Credential that starts with token, and asks p
+// for a new token when it expires.
+func NewCredential(ctx context.Context, t Target, p CredentialProvider, token *oauth2.Token) *Credential {
+	return &Credential{
+		TokenSource: oauth2.ReuseTokenSource(token, &providerTokenSource{
+			ctx:      ctx,
+			target:   t,
+			provider: p,
+		}),
+		Source: p.Name(),
+	}
+}
+
+// providerTokenSource adapts a CredentialProvider to an oauth2.TokenSource.
+type providerTokenSource struct {
+	ctx      context.Context
+	target   Target
+	provider CredentialProvider
+}
+
+func (s *providerTokenSource) Token() (*oauth2.Token, error) {
+	return s.provider.Token(s.ctx, s.target)
+}
+
+// staticToken returns a token that never expires.
+func staticToken(token string) *oauth2.Token {
+	return &oauth2.Token{AccessToken: token}
+}
+
+// EnvProvider reads the token from the GITHUB_TOKEN or GH_TOKEN environment
+// variables, or for Github Enterprise hosts, GH_ENTERPRISE_TOKEN or
+// GITHUB_ENTERPRISE_TOKEN. For GitLab hosts it reads GITLAB_TOKEN or
+// GITLAB_ACCESS_TOKEN, the variables used by the `glab` client, and for
+// Gitea hosts GITEA_TOKEN or FORGEJO_TOKEN.
+type EnvProvider struct{}
+
+func (p *EnvProvider) Name() string {
+	return "environment"
+}
+
+func (p *EnvProvider) Token(_ context.Context, target Target) (*oauth2.Token, error) {
+	var vars []string
+	switch {
+	case target.Forge == ForgeGitlab:
+		vars = []string{"GITLAB_TOKEN", "GITLAB_ACCESS_TOKEN"}
+	case target.Forge == ForgeGitea:
+		vars = []string{"GITEA_TOKEN", "FORGEJO_TOKEN"}
+	case isGithubDotCom(target.Host):
+		vars = []string{"GITHUB_TOKEN", "GH_TOKEN"}
+	default:
+		vars = []string{"GH_ENTERPRISE_TOKEN", "GITHUB_ENTERPRISE_TOKEN"}
+	}
+	for _, v := range vars {
+		if t := os.Getenv(v); t != "" {
+			return staticToken(t), nil
+		}
+	}
+	return nil, fmt.Errorf("%v not set", strings.Join(vars, " and "))
+}
+
+// GhHostsProvider reads the token from the hosts.yml file written by the
+// `gh` command line client.
+type GhHostsProvider struct {
+	// Path the hosts.yml file. When empty, uses the `gh` config directory.
+	Path string
+}
+
+func (p *GhHostsProvider) Name() string {
+	return "gh hosts.yml"
+}
+
+func (p *GhHostsProvider) Token(_ context.Context, target Target) (*oauth2.Token, error) {
+	if !target.IsGithub() {
+		return nil, errNotGithub(target)
+	}
+	path := p.Path
+	if path == "" {
+		dir, err := ghConfigDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(dir, "hosts.yml")
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts map[string]struct {
+		OauthToken string `yaml:"oauth_token"`
+	}
+	err = yaml.Unmarshal(b, &hosts)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse %v: %v", path, err)
+	}
+	h, ok := hosts[target.Host]
+	if !ok {
+		return nil, fmt.Errorf("no entry for %v in %v", target.Host, path)
+	}
+	if h.OauthToken == "" {
+		return nil, fmt.Errorf("no oauth_token for %v in %v, it may be in the system keyring", target.Host, path)
+	}
+	return staticToken(h.OauthToken), nil
+}
+
+// ghConfigDir returns the config directory used by the `gh` command.
+func ghConfigDir() (string, error) {
+	if d := os.Getenv("GH_CONFIG_DIR"); d != "" {
+		return d, nil
+	}
+	if d := os.Getenv("XDG_CONFIG_HOME"); d != "" {
+		return filepath.Join(d, "gh"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "gh"), nil
+}
+
+// GhCommandProvider gets the token from `gh auth token`, which can read
+// tokens that `gh` keeps in the system keyring.
+type GhCommandProvider struct {
+	// Dir the directory to run the command in.
+	Dir string
+}
+
+func (p *GhCommandProvider) Name() string {
+	return "gh auth token"
+}
+
+func (p *GhCommandProvider) Token(ctx context.Context, target Target) (*oauth2.Token, error) {
+	if !target.IsGithub() {
+		return nil, errNotGithub(target)
+	}
+	cmd := exec.CommandContext(ctx, "gh", "auth", "token", "--hostname", target.Host)
+	cmd.Dir = p.Dir
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get github token using gh: %v", err)
+	}
+	token := strings.Trim(string(output), "\n\r ")
+	if token == "" {
+		return nil, fmt.Errorf("gh returned an empty token")
+	}
+	return staticToken(token), nil
+}
+
+// GitCredentialProvider gets the token from the git credential helpers
+// using `git credential fill`. It works for any forge host.
+type GitCredentialProvider struct {
+	// Dir the directory to run the command in.
+	Dir string
+}
+
+func (p *GitCredentialProvider) Name() string {
+	return "git credential"
+}
+
+func (p *GitCredentialProvider) Token(ctx context.Context, target Target) (*oauth2.Token, error) {
+	cmd := exec.CommandContext(ctx, "git", "credential", "fill")
+	cmd.Dir = p.Dir
+	// Never prompt the user, only use credentials that are already stored.
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=", "SSH_ASKPASS=")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=https\nhost=%s\n\n", target.Host))
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git credential fill failed: %v", err)
+	}
+
+	s := bufio.NewScanner(strings.NewReader(string(output)))
+	for s.Scan() {
+		if v, ok := strings.CutPrefix(s.Text(), "password="); ok && v != "" {
+			return staticToken(v), nil
+		}
+	}
+	return nil, fmt.Errorf("no password returned by git credential fill")
+}
+
+// isGithubDotCom returns true when host is the public Github.
+func isGithubDotCom(host string) bool {
+	return host == "" || host == "github.com"
+}
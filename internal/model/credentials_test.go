@@ -0,0 +1,244 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestEnvProvider(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "")
+	t.Setenv("GH_TOKEN", "gh-token")
+	t.Setenv("GH_ENTERPRISE_TOKEN", "enterprise-token")
+	t.Setenv("GITLAB_TOKEN", "gitlab-token")
+	t.Setenv("GITEA_TOKEN", "")
+	t.Setenv("FORGEJO_TOKEN", "forgejo-token")
+
+	p := &EnvProvider{}
+	got, err := p.Token(context.Background(), Target{Host: "github.com"})
+	if err != nil || got.AccessToken != "gh-token" {
+		t.Errorf("github.com: got %v, %v, want gh-token", got, err)
+	}
+	got, err = p.Token(context.Background(), Target{Host: "github.example.com"})
+	if err != nil || got.AccessToken != "enterprise-token" {
+		t.Errorf("enterprise: got %v, %v, want enterprise-token", got, err)
+	}
+	got, err = p.Token(context.Background(), Target{Forge: ForgeGitlab, Host: "gitlab.example.com"})
+	if err != nil || got.AccessToken != "gitlab-token" {
+		t.Errorf("gitlab: got %v, %v, want gitlab-token", got, err)
+	}
+	got, err = p.Token(context.Background(), Target{Forge: ForgeGitea, Host: "gitea.example.com"})
+	if err != nil || got.AccessToken != "forgejo-token" {
+		t.Errorf("gitea: got %v, %v, want forgejo-token", got, err)
+	}
+}
+
+func TestGhHostsProvider(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GH_CONFIG_DIR", dir)
+	err := os.WriteFile(filepath.Join(dir, "hosts.yml"), []byte(
+		"github.com:\n"+
+			"    user: someone\n"+
+			"    oauth_token: gho_abc\n"+
+			"    git_protocol: ssh\n"+
+			"github.example.com:\n"+
+			"    user: someone\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &GhHostsProvider{}
+	got, err := p.Token(context.Background(), Target{Host: "github.com"})
+	if err != nil || got.AccessToken != "gho_abc" {
+		t.Errorf("github.com: got %v, %v, want gho_abc", got, err)
+	}
+	if _, err := p.Token(context.Background(), Target{Host: "github.example.com"}); err == nil {
+		t.Error("github.example.com: got nil, want error for missing token")
+	}
+	if _, err := p.Token(context.Background(), Target{Host: "other.example.com"}); err == nil {
+		t.Error("other.example.com: got nil, want error for missing host")
+	}
+	if _, err := p.Token(context.Background(), Target{Forge: ForgeGitlab, Host: "github.com"}); err == nil {
+		t.Error("gitlab: got nil, want error for a host that is not Github")
+	}
+}
+
+type fakeProvider struct {
+	name   string
+	token  string
+	expiry time.Time
+	calls  int
+}
+
+func (p *fakeProvider) Name() string {
+	return p.name
+}
+
+func (p *fakeProvider) Token(context.Context, Target) (*oauth2.Token, error) {
+	p.calls++
+	if p.token == "" {
+		return nil, os.ErrNotExist
+	}
+	return &oauth2.Token{AccessToken: fmt.Sprintf("%s-%d", p.token, p.calls), Expiry: p.expiry}, nil
+}
+
+func TestFindCredential(t *testing.T) {
+	providers := []CredentialProvider{
+		&fakeProvider{name: "first"},
+		&fakeProvider{name: "second", token: "two"},
+		&fakeProvider{name: "third", token: "three"},
+	}
+	got, err := FindCredential(context.Background(), Target{Host: "github.com"}, providers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, err := got.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Source != "second" || tok.AccessToken != "two-1" {
+		t.Fatalf("got %v %v, want the second provider", got.Source, tok.AccessToken)
+	}
+
+	_, err = FindCredential(context.Background(), Target{Host: "github.com"}, providers[:1])
+	if err == nil || !strings.Contains(err.Error(), "first") {
+		t.Fatalf("got %v, want error naming the first provider", err)
+	}
+}
+
+func TestCredentialRefresh(t *testing.T) {
+	p := &fakeProvider{name: "app", token: "inst", expiry: time.Now().Add(-time.Second)}
+	cred, err := FindCredential(context.Background(), Target{Host: "github.com"}, []CredentialProvider{p})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first token is already expired, so the provider is asked again.
+	tok, err := cred.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "inst-2" {
+		t.Fatalf("got %v, want a refreshed token inst-2", tok.AccessToken)
+	}
+
+	p.expiry = time.Now().Add(time.Hour)
+	tok, _ = cred.Token()
+	tok, _ = cred.Token()
+	if tok.AccessToken != "inst-3" {
+		t.Fatalf("got %v, want the valid token inst-3 reused", tok.AccessToken)
+	}
+}
+
+func TestAppJWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	jwt, err := appJWT(1234, key, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		t.Fatalf("got %d JWT parts, want 3", len(parts))
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hash[:], sig); err != nil {
+		t.Fatalf("bad signature: %v", err)
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims map[string]int64
+	if err := json.Unmarshal(b, &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims["iss"] != 1234 || claims["iat"] != now.Unix()-60 || claims["exp"] != now.Unix()+540 {
+		t.Fatalf("got claims %v", claims)
+	}
+}
+
+func TestAppProvider(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/o/r/installation", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			t.Errorf("got Authorization %q, want a bearer JWT", r.Header.Get("Authorization"))
+		}
+		fmt.Fprint(w, `{"id": 99}`)
+	})
+	mux.HandleFunc("/api/v3/app/installations/99/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"token": "ghs_installation", "expires_at": %q}`, expires.Format(time.RFC3339))
+	})
+	srv := httptest.NewTLSServer(mux)
+	defer srv.Close()
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, srv.Client())
+
+	p := &AppProvider{Config: AppConfig{ID: 1234, PrivateKeyPath: keyFile}}
+	tok, err := p.Token(ctx, Target{Host: strings.TrimPrefix(srv.URL, "https://"), Owner: "o", Name: "r"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "ghs_installation" {
+		t.Errorf("got token %v, want ghs_installation", tok.AccessToken)
+	}
+	if want := expires.Add(-appTokenRefresh); !tok.Expiry.Equal(want) {
+		t.Errorf("got expiry %v, want %v", tok.Expiry, want)
+	}
+
+	_, err = p.Token(ctx, Target{Host: "github.com"})
+	if err == nil {
+		t.Error("got nil, want error when the installation can't be found")
+	}
+}
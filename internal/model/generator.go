@@ -15,126 +15,69 @@
 package model
 
 import (
+	"context"
 	"fmt"
+	"iter"
 
 	"github.com/google/go-github/v51/github"
 )
 
-var EndOfList = fmt.Errorf("EndOfList")
+// ErrTooManyItems is returned by Collect when the list has more items than
+// the cap.
+var ErrTooManyItems = fmt.Errorf("too many items in list")
 
 // ListGenerator handles logic for iterating through github client
 // paged lists.
 type ListGenerator[ItemType any] struct {
-	// Retrieve should call the github client with the provided ListOptions
-	// to retrieve the next page.
-	Retrieve func(github.ListOptions) ([]*ItemType, *github.Response, error)
-	pg       *PagedListGenerator[string, ItemType]
+	// Retrieve should call the github client with ctx and the provided
+	// ListOptions to retrieve the next page.
+	Retrieve func(ctx context.Context, opts github.ListOptions) ([]*ItemType, *github.Response, error)
 }
 
-// init ensures that this ListGenerator's hidden internal PagedListGenerator
-// is initialized before any operations may proceed.
-func (g *ListGenerator[ItemType]) init() {
-	if g.pg != nil {
-		return
-	}
-	g.pg = &PagedListGenerator[string, ItemType]{
-		Retrieve: func(opts github.ListOptions) (*string, []*ItemType, *github.Response, error) {
-			v, res, err := g.Retrieve(opts)
-			return nil, v, res, err
-		},
-	}
-}
-
-// HasNext Returns true when the next item in the list exists.
-func (g *ListGenerator[GithubType]) HasNext() bool {
-	g.init()
-	return g.pg.HasNext()
-}
-
-// Next returns the next item in the list or error if the next page
-// cannot be retrieved or there are no more items.
-func (g *ListGenerator[GithubType]) Next() (*GithubType, error) {
-	g.init()
-	_, v, err := g.pg.Next()
-	return v, err
-}
-
-// PagedListGenerator handles logic for iterating through a Github Client paged
-// list where your code needs both the page object and the item object. GithubType
-// is the page object, ItemType is the item object.
-type PagedListGenerator[GithubType any, ItemType any] struct {
-	// Retrieve should call the github client with the provided ListOptions
-	// to retrieve the next page.
-	Retrieve  func(github.ListOptions) (*GithubType, []*ItemType, *github.Response, error)
-	index     int
-	nextPage  int
-	page      *GithubType
-	items     []*ItemType
-	opts      github.ListOptions
-	endOfList bool
-	lastPage  bool
-}
-
-// HasNext returns true when there are more items in the list.
-func (g *PagedListGenerator[GithubType, ItemType]) HasNext() bool {
-	if !g.endOfList {
-		g.getNextPage()
+// All returns an iterator over the items in the list, which retrieves the
+// pages as they are needed. When ctx is done or a page can't be retrieved,
+// the iterator yields the error and stops. Each call starts over from the
+// first page.
+func (g *ListGenerator[ItemType]) All(ctx context.Context) iter.Seq2[*ItemType, error] {
+	return func(yield func(*ItemType, error) bool) {
+		opts := github.ListOptions{}
+		for {
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+			items, res, err := g.Retrieve(ctx, opts)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			for _, item := range items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+			// NextPage is 0 on the last page.
+			if res == nil || res.NextPage == 0 {
+				return
+			}
+			opts.Page = res.NextPage
+		}
 	}
-	return !g.endOfList
 }
 
-// getNextPage is an internal method that attempts to load the next page
-// before HasNext() or Next() may return.
-func (g *PagedListGenerator[GithubType, ItemType]) getNextPage() error {
-	var (
-		res *github.Response
-		err error
-	)
-
-	if !g.lastPage && g.index >= len(g.items) {
-		// reset page index to 0
-		g.index = 0
-
-		// retrieve the next page
-		g.opts.Page = g.nextPage
-		g.page, g.items, res, err = g.Retrieve(g.opts)
+// Collect returns the items from seq, stopping at the first error. When max
+// is more than 0 and seq has more than max items, it returns the first max
+// items and ErrTooManyItems.
+func Collect[ItemType any](seq iter.Seq2[*ItemType, error], max int) ([]*ItemType, error) {
+	var items []*ItemType
+	for item, err := range seq {
 		if err != nil {
-			return err
+			return items, err
 		}
-		// update the last page and next page
-		g.lastPage = res.NextPage == 0
-		g.nextPage = res.NextPage // this will be 0 for the last page
-
-		// Update whether it has reached the end of the list
-		g.endOfList = g.index >= len(g.items) && g.lastPage
-	}
-
-	return nil
-}
-
-// Next returns a pointer the next item in the list, along with a pointer to
-// the current page. Returns error when the end of the list is reached, or when
-// there was a problem retrieving the next page.
-func (g *PagedListGenerator[GithubType, ItemType]) Next() (*GithubType, *ItemType, error) {
-	// End immediately if this is at the end of the list
-	if g.endOfList {
-		return nil, nil, EndOfList
-	}
-
-	// Get the next page if needed
-	err := g.getNextPage()
-	if err != nil {
-		return nil, nil, err
+		if max > 0 && len(items) == max {
+			return items, fmt.Errorf("%w: more than %d", ErrTooManyItems, max)
+		}
+		items = append(items, item)
 	}
-
-	// Pick the index for this item
-	thisIndex := g.index
-
-	// increment the index for the next call to Next()
-	g.index++
-
-	// Update whether it has reached the end of the list
-	g.endOfList = g.index >= len(g.items) && g.lastPage
-
-	return g.page, g.items[thisIndex], nil
+	return items, nil
 }
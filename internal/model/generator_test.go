@@ -15,57 +15,115 @@
 package model
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/google/go-github/v51/github"
 )
 
-func TestGenerator(t *testing.T) {
-	r := github.Response{}
-	g := ListGenerator[string]{
-		Retrieve: func(github.ListOptions) ([]*string, *github.Response, error) {
-			r.NextPage++
-			r.LastPage = 2
-			if r.NextPage == 2 {
-				r.NextPage = 0
+// pages returns a generator of the pages, which counts the pages it
+// retrieves in calls.
+func pages(calls *int, pages ...[]*string) *ListGenerator[string] {
+	return &ListGenerator[string]{
+		Retrieve: func(ctx context.Context, opts github.ListOptions) ([]*string, *github.Response, error) {
+			*calls++
+			n := opts.Page
+			if n == 0 {
+				n = 1
+			}
+			res := &github.Response{LastPage: len(pages)}
+			if n < len(pages) {
+				res.NextPage = n + 1
 			}
-			return []*string{ptr("one"), ptr("two"), ptr("three")}, &r, nil
+			return pages[n-1], res, nil
 		},
 	}
-	want := 6
-	got := 0
-	for g.HasNext() {
-		g.Next()
-		got++
+}
+
+func TestGenerator(t *testing.T) {
+	var calls int
+	g := pages(&calls, []*string{ptr("one"), ptr("two"), ptr("three")}, []*string{ptr("four"), ptr("five"), ptr("six")})
+	var got []string
+	for s, err := range g.All(context.Background()) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, *s)
+	}
+	if want := "[one two three four five six]"; fmt.Sprint(got) != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// Stopping early does not retrieve the next page.
+	calls = 0
+	for range g.All(context.Background()) {
+		break
 	}
-	if got != want {
-		t.Fatalf("got %v, want %v items", got, want)
+	if calls != 1 {
+		t.Errorf("got %d pages retrieved after break, want 1", calls)
 	}
 }
 
 func TestGeneratorEmptyList(t *testing.T) {
-	r := github.Response{}
-	g := ListGenerator[string]{
-		Retrieve: func(github.ListOptions) ([]*string, *github.Response, error) {
-			r.NextPage = 0
-			r.LastPage = 0
-			return []*string{}, &r, nil
+	var calls int
+	g := pages(&calls, []*string{})
+	items, err := Collect(g.All(context.Background()), 0)
+	if err != nil || len(items) != 0 {
+		t.Fatalf("got %v, %v, want no items", items, err)
+	}
+}
+
+func TestGeneratorPageError(t *testing.T) {
+	wantErr := errors.New("rate limited")
+	g := &ListGenerator[string]{
+		Retrieve: func(ctx context.Context, opts github.ListOptions) ([]*string, *github.Response, error) {
+			if opts.Page == 2 {
+				return nil, nil, wantErr
+			}
+			return []*string{ptr("one")}, &github.Response{NextPage: 2}, nil
 		},
 	}
-	want := 0
-	got := 0
-	for g.HasNext() {
-		g.Next()
-		got++
+	items, err := Collect(g.All(context.Background()), 0)
+	if !errors.Is(err, wantErr) || len(items) != 1 {
+		t.Fatalf("got %v, %v, want the first page and the error", items, err)
 	}
-	if got != want {
-		t.Fatalf("got %v, want %v items", got, want)
+}
+
+func TestGeneratorCanceled(t *testing.T) {
+	var calls int
+	g := pages(&calls, []*string{ptr("one")}, []*string{ptr("two")})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var got []string
+	var err error
+	for s, e := range g.All(ctx) {
+		if e != nil {
+			err = e
+			break
+		}
+		got = append(got, *s)
+		cancel()
 	}
-	_, err := g.Next()
-	if err != EndOfList {
-		t.Fatalf("got %v, want %v items", err, EndOfList)
+	if !errors.Is(err, context.Canceled) || fmt.Sprint(got) != "[one]" || calls != 1 {
+		t.Fatalf("got %v, %v after %d pages, want one item and context.Canceled", got, err, calls)
 	}
 }
+
+func TestCollectMax(t *testing.T) {
+	var calls int
+	g := pages(&calls, []*string{ptr("one"), ptr("two")}, []*string{ptr("three")})
+	items, err := Collect(g.All(context.Background()), 3)
+	if err != nil || len(items) != 3 {
+		t.Errorf("got %d items, %v, want all 3", len(items), err)
+	}
+	items, err = Collect(g.All(context.Background()), 2)
+	if !errors.Is(err, ErrTooManyItems) || len(items) != 2 {
+		t.Errorf("got %d items, %v, want 2 and ErrTooManyItems", len(items), err)
+	}
+}
+
 func ptr(s string) *string {
 	return &s
 }
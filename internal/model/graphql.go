@@ -0,0 +1,73 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/v51/github"
+)
+
+// GraphQL runs a Github GraphQL query or mutation with variables using the
+// client's transport, and unmarshals the data in the response into out.
+// Some Github features, like the merge queue and auto-merge, are only in
+// the GraphQL API.
+func GraphQL(ctx context.Context, client *github.Client, query string, variables map[string]any, out any) error {
+	req, err := client.NewRequest("POST", graphQLURL(client.BaseURL), map[string]any{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return err
+	}
+
+	var res struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	_, err = client.Do(ctx, req, &res)
+	if err != nil {
+		return err
+	}
+	if len(res.Errors) > 0 {
+		var msgs []string
+		for _, e := range res.Errors {
+			msgs = append(msgs, e.Message)
+		}
+		return fmt.Errorf("graphql: %v", strings.Join(msgs, "; "))
+	}
+	if out == nil || len(res.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(res.Data, out)
+}
+
+// graphQLURL returns the GraphQL endpoint for the REST API base URL. Github
+// Enterprise serves the REST API at /api/v3/ and GraphQL at /api/graphql.
+func graphQLURL(base *url.URL) string {
+	u := *base
+	if p, ok := strings.CutSuffix(u.Path, "/v3/"); ok {
+		u.Path = p + "/graphql"
+		return u.String()
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/graphql"
+	return u.String()
+}
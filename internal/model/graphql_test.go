@@ -0,0 +1,83 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v51/github"
+)
+
+func TestGraphQLURL(t *testing.T) {
+	for base, want := range map[string]string{
+		"https://api.github.com/":              "https://api.github.com/graphql",
+		"https://github.example.com/api/v3/":   "https://github.example.com/api/graphql",
+		"http://127.0.0.1:8080/":               "http://127.0.0.1:8080/graphql",
+		"http://127.0.0.1:8080/prefix/api/v3/": "http://127.0.0.1:8080/prefix/api/graphql",
+	} {
+		u, _ := url.Parse(base)
+		if got := graphQLURL(u); got != want {
+			t.Errorf("graphQLURL(%v) got %v, want %v", base, got, want)
+		}
+	}
+}
+
+func TestGraphQL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/api/graphql" {
+			t.Errorf("got %v %v", r.Method, r.URL.Path)
+		}
+		var req struct {
+			Query     string         `json:"query"`
+			Variables map[string]any `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if strings.Contains(req.Query, "fail") {
+			fmt.Fprint(w, `{"data": null, "errors": [{"message": "first"}, {"message": "second"}]}`)
+			return
+		}
+		fmt.Fprintf(w, `{"data": {"node": {"id": %q}}}`, req.Variables["id"])
+	}))
+	defer srv.Close()
+
+	client, err := github.NewEnterpriseClient(srv.URL+"/api/v3/", srv.URL+"/api/uploads/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Node struct {
+			ID string `json:"id"`
+		} `json:"node"`
+	}
+	err = GraphQL(context.Background(), client, "query($id: ID!) { node(id: $id) { id } }", map[string]any{"id": "PR_1"}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Node.ID != "PR_1" {
+		t.Errorf("got node id %q", out.Node.ID)
+	}
+
+	err = GraphQL(context.Background(), client, "query { fail }", nil, nil)
+	if err == nil || err.Error() != "graphql: first; second" {
+		t.Errorf("got error %v", err)
+	}
+}
@@ -0,0 +1,331 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxRetries is the number of times a request is retried.
+	DefaultMaxRetries = 5
+	// DefaultMaxWait is the longest the transport will wait for a rate
+	// limit to reset.
+	DefaultMaxWait = time.Hour
+
+	// secondaryLimitWait is the wait for secondary rate limits without a
+	// Retry-After header, as recommended by the Github docs.
+	secondaryLimitWait = time.Minute
+	// retryBaseWait is the first wait between retries of failed requests.
+	retryBaseWait = time.Second
+)
+
+// RateLimitTransport is an http.RoundTripper for the Github API that tracks
+// the remaining rate limit quota of each API resource, like core, search and
+// graphql. It waits until the quota of a resource resets when it is used up,
+// honors Retry-After on secondary rate limits, and retries idempotent
+// requests that fail with server errors using jittered exponential backoff.
+type RateLimitTransport struct {
+	// Base the transport used to make requests. Defaults to
+	// http.DefaultTransport.
+	Base http.RoundTripper
+	// MaxRetries the number of times a request is retried.
+	MaxRetries int
+	// MaxWait the longest to wait for a rate limit. When the wait would be
+	// longer, the rate limited response is returned.
+	MaxWait time.Duration
+
+	// sleep waits for d or until ctx is done. Replaced in tests.
+	sleep func(ctx context.Context, d time.Duration) error
+	// now returns the current time. Replaced in tests.
+	now func() time.Time
+
+	mu sync.Mutex
+	// limits the quota of each resource, from the X-RateLimit-Resource
+	// header.
+	limits    map[string]*rateLimit
+	throttled int
+	waited    time.Duration
+}
+
+// rateLimit is the quota of one resource.
+type rateLimit struct {
+	remaining int
+	reset     time.Time
+}
+
+// NewRateLimitTransport returns a RateLimitTransport using base with the
+// default limits.
+func NewRateLimitTransport(base http.RoundTripper) *RateLimitTransport {
+	return &RateLimitTransport{
+		Base:       base,
+		MaxRetries: DefaultMaxRetries,
+		MaxWait:    DefaultMaxWait,
+	}
+}
+
+// Throttled returns the number of times requests waited and the total time
+// spent waiting.
+func (t *RateLimitTransport) Throttled() (int, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.throttled, t.waited
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *RateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	resource := requestResource(req)
+
+	// Wait before sending when the quota is known to be used up.
+	if d := t.untilReset(resource); d > 0 {
+		if err := t.wait(ctx, resource, d, "rate limit exhausted"); err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		r, err := rewind(req)
+		if err != nil {
+			return nil, err
+		}
+		res, err := t.base().RoundTrip(r)
+		if attempt >= t.MaxRetries {
+			return res, err
+		}
+
+		var d time.Duration
+		var reason string
+		switch {
+		case err != nil:
+			if !idempotent(req.Method) || ctx.Err() != nil {
+				return nil, err
+			}
+			d, reason = t.backoff(attempt), fmt.Sprintf("request failed: %v", err)
+
+		case res.StatusCode == http.StatusForbidden || res.StatusCode == http.StatusTooManyRequests:
+			resource = t.update(resource, res)
+			d, reason = t.limitWait(resource, res)
+			if d == 0 {
+				return res, nil
+			}
+
+		case res.StatusCode >= 500 && idempotent(req.Method):
+			d, reason = t.backoff(attempt), fmt.Sprintf("server error %v", res.Status)
+
+		default:
+			resource = t.update(resource, res)
+			// go-github refuses to send requests while its last response
+			// shows the quota is used up, so wait for the reset here.
+			if d := t.untilReset(resource); d > 0 && d <= t.maxWait() {
+				if err := t.wait(ctx, resource, d, "rate limit exhausted"); err != nil {
+					res.Body.Close()
+					return nil, err
+				}
+			}
+			return res, nil
+		}
+
+		if d > t.maxWait() {
+			if res != nil {
+				return res, err
+			}
+			return nil, err
+		}
+		if res != nil {
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+		if err := t.wait(ctx, resource, d, reason); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// limitWait returns how long to wait before retrying a 403 or 429 response,
+// or 0 if it was not caused by a rate limit.
+func (t *RateLimitTransport) limitWait(resource string, res *http.Response) (time.Duration, string) {
+	if s := res.Header.Get("Retry-After"); s != "" {
+		if secs, err := strconv.Atoi(s); err == nil {
+			return time.Duration(secs) * time.Second, "secondary rate limit, retry after " + s + "s"
+		}
+	}
+	if res.Header.Get("X-RateLimit-Remaining") == "0" {
+		if d := t.untilReset(resource); d > 0 {
+			return d, resource + " rate limit exhausted"
+		}
+		return time.Second, resource + " rate limit exhausted"
+	}
+
+	// Secondary rate limits without a Retry-After header can only be
+	// recognized by the error message.
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	if err == nil && strings.Contains(strings.ToLower(string(body)), "secondary rate limit") {
+		return secondaryLimitWait, "secondary rate limit"
+	}
+	return 0, ""
+}
+
+// requestResource guesses the rate limit resource of req from its path,
+// until the response names it.
+func requestResource(req *http.Request) string {
+	p := req.URL.Path
+	switch {
+	case strings.HasSuffix(p, "/graphql"):
+		return "graphql"
+	case strings.HasPrefix(p, "/search/") || strings.HasPrefix(p, "/api/v3/search/"):
+		return "search"
+	}
+	return "core"
+}
+
+// update records the rate limit quota from the response headers, and
+// returns the resource the response counted against.
+func (t *RateLimitTransport) update(resource string, res *http.Response) string {
+	if r := res.Header.Get("X-RateLimit-Resource"); r != "" {
+		resource = r
+	}
+	remaining, err := strconv.Atoi(res.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return resource
+	}
+	reset, err := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return resource
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.limits == nil {
+		t.limits = map[string]*rateLimit{}
+	}
+	t.limits[resource] = &rateLimit{remaining: remaining, reset: time.Unix(reset, 0)}
+	return resource
+}
+
+// untilReset returns how long until the quota of resource resets when it is
+// used up, otherwise 0.
+func (t *RateLimitTransport) untilReset(resource string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l, ok := t.limits[resource]
+	if !ok || l.remaining != 0 {
+		return 0
+	}
+	d := l.reset.Sub(t.clock())
+	if d <= 0 {
+		return 0
+	}
+	// Allow for clock drift between this machine and Github.
+	return d + time.Second
+}
+
+// backoff returns the jittered wait before retry number attempt.
+func (t *RateLimitTransport) backoff(attempt int) time.Duration {
+	d := retryBaseWait << attempt
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// wait logs and records the throttling, then sleeps for d.
+func (t *RateLimitTransport) wait(ctx context.Context, resource string, d time.Duration, reason string) error {
+	log.Printf("Github API throttled: %v, waiting %v", reason, d.Round(time.Second))
+	t.mu.Lock()
+	t.throttled++
+	t.waited += d
+	t.mu.Unlock()
+
+	sleep := t.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+	if err := sleep(ctx, d); err != nil {
+		return err
+	}
+
+	// The quota is unknown until the next response.
+	t.mu.Lock()
+	delete(t.limits, resource)
+	t.mu.Unlock()
+	return nil
+}
+
+func (t *RateLimitTransport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+func (t *RateLimitTransport) maxWait() time.Duration {
+	if t.MaxWait > 0 {
+		return t.MaxWait
+	}
+	return DefaultMaxWait
+}
+
+func (t *RateLimitTransport) clock() time.Time {
+	if t.now != nil {
+		return t.now()
+	}
+	return time.Now()
+}
+
+// rewind returns a copy of req with a fresh body so that it can be sent
+// again.
+func rewind(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.GetBody == nil {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	r := req.Clone(req.Context())
+	r.Body = body
+	return r, nil
+}
+
+// idempotent returns true for request methods that are safe to retry after
+// a failure.
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// sleepContext waits for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
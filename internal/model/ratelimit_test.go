@@ -0,0 +1,254 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testTransport returns a RateLimitTransport for srv that records sleeps
+// instead of sleeping.
+func testTransport(now time.Time, sleeps *[]time.Duration) *RateLimitTransport {
+	t := NewRateLimitTransport(http.DefaultTransport)
+	t.now = func() time.Time { return now }
+	t.sleep = func(_ context.Context, d time.Duration) error {
+		*sleeps = append(*sleeps, d)
+		return nil
+	}
+	return t
+}
+
+// serve responds with each handler in turn.
+func serve(t *testing.T, handlers ...http.HandlerFunc) (*httptest.Server, *int) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls >= len(handlers) {
+			t.Fatalf("unexpected request %d", calls+1)
+		}
+		h := handlers[calls]
+		calls++
+		h(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func ok(w http.ResponseWriter, _ *http.Request) {
+	fmt.Fprint(w, "ok")
+}
+
+func TestRateLimitPrimary(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	reset := fmt.Sprint(now.Add(30 * time.Second).Unix())
+	srv, calls := serve(t,
+		func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", reset)
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message": "API rate limit exceeded"}`)
+		},
+		ok)
+
+	var sleeps []time.Duration
+	tr := testTransport(now, &sleeps)
+	res, err := (&http.Client{Transport: tr}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || *calls != 2 {
+		t.Fatalf("got status %v after %d calls, want 200 after 2", res.StatusCode, *calls)
+	}
+	if len(sleeps) != 1 || sleeps[0] != 31*time.Second {
+		t.Fatalf("got sleeps %v, want [31s]", sleeps)
+	}
+	if n, d := tr.Throttled(); n != 1 || d != 31*time.Second {
+		t.Fatalf("got throttled %d %v, want 1 31s", n, d)
+	}
+}
+
+func TestRateLimitLastRequestWaitsForReset(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	srv, _ := serve(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", fmt.Sprint(now.Add(time.Minute).Unix()))
+		fmt.Fprint(w, "last one")
+	})
+
+	var sleeps []time.Duration
+	res, err := (&http.Client{Transport: testTransport(now, &sleeps)}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(res.Body)
+	if string(b) != "last one" {
+		t.Fatalf("got body %q", b)
+	}
+	if len(sleeps) != 1 || sleeps[0] != 61*time.Second {
+		t.Fatalf("got sleeps %v, want [61s]", sleeps)
+	}
+}
+
+func TestRateLimitPerResource(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	graphql := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/graphql" {
+			t.Errorf("got path %v, want /graphql", r.URL.Path)
+		}
+		w.Header().Set("X-RateLimit-Resource", "graphql")
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", fmt.Sprint(now.Add(time.Minute).Unix()))
+		fmt.Fprint(w, "{}")
+	}
+	srv, calls := serve(t, graphql,
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-RateLimit-Resource", "core")
+			w.Header().Set("X-RateLimit-Remaining", "4999")
+			w.Header().Set("X-RateLimit-Reset", fmt.Sprint(now.Add(time.Hour).Unix()))
+			ok(w, r)
+		},
+		graphql)
+
+	var sleeps []time.Duration
+	tr := testTransport(now, &sleeps)
+	tr.MaxWait = 10 * time.Second
+	c := &http.Client{Transport: tr}
+	if _, err := c.Post(srv.URL+"/graphql", "application/json", strings.NewReader("{}")); err != nil {
+		t.Fatal(err)
+	}
+	// The used up graphql quota doesn't hold back the REST API.
+	if _, err := c.Get(srv.URL + "/repos/example/widget"); err != nil {
+		t.Fatal(err)
+	}
+	if len(sleeps) != 0 {
+		t.Fatalf("got sleeps %v, want none", sleeps)
+	}
+	if _, err := c.Post(srv.URL+"/graphql", "application/json", strings.NewReader("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 3 || len(sleeps) != 1 || sleeps[0] != 61*time.Second {
+		t.Fatalf("got sleeps %v after %d calls, want [61s] after 3", sleeps, *calls)
+	}
+}
+
+func TestRateLimitSecondaryRetryAfter(t *testing.T) {
+	srv, calls := serve(t,
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusForbidden)
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			if string(b) != `{"event":"APPROVE"}` {
+				t.Errorf("got retried body %q", b)
+			}
+			ok(w, r)
+		})
+
+	var sleeps []time.Duration
+	c := &http.Client{Transport: testTransport(time.Now(), &sleeps)}
+	res, err := c.Post(srv.URL, "application/json", strings.NewReader(`{"event":"APPROVE"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || *calls != 2 {
+		t.Fatalf("got status %v after %d calls, want 200 after 2", res.StatusCode, *calls)
+	}
+	if len(sleeps) != 1 || sleeps[0] != 7*time.Second {
+		t.Fatalf("got sleeps %v, want [7s]", sleeps)
+	}
+}
+
+func TestRateLimitSecondaryMessage(t *testing.T) {
+	srv, _ := serve(t,
+		func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message": "You have exceeded a secondary rate limit."}`)
+		},
+		ok)
+
+	var sleeps []time.Duration
+	res, err := (&http.Client{Transport: testTransport(time.Now(), &sleeps)}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got status %v, want 200", res.StatusCode)
+	}
+	if len(sleeps) != 1 || sleeps[0] != secondaryLimitWait {
+		t.Fatalf("got sleeps %v, want [%v]", sleeps, secondaryLimitWait)
+	}
+}
+
+func TestRateLimitForbiddenIsNotRetried(t *testing.T) {
+	srv, calls := serve(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "Resource not accessible by integration"}`)
+	})
+
+	var sleeps []time.Duration
+	res, err := (&http.Client{Transport: testTransport(time.Now(), &sleeps)}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusForbidden || !strings.Contains(string(b), "not accessible") {
+		t.Fatalf("got %v %q, want the 403 response", res.StatusCode, b)
+	}
+	if *calls != 1 || len(sleeps) != 0 {
+		t.Fatalf("got %d calls and sleeps %v, want 1 call and no sleeps", *calls, sleeps)
+	}
+}
+
+func TestRateLimitServerErrorRetries(t *testing.T) {
+	fail := func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	srv, calls := serve(t, fail, fail, ok)
+
+	var sleeps []time.Duration
+	res, err := (&http.Client{Transport: testTransport(time.Now(), &sleeps)}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || *calls != 3 {
+		t.Fatalf("got status %v after %d calls, want 200 after 3", res.StatusCode, *calls)
+	}
+	if len(sleeps) != 2 {
+		t.Fatalf("got sleeps %v, want 2", sleeps)
+	}
+	for i, d := range sleeps {
+		max := retryBaseWait << i
+		if d < max/2 || d > max {
+			t.Errorf("got sleep %d of %v, want between %v and %v", i, d, max/2, max)
+		}
+	}
+
+	// Server errors for non-idempotent requests are returned.
+	srv, calls = serve(t, fail)
+	res, err = (&http.Client{Transport: testTransport(time.Now(), &sleeps)}).Post(srv.URL, "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusBadGateway || *calls != 1 {
+		t.Fatalf("got status %v after %d calls, want 502 after 1", res.StatusCode, *calls)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+	"github.com/hessjcg/git-gtool/internal/gitrepo"
+)
+
+// autoMergePRs approves the workflow runs and each open Renovate PR, then
+// enables Github auto-merge so that Github merges the PRs when their checks
+// pass. When wait is true, it then polls until Github is done with the PRs.
+func autoMergePRs(ctx context.Context, r *gitrepo.GitRepo, cfg *mergeConfig, dryRun, wait bool) error {
+	renovatePrs, err := listRenovatePrs(ctx, r, cfg)
+	if err != nil {
+		return err
+	}
+	if len(renovatePrs) == 0 {
+		log.Printf("No open Renovate PRs.")
+		return nil
+	}
+
+	var m mutator = &forgeMutator{f: r.Forge}
+	if dryRun {
+		m = &dryRunMutator{}
+	}
+	var enabled []*forge.PullRequest
+	for _, pr := range renovatePrs {
+		log.Printf("#%4d %s", pr.Number, pr.Title)
+		merged, queued := cfg.merged, cfg.queued
+		err := enableAutoMerge(ctx, r, m, cfg, pr)
+		if err != nil {
+			log.Printf("  can't enable auto-merge: %v", err)
+			cfg.report.addSkipped(pr, fmt.Sprintf("can't enable auto-merge: %v", err))
+			continue
+		}
+		// mergePr already recorded the PRs it merged or added to the queue.
+		switch {
+		case dryRun:
+			cfg.report.addPlanned(pr)
+		case cfg.merged == merged && cfg.queued == queued:
+			cfg.report.addAutoMerge(pr)
+		}
+		enabled = append(enabled, pr)
+	}
+	log.Printf("Enabled auto-merge on %d of %d PRs", len(enabled), len(renovatePrs))
+
+	if !wait || dryRun || len(enabled) == 0 {
+		return nil
+	}
+	return waitForAutoMerge(ctx, r, cfg, enabled)
+}
+
+// enableAutoMerge approves the pending workflow runs and pr, and turns on
+// auto-merge. Github refuses to enable auto-merge on a PR that can already
+// be merged, so those are merged right away.
+func enableAutoMerge(ctx context.Context, r *gitrepo.GitRepo, m mutator, cfg *mergeConfig, pr *forge.PullRequest) error {
+	err := approveWorkflowRuns(ctx, r, m, cfg.state, pr)
+	if err != nil {
+		return err
+	}
+	err = approvePr(ctx, r, m, pr)
+	if err != nil {
+		return err
+	}
+	// Gitea does not report scheduled merges, so there AutoMerge is only
+	// true for the PRs scheduled by this process. A PR scheduled by an
+	// earlier run is scheduled again.
+	if pr.AutoMerge {
+		log.Printf("  auto-merge is already enabled")
+		return nil
+	}
+
+	title, body, err := commitMessage(ctx, r, cfg, pr)
+	if err != nil {
+		return err
+	}
+	err = m.enableAutoMerge(ctx, pr, forge.MergeOptions{Method: cfg.method, Title: title, Body: body})
+	if errors.Is(err, forge.ErrCanMergeNow) {
+		log.Printf("  #%d can be merged now", pr.Number)
+		err = mergePr(ctx, r, m, cfg, pr)
+		if errors.Is(err, ErrInMergeQueue) {
+			return nil
+		}
+	}
+	return err
+}
+
+// waitForAutoMerge polls prs until Github merges or closes each of them, or
+// auto-merge is turned off, logging each PR as it lands. Gives up when no PR
+// lands within the max wait.
+func waitForAutoMerge(ctx context.Context, r *gitrepo.GitRepo, cfg *mergeConfig, prs []*forge.PullRequest) error {
+	start := time.Now()
+	var merged int
+	remaining := prs
+	for len(remaining) > 0 {
+		err := cfg.waiter.wait(ctx, &pendingError{
+			err:  fmt.Errorf("auto-merge pending"),
+			what: fmt.Sprintf("the forge to merge %d PRs", len(remaining)),
+			ready: func(ctx context.Context) (bool, error) {
+				var still []*forge.PullRequest
+				for _, pr := range remaining {
+					full, err := r.Forge.GetPullRequest(ctx, pr.Number)
+					if err != nil {
+						return false, err
+					}
+					switch {
+					case full.Merged:
+						log.Printf("#%4d merged %v", full.Number, full.Title)
+						cfg.report.addMerged(full, full.MergeCommitSHA)
+						merged++
+					case full.State == "closed":
+						log.Printf("#%4d closed without merging", full.Number)
+						cfg.report.addSkipped(full, "closed without merging")
+					// On Gitea, AutoMerge stays true for the PRs in prs since
+					// this process scheduled them, so this case never happens.
+					case !full.AutoMerge:
+						log.Printf("#%4d auto-merge was turned off, it needs attention", full.Number)
+						cfg.report.addSkipped(full, "auto-merge was turned off")
+					default:
+						still = append(still, full)
+					}
+				}
+				changed := len(still) < len(remaining)
+				remaining = still
+				return changed, nil
+			},
+		})
+		if errors.Is(err, context.Canceled) {
+			log.Printf("Stopped.")
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("stopped with %d PRs waiting to merge: %v", len(remaining), err)
+		}
+	}
+	log.Printf("Merged %d PRs in %v", merged, time.Since(start).Round(time.Second))
+	return nil
+}
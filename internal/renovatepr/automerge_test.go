@@ -0,0 +1,112 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+	"github.com/hessjcg/git-gtool/internal/forge/forgetest"
+	"github.com/hessjcg/git-gtool/internal/gitrepo"
+)
+
+func TestWaitForAutoMerge(t *testing.T) {
+	// Each PR lands after it has been polled this many times.
+	landsAfter := map[int]int{1: 1, 2: 3, 3: 2}
+	polls := map[int]int{}
+	f := forgetest.New("o", "r")
+	for n := range landsAfter {
+		f.AddPR(&forge.PullRequest{Number: n, AutoMerge: true})
+	}
+	f.OnGet = func(pr *forge.PullRequest) {
+		polls[pr.Number]++
+		if polls[pr.Number] < landsAfter[pr.Number] {
+			return
+		}
+		switch pr.Number {
+		case 1:
+			pr.State, pr.Merged = "closed", true
+		case 2:
+			pr.AutoMerge = false
+		case 3:
+			pr.State = "closed"
+		}
+	}
+	r := &gitrepo.GitRepo{Forge: f, Owner: "o", Name: "r"}
+	var sleeps int
+	cfg := &mergeConfig{
+		waiter: &waiter{
+			interval:    time.Second,
+			maxInterval: time.Second,
+			maxWait:     time.Minute,
+			sleep: func(context.Context, time.Duration) error {
+				sleeps++
+				return nil
+			},
+		},
+		report: newReportBuilder(),
+	}
+	prs := []*forge.PullRequest{{Number: 1}, {Number: 2}, {Number: 3}}
+
+	err := waitForAutoMerge(context.Background(), r, cfg, prs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sleeps != 3 {
+		t.Errorf("got %d polls, want 3", sleeps)
+	}
+	for n, want := range landsAfter {
+		if polls[n] != want {
+			t.Errorf("PR %v polled %d times, want %d", n, polls[n], want)
+		}
+	}
+	report := cfg.report.report(0, false)
+	if len(report.Merged) != 1 || report.Merged[0].Number != 1 {
+		t.Errorf("got merged %v, want #1", report.Merged)
+	}
+	if len(report.Skipped) != 2 || report.Skipped[0].Reason != "auto-merge was turned off" || report.Skipped[1].Reason != "closed without merging" {
+		t.Errorf("got skipped %v, want #2 and #3", report.Skipped)
+	}
+}
+
+func TestMergePRsAutoMerge(t *testing.T) {
+	f := forgetest.New("example", "widget")
+	f.Rules["main"] = &forge.BranchRules{Checks: []forge.RequiredCheck{{Context: "build"}}}
+	f.AddPR(&forge.PullRequest{Number: 1, Title: "update module a to v1.2.0", Author: "renovate-bot", HeadRef: "renovate/a"})
+	f.WorkflowRuns = []*forge.WorkflowRun{{ID: 42, HeadBranch: "renovate/a", HeadSHA: "sha-1", Status: "action_required"}}
+	gitDir := t.TempDir()
+
+	opts := fastOptions()
+	opts.AutoMerge = true
+	report, err := MergePRs(context.Background(), &gitrepo.GitRepo{Forge: f, Owner: "example", Name: "widget", GitDir: gitDir}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.AutoMerge) != 1 || report.AutoMerge[0].Number != 1 || len(report.Queued) != 0 {
+		t.Errorf("got auto-merge %v queued %v, want #1 set to auto-merge", report.AutoMerge, report.Queued)
+	}
+
+	// The approved workflow run is saved for the next run.
+	state, err := loadState(filepath.Join(gitDir, StateFile), "example/widget", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := state.PRs[1]; p == nil || len(p.ApprovedRuns) != 1 || p.ApprovedRuns[0] != 42 {
+		t.Errorf("got saved state %+v, want run 42 approved for #1", p)
+	}
+}
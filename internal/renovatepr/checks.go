@@ -0,0 +1,312 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+	"github.com/hessjcg/git-gtool/internal/gitrepo"
+)
+
+// CheckState is the state of a commit status or check run, normalized from
+// the many states and conclusions that Github reports.
+type CheckState string
+
+const (
+	// CheckPending the check has not finished.
+	CheckPending CheckState = "pending"
+	// CheckSuccess the check passed.
+	CheckSuccess CheckState = "success"
+	// CheckFailure the check failed, errored, was cancelled or timed out.
+	CheckFailure CheckState = "failure"
+	// CheckNeutral the check finished as neutral or was skipped. CheckPolicy
+	// decides what a neutral check counts as.
+	CheckNeutral CheckState = "neutral"
+)
+
+// Check is the normalized result of a commit status or a check run.
+type Check struct {
+	// Name the status context or check run name.
+	Name string `json:"name"`
+	// AppID the Github App that created the check run, 0 for statuses.
+	AppID int64 `json:"appId,omitempty"`
+	// State the normalized state.
+	State CheckState `json:"state"`
+	// Result the state or conclusion reported by Github, like timed_out.
+	Result string `json:"result"`
+	// URL the page with the details of the check.
+	URL string `json:"url,omitempty"`
+}
+
+// statusCheck normalizes a commit status. Statuses report pending, success,
+// failure or error.
+func statusCheck(s *forge.Status) Check {
+	c := Check{
+		Name:   s.Context,
+		Result: s.State,
+		URL:    s.URL,
+	}
+	switch s.State {
+	case "success":
+		c.State = CheckSuccess
+	case "pending":
+		c.State = CheckPending
+	default:
+		c.State = CheckFailure
+	}
+	return c
+}
+
+// checkRunCheck normalizes a check run. Check runs that are not completed
+// are pending, completed check runs report a conclusion.
+func checkRunCheck(r *forge.CheckRun) Check {
+	c := Check{
+		Name:   r.Name,
+		AppID:  r.AppID,
+		Result: r.Conclusion,
+		URL:    r.URL,
+	}
+	if r.Status != "completed" || r.Conclusion == "" {
+		c.Result = r.Status
+		c.State = CheckPending
+		return c
+	}
+	switch r.Conclusion {
+	case "success":
+		c.State = CheckSuccess
+	case "neutral", "skipped":
+		c.State = CheckNeutral
+	default:
+		// failure, cancelled, timed_out, action_required, stale and
+		// startup_failure all need someone to look at the PR.
+		c.State = CheckFailure
+	}
+	return c
+}
+
+// CheckPolicy decides what neutral and skipped check runs count as.
+type CheckPolicy struct {
+	// Neutral the state of check runs that conclude as neutral.
+	Neutral CheckState
+	// Skipped the state of check runs that were skipped.
+	Skipped CheckState
+}
+
+// DefaultCheckPolicy counts neutral and skipped check runs as passing, like
+// Github branch protection does.
+var DefaultCheckPolicy = CheckPolicy{
+	Neutral: CheckSuccess,
+	Skipped: CheckSuccess,
+}
+
+// newCheckPolicy returns the policy for the neutral and skipped options,
+// using DefaultCheckPolicy for the ones that are empty.
+func newCheckPolicy(neutral, skipped string) (CheckPolicy, error) {
+	p := DefaultCheckPolicy
+	var err error
+	if neutral != "" {
+		p.Neutral, err = parsePolicyState(neutral)
+		if err != nil {
+			return p, fmt.Errorf("bad neutral check policy: %v", err)
+		}
+	}
+	if skipped != "" {
+		p.Skipped, err = parsePolicyState(skipped)
+		if err != nil {
+			return p, fmt.Errorf("bad skipped check policy: %v", err)
+		}
+	}
+	return p, nil
+}
+
+// parsePolicyState parses the state that a neutral or skipped check counts as.
+func parsePolicyState(s string) (CheckState, error) {
+	switch st := CheckState(s); st {
+	case CheckSuccess, CheckFailure, CheckPending:
+		return st, nil
+	}
+	return "", fmt.Errorf("unknown state %q, use %v, %v or %v", s, CheckSuccess, CheckFailure, CheckPending)
+}
+
+// resolve returns the state that c counts as under this policy.
+func (p CheckPolicy) resolve(c Check) CheckState {
+	if c.State != CheckNeutral {
+		return c.State
+	}
+	if c.Result == "skipped" {
+		return p.Skipped
+	}
+	return p.Neutral
+}
+
+// checkResult is the state of one required check, combined from the
+// statuses and check runs that match it.
+type checkResult struct {
+	required forge.RequiredCheck
+	state    CheckState
+	checks   []Check
+}
+
+func (r checkResult) String() string {
+	name := r.required.Context
+	if r.required.AppID != nil {
+		name = fmt.Sprintf("%s/%d", name, *r.required.AppID)
+	}
+	if len(r.checks) == 0 {
+		return fmt.Sprintf("%v: missing", name)
+	}
+	var details []string
+	for _, c := range r.checks {
+		d := c.Result
+		if c.State == CheckFailure && c.URL != "" {
+			d += " " + c.URL
+		}
+		details = append(details, d)
+	}
+	return fmt.Sprintf("%v: %v (%v)", name, r.state, strings.Join(details, ", "))
+}
+
+// matches returns true when c satisfies the required check. Required checks
+// without an app ID accept a status or check run from any source.
+func matches(required forge.RequiredCheck, c Check) bool {
+	if required.Context != c.Name {
+		return false
+	}
+	return required.AppID == nil || *required.AppID == c.AppID
+}
+
+// evaluateChecks combines the checks that match each required check. A
+// required check fails when any match fails, and is pending when it has no
+// matches or any match is pending.
+func evaluateChecks(required []forge.RequiredCheck, checks []Check, policy CheckPolicy) []checkResult {
+	results := make([]checkResult, 0, len(required))
+	for _, req := range required {
+		res := checkResult{required: req, state: CheckPending}
+		var failed, pending bool
+		for _, c := range checks {
+			if !matches(req, c) {
+				continue
+			}
+			res.checks = append(res.checks, c)
+			switch policy.resolve(c) {
+			case CheckFailure:
+				failed = true
+			case CheckPending:
+				pending = true
+			}
+		}
+		switch {
+		case failed:
+			res.state = CheckFailure
+		case pending || len(res.checks) == 0:
+			res.state = CheckPending
+		default:
+			res.state = CheckSuccess
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// checksError returns ErrFailedCheck when any required check failed, and
+// ErrMissingCheck when any is pending or there are none.
+func checksError(results []checkResult) error {
+	var pending bool
+	for _, res := range results {
+		switch res.state {
+		case CheckFailure:
+			return ErrFailedCheck
+		case CheckPending:
+			pending = true
+		}
+	}
+	if pending || len(results) == 0 {
+		return ErrMissingCheck
+	}
+	return nil
+}
+
+// checkStatusChecks logs the state of the checks required by rules for the
+// head commit of activePr, and returns the error from checksError. When
+// checks failed, the error is a failedChecksError listing them.
+func checkStatusChecks(ctx context.Context, r *gitrepo.GitRepo, cfg *mergeConfig, rules *forge.BranchRules, activePr *forge.PullRequest) error {
+	results, err := requiredCheckResults(ctx, r, cfg, rules, activePr)
+	if err != nil {
+		return err
+	}
+	var failed []Check
+	for _, res := range results {
+		log.Printf("  required check %v", res)
+		if res.state != CheckFailure {
+			continue
+		}
+		for _, c := range res.checks {
+			if cfg.checks.resolve(c) == CheckFailure {
+				failed = append(failed, c)
+			}
+		}
+	}
+	err = checksError(results)
+	if err == ErrFailedCheck {
+		return &failedChecksError{checks: failed}
+	}
+	return err
+}
+
+// requiredCheckResults loads the statuses and check runs for the head commit
+// of activePr, and evaluates the checks required by rules. When rules has
+// no required checks, cfg.noChecks decides what is required.
+func requiredCheckResults(ctx context.Context, r *gitrepo.GitRepo, cfg *mergeConfig, rules *forge.BranchRules, activePr *forge.PullRequest) ([]checkResult, error) {
+	if len(rules.Checks) == 0 && cfg.noChecks == NoChecksFail {
+		return nil, ErrNoRequiredChecks
+	}
+
+	checks, err := prChecks(ctx, r, activePr)
+	if err != nil {
+		return nil, err
+	}
+
+	required := rules.Checks
+	if len(required) == 0 {
+		required = reportedChecks(checks)
+	}
+	return evaluateChecks(required, checks, cfg.checks), nil
+}
+
+// prChecks returns the latest commit statuses and check runs on the head
+// commit of activePr.
+func prChecks(ctx context.Context, r *gitrepo.GitRepo, activePr *forge.PullRequest) ([]Check, error) {
+	statuses, err := r.Forge.ListStatuses(ctx, activePr.HeadSHA)
+	if err != nil {
+		return nil, fmt.Errorf("can't list statuses: #%v %v %v", activePr.Number, activePr.Title, err)
+	}
+	runs, err := r.Forge.ListCheckRuns(ctx, activePr.HeadSHA)
+	if err != nil {
+		return nil, fmt.Errorf("can't list check runs: #%v %v %v", activePr.Number, activePr.Title, err)
+	}
+
+	var checks []Check
+	for _, s := range statuses {
+		checks = append(checks, statusCheck(s))
+	}
+	for _, run := range runs {
+		checks = append(checks, checkRunCheck(run))
+	}
+	return checks, nil
+}
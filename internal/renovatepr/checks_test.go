@@ -0,0 +1,161 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-github/v51/github"
+	"github.com/hessjcg/git-gtool/internal/forge"
+	"github.com/hessjcg/git-gtool/internal/forge/githubforge"
+)
+
+// readPayload unmarshals the recorded Github API response in testdata/name.
+func readPayload(t *testing.T, name string, v any) {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.Unmarshal(b, v)
+	if err != nil {
+		t.Fatalf("can't parse %v: %v", name, err)
+	}
+}
+
+// recordedChecks returns the normalized statuses and check runs from the
+// recorded payloads.
+func recordedChecks(t *testing.T) []Check {
+	var status github.CombinedStatus
+	readPayload(t, "combined_status.json", &status)
+	var runs github.ListCheckRunsResults
+	readPayload(t, "check_runs.json", &runs)
+
+	var checks []Check
+	for _, s := range status.Statuses {
+		checks = append(checks, statusCheck(githubforge.FromStatus(s)))
+	}
+	for _, r := range runs.CheckRuns {
+		checks = append(checks, checkRunCheck(githubforge.FromCheckRun(r)))
+	}
+	return checks
+}
+
+func TestNormalizeChecks(t *testing.T) {
+	want := map[string]CheckState{
+		"ci/circleci: build":      CheckSuccess,
+		"ci/circleci: lint":       CheckFailure,
+		"license/fossa":           CheckFailure,
+		"cla/google":              CheckPending,
+		"build":                   CheckSuccess,
+		"test (ubuntu-latest)":    CheckFailure,
+		"test (windows-latest)":   CheckFailure,
+		"e2e":                     CheckFailure,
+		"deploy-preview":          CheckFailure,
+		"docs":                    CheckNeutral,
+		"release-notes":           CheckNeutral,
+		"codeql":                  CheckFailure,
+		"integration":             CheckPending,
+		"benchmarks":              CheckPending,
+		"renovate/stability-days": CheckSuccess,
+	}
+	checks := recordedChecks(t)
+	if len(checks) != len(want) {
+		t.Fatalf("got %d checks, want %d", len(checks), len(want))
+	}
+	for _, c := range checks {
+		if c.State != want[c.Name] {
+			t.Errorf("check %v (%v): got state %v, want %v", c.Name, c.Result, c.State, want[c.Name])
+		}
+	}
+}
+
+func TestEvaluateChecks(t *testing.T) {
+	var protection github.RequiredStatusChecks
+	readPayload(t, "required_status_checks.json", &protection)
+	checks := recordedChecks(t)
+
+	required := func(names ...string) []forge.RequiredCheck {
+		var r []forge.RequiredCheck
+		for _, c := range protection.Checks {
+			r = append(r, githubforge.FromRequiredCheck(c))
+		}
+		for _, n := range names {
+			r = append(r, forge.RequiredCheck{Context: n})
+		}
+		return r
+	}
+	tests := []struct {
+		name     string
+		required []forge.RequiredCheck
+		policy   CheckPolicy
+		want     error
+	}{
+		{name: "all pass", required: required(), policy: DefaultCheckPolicy},
+		{name: "status error", required: required("ci/circleci: lint"), policy: DefaultCheckPolicy, want: ErrFailedCheck},
+		{name: "status pending", required: required("cla/google"), policy: DefaultCheckPolicy, want: ErrMissingCheck},
+		{name: "cancelled", required: required("test (windows-latest)"), policy: DefaultCheckPolicy, want: ErrFailedCheck},
+		{name: "timed out", required: required("e2e"), policy: DefaultCheckPolicy, want: ErrFailedCheck},
+		{name: "stale", required: required("codeql"), policy: DefaultCheckPolicy, want: ErrFailedCheck},
+		{name: "in progress", required: required("integration"), policy: DefaultCheckPolicy, want: ErrMissingCheck},
+		{name: "missing", required: required("never-reported"), policy: DefaultCheckPolicy, want: ErrMissingCheck},
+		{name: "failure beats pending", required: required("benchmarks", "test (ubuntu-latest)"), policy: DefaultCheckPolicy, want: ErrFailedCheck},
+		{
+			name:     "neutral fails",
+			required: required(),
+			policy:   CheckPolicy{Neutral: CheckFailure, Skipped: CheckSuccess},
+			want:     ErrFailedCheck,
+		},
+		{
+			name:     "skipped pending",
+			required: required(),
+			policy:   CheckPolicy{Neutral: CheckSuccess, Skipped: CheckPending},
+			want:     ErrMissingCheck,
+		},
+		{
+			name:     "other app",
+			required: []forge.RequiredCheck{{Context: "build", AppID: github.Int64(2740)}},
+			policy:   DefaultCheckPolicy,
+			want:     ErrMissingCheck,
+		},
+		{name: "none required", policy: DefaultCheckPolicy, want: ErrMissingCheck},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			results := evaluateChecks(tc.required, checks, tc.policy)
+			if got := checksError(results); got != tc.want {
+				t.Errorf("got %v, want %v, results %v", got, tc.want, results)
+			}
+		})
+	}
+}
+
+func TestNewCheckPolicy(t *testing.T) {
+	p, err := newCheckPolicy("", "pending")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Neutral != CheckSuccess || p.Skipped != CheckPending {
+		t.Errorf("got %+v", p)
+	}
+	for _, bad := range []string{"neutral", "passed"} {
+		if _, err := newCheckPolicy(bad, ""); err == nil {
+			t.Errorf("newCheckPolicy(%q) got no error", bad)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+)
+
+const (
+	MergeMethodSquash = "squash"
+	MergeMethodRebase = "rebase"
+	MergeMethodMerge  = "merge"
+
+	// DefaultCommitTitle uses the PR title as the commit title.
+	DefaultCommitTitle = "{{.Title}}"
+)
+
+// CommitData is the data passed to the commit title and body templates.
+type CommitData struct {
+	// Number the PR number.
+	Number int
+	// Title the PR title.
+	Title string
+	// Labels the names of the PR labels.
+	Labels []string
+	// CoAuthors the authors of the PR commits as `Name <email>`.
+	CoAuthors []string
+	// CoAuthorTrailers a `Co-authored-by:` trailer line for each co-author.
+	CoAuthorTrailers string
+}
+
+// commitTemplate renders the commit title and body for a merged PR.
+type commitTemplate struct {
+	title *template.Template
+	body  *template.Template
+}
+
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// newCommitTemplate parses the Go templates for the commit title and body.
+func newCommitTemplate(title, body string) (*commitTemplate, error) {
+	if title == "" {
+		title = DefaultCommitTitle
+	}
+	tt, err := template.New("title").Funcs(templateFuncs).Parse(title)
+	if err != nil {
+		return nil, fmt.Errorf("bad commit title template: %v", err)
+	}
+	bt, err := template.New("body").Funcs(templateFuncs).Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("bad commit body template: %v", err)
+	}
+	return &commitTemplate{title: tt, body: bt}, nil
+}
+
+// render returns the commit title and body for d.
+func (t *commitTemplate) render(d *CommitData) (string, string, error) {
+	var title, body strings.Builder
+	if err := t.title.Execute(&title, d); err != nil {
+		return "", "", fmt.Errorf("can't render commit title: %v", err)
+	}
+	if err := t.body.Execute(&body, d); err != nil {
+		return "", "", fmt.Errorf("can't render commit body: %v", err)
+	}
+	return strings.TrimSpace(title.String()), strings.TrimSpace(body.String()), nil
+}
+
+// newCommitData builds the template data for pr and its commits.
+func newCommitData(pr *forge.PullRequest, commits []*forge.Commit) *CommitData {
+	d := &CommitData{
+		Number: pr.Number,
+		Title:  pr.Title,
+		Labels: pr.Labels,
+	}
+
+	seen := map[string]bool{}
+	var trailers strings.Builder
+	for _, c := range commits {
+		if c.AuthorEmail == "" {
+			continue
+		}
+		coAuthor := fmt.Sprintf("%s <%s>", c.AuthorName, c.AuthorEmail)
+		if seen[coAuthor] {
+			continue
+		}
+		seen[coAuthor] = true
+		d.CoAuthors = append(d.CoAuthors, coAuthor)
+		fmt.Fprintf(&trailers, "Co-authored-by: %s\n", coAuthor)
+	}
+	d.CoAuthorTrailers = trailers.String()
+	return d
+}
+
+// checkMergeMethod returns an error if method is not known or the repo does
+// not allow it. Settings the Github API did not return are assumed allowed.
+func checkMergeMethod(repo *forge.Repository, method string) error {
+	var allowed *bool
+	switch method {
+	case MergeMethodSquash:
+		allowed = repo.AllowSquashMerge
+	case MergeMethodRebase:
+		allowed = repo.AllowRebaseMerge
+	case MergeMethodMerge:
+		allowed = repo.AllowMergeCommit
+	default:
+		return fmt.Errorf("unknown merge method %q, use %v, %v or %v", method, MergeMethodSquash, MergeMethodRebase, MergeMethodMerge)
+	}
+	if allowed != nil && !*allowed {
+		return fmt.Errorf("repo %v does not allow the %v merge method", repo.FullName, method)
+	}
+	return nil
+}
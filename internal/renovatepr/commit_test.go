@@ -0,0 +1,70 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"testing"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+)
+
+func TestCommitTemplate(t *testing.T) {
+	pr := &forge.PullRequest{
+		Number: 12,
+		Title:  "Update dependency foo to v2",
+		Labels: []string{"dependencies", "go"},
+	}
+	commits := []*forge.Commit{
+		{AuthorName: "Renovate Bot", AuthorEmail: "bot@renovateapp.com"},
+		{AuthorName: "Renovate Bot", AuthorEmail: "bot@renovateapp.com"},
+	}
+
+	ct, err := newCommitTemplate(
+		"deps: {{.Title}} (#{{.Number}})",
+		"Labels: {{join .Labels \", \"}}\n\n{{.CoAuthorTrailers}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	title, body, err := ct.render(newCommitData(pr, commits))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "deps: Update dependency foo to v2 (#12)"; title != want {
+		t.Errorf("got title %q, want %q", title, want)
+	}
+	if want := "Labels: dependencies, go\n\nCo-authored-by: Renovate Bot <bot@renovateapp.com>"; body != want {
+		t.Errorf("got body %q, want %q", body, want)
+	}
+}
+
+func TestCheckMergeMethod(t *testing.T) {
+	repo := &forge.Repository{
+		FullName:         "o/r",
+		AllowSquashMerge: boolPtr(false),
+		AllowRebaseMerge: boolPtr(true),
+	}
+	if err := checkMergeMethod(repo, MergeMethodSquash); err == nil {
+		t.Error("squash: got nil, want error")
+	}
+	if err := checkMergeMethod(repo, MergeMethodRebase); err != nil {
+		t.Errorf("rebase: got %v, want nil", err)
+	}
+	if err := checkMergeMethod(repo, MergeMethodMerge); err != nil {
+		t.Errorf("merge: got %v, want nil", err)
+	}
+	if err := checkMergeMethod(repo, "fast-forward"); err == nil {
+		t.Error("fast-forward: got nil, want error")
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"context"
+
+	"github.com/hessjcg/git-gtool/internal/gitrepo"
+)
+
+// RenovatePr is an open Renovate PR and the dependencies it updates.
+type RenovatePr struct {
+	Number  int                `json:"number"`
+	Title   string             `json:"title"`
+	URL     string             `json:"url"`
+	Author  string             `json:"author"`
+	Updates []DependencyUpdate `json:"updates"`
+}
+
+// ListPRs returns the open PRs submitted by the dependency bot authors in
+// opts, with the dependency updates parsed from their bodies. PRs rejected
+// by the policy in opts are left out.
+func ListPRs(ctx context.Context, repo *gitrepo.GitRepo, opts Options) ([]RenovatePr, error) {
+	cfg, err := newListConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	prs, err := listRenovatePrs(ctx, repo, cfg)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]RenovatePr, 0, len(prs))
+	for _, pr := range prs {
+		list = append(list, RenovatePr{
+			Number:  pr.Number,
+			Title:   pr.Title,
+			URL:     pr.URL,
+			Author:  pr.Author,
+			Updates: ParseUpdates(pr.Body),
+		})
+	}
+	return list, nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+	"github.com/hessjcg/git-gtool/internal/forge/forgetest"
+	"github.com/hessjcg/git-gtool/internal/gitrepo"
+)
+
+func TestListPRs(t *testing.T) {
+	// Listing does not merge, so it works when squash merges are not allowed.
+	f := forgetest.New("example", "widget")
+	f.Repo.AllowSquashMerge = boolPtr(false)
+	f.AddPR(&forge.PullRequest{Number: 1, Title: "update module golang.org/x/oauth2 to v0.8.0", Author: "renovate-bot", Body: readBody(t, "pr_body_single.md")})
+	f.AddPR(&forge.PullRequest{Number: 2, Title: "fix the build", Author: "someone"})
+
+	prs, err := ListPRs(context.Background(), &gitrepo.GitRepo{Forge: f, Owner: "example", Name: "widget"}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prs) != 1 || prs[0].Number != 1 || prs[0].Author != "renovate-bot" {
+		t.Fatalf("got %+v, want #1", prs)
+	}
+	if u := prs[0].Updates; len(u) != 1 || u[0].Package != "golang.org/x/oauth2" || u[0].To != "v0.8.0" {
+		t.Errorf("got updates %+v, want golang.org/x/oauth2 to v0.8.0", u)
+	}
+
+	_, err = MergePRs(context.Background(), &gitrepo.GitRepo{Forge: f, Owner: "example", Name: "widget"}, fastOptions())
+	if err == nil {
+		t.Error("got no error merging with squash, want the merge method rejected")
+	}
+}
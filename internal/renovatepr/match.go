@@ -0,0 +1,92 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+)
+
+// DefaultAuthors are the logins used by the hosted Renovate bot and the
+// Renovate Github App.
+var DefaultAuthors = []string{"renovate-bot", "renovate[bot]"}
+
+// botMatcher decides whether a PR was opened by a dependency bot.
+type botMatcher struct {
+	authors  []*regexp.Regexp
+	prefixes []*regexp.Regexp
+}
+
+// newBotMatcher returns a botMatcher for PRs opened by one of authors. When
+// branchPrefixes is not empty, the PR head branch must also start with one
+// of the prefixes.
+//
+// Each pattern is one of:
+//   - /regex/ a regular expression, which must match the whole value.
+//   - a glob containing `*` or `?`.
+//   - a literal value.
+func newBotMatcher(authors, branchPrefixes []string) (*botMatcher, error) {
+	if len(authors) == 0 {
+		return nil, fmt.Errorf("at least one bot author is required")
+	}
+	m := &botMatcher{}
+	for _, a := range authors {
+		re, err := compilePattern(a, "$")
+		if err != nil {
+			return nil, fmt.Errorf("bad author pattern %q: %v", a, err)
+		}
+		m.authors = append(m.authors, re)
+	}
+	for _, p := range branchPrefixes {
+		re, err := compilePattern(p, "")
+		if err != nil {
+			return nil, fmt.Errorf("bad branch prefix pattern %q: %v", p, err)
+		}
+		m.prefixes = append(m.prefixes, re)
+	}
+	return m, nil
+}
+
+// compilePattern turns a regex, glob or literal pattern into a regular
+// expression anchored at the start, and ending with suffix. Use suffix "$" to
+// match the whole value, or "" to match a prefix.
+func compilePattern(p, suffix string) (*regexp.Regexp, error) {
+	if len(p) > 2 && strings.HasPrefix(p, "/") && strings.HasSuffix(p, "/") {
+		return regexp.Compile("^(?:" + p[1:len(p)-1] + ")" + suffix)
+	}
+	q := regexp.QuoteMeta(p)
+	q = strings.ReplaceAll(q, `\*`, ".*")
+	q = strings.ReplaceAll(q, `\?`, ".")
+	return regexp.Compile("^" + q + suffix)
+}
+
+// Match returns true when pr was opened by one of the bot authors, on a
+// matching branch.
+func (m *botMatcher) Match(pr *forge.PullRequest) bool {
+	return matchAny(m.authors, pr.Author) &&
+		(len(m.prefixes) == 0 || matchAny(m.prefixes, pr.HeadRef))
+}
+
+func matchAny(res []*regexp.Regexp, v string) bool {
+	for _, re := range res {
+		if re.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"testing"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+)
+
+func TestBotMatcher(t *testing.T) {
+	tcs := []struct {
+		name     string
+		authors  []string
+		prefixes []string
+		login    string
+		branch   string
+		want     bool
+	}{
+		{name: "default renovate-bot", authors: DefaultAuthors, login: "renovate-bot", branch: "renovate/foo", want: true},
+		{name: "default github app", authors: DefaultAuthors, login: "renovate[bot]", branch: "renovate/foo", want: true},
+		{name: "literal is not a glob", authors: DefaultAuthors, login: "renovateb", want: false},
+		{name: "literal is exact", authors: []string{"renovate-bot"}, login: "renovate-bot2", want: false},
+		{name: "glob", authors: []string{"*[bot]"}, login: "dependabot[bot]", want: true},
+		{name: "regex", authors: []string{"/^(renovate|dependabot)\\[bot\\]$/"}, login: "dependabot[bot]", want: true},
+		{name: "regex no match", authors: []string{"/^dependabot/"}, login: "renovate-bot", want: false},
+		{name: "regex matches the whole login", authors: []string{"/renovate/"}, login: "renovate-bot", want: false},
+		{name: "regex alternatives are anchored", authors: []string{"/renovate|dependabot/"}, login: "my-renovate", want: false},
+		{name: "branch regex prefix", authors: DefaultAuthors, prefixes: []string{"/(renovate|deps)//"}, login: "renovate-bot", branch: "deps/go", want: true},
+		{name: "branch regex not at the start", authors: DefaultAuthors, prefixes: []string{"/deps//"}, login: "renovate-bot", branch: "renovate/deps/go", want: false},
+		{name: "branch prefix", authors: DefaultAuthors, prefixes: []string{"renovate/"}, login: "renovate-bot", branch: "renovate/go-deps", want: true},
+		{name: "branch prefix mismatch", authors: DefaultAuthors, prefixes: []string{"renovate/"}, login: "renovate-bot", branch: "fix-build", want: false},
+		{name: "branch glob", authors: DefaultAuthors, prefixes: []string{"deps-*/"}, login: "renovate-bot", branch: "deps-go/x", want: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := newBotMatcher(tc.authors, tc.prefixes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pr := &forge.PullRequest{Author: tc.login, HeadRef: tc.branch}
+			if got := m.Match(pr); got != tc.want {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBotMatcherBadPattern(t *testing.T) {
+	_, err := newBotMatcher([]string{"/(/"}, nil)
+	if err == nil {
+		t.Fatal("got nil, want error")
+	}
+}
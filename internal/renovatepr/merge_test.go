@@ -0,0 +1,628 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+	"github.com/hessjcg/git-gtool/internal/forge/forgetest"
+	"github.com/hessjcg/git-gtool/internal/forge/giteaforge"
+	"github.com/hessjcg/git-gtool/internal/forge/githubforge"
+	"github.com/hessjcg/git-gtool/internal/forge/gitlabforge"
+	"github.com/hessjcg/git-gtool/internal/giteatest"
+	"github.com/hessjcg/git-gtool/internal/githubtest"
+	"github.com/hessjcg/git-gtool/internal/gitlabtest"
+	"github.com/hessjcg/git-gtool/internal/gitrepo"
+)
+
+// fakeRepo returns a GitRepo for the repository on the fake server.
+func fakeRepo(t *testing.T, s *githubtest.Server) *gitrepo.GitRepo {
+	t.Helper()
+	r, _, err := s.Client.Repositories.Get(context.Background(), s.Owner, s.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &gitrepo.GitRepo{Forge: githubforge.New(s.Client, r), Client: s.Client, GithubRepo: r, Owner: s.Owner, Name: s.Name}
+}
+
+// fastOptions polls the fake server without waiting.
+func fastOptions() Options {
+	return Options{
+		PollInterval:    time.Millisecond,
+		MaxPollInterval: time.Millisecond,
+		MaxWait:         10 * time.Millisecond,
+		MaxIterations:   10,
+		MaxErrors:       2,
+	}
+}
+
+// scenarioPr is a PR in a TestMergePRs scenario. Each testForge adds it to
+// its fake in the form that forge uses.
+type scenarioPr struct {
+	Number int
+	Title  string
+	// Author the author of the PR, renovate-bot when "".
+	Author string
+	// Build the state of the required build check: success, failure or
+	// pending. The check is missing when "".
+	Build string
+	// Behind true when Renovate has to rebase the PR before it can merge.
+	Behind bool
+	// WorkflowRun true when the build is in a workflow run waiting for
+	// approval.
+	WorkflowRun bool
+}
+
+// scenarioResult is what happened to a PR on the fake forge.
+type scenarioResult struct {
+	Merged   bool
+	MergeSHA string
+	// Method the merge method the PR was merged with.
+	Method      string
+	Approved    bool
+	AutoMerge   bool
+	RunApproved bool
+	Rebases     int
+}
+
+// testForge is a fake forge to run the TestMergePRs scenarios on.
+type testForge struct {
+	name string
+	// newForge starts the fake with prs. It returns the repository, and a
+	// func that returns what happened to a PR by number.
+	newForge func(t *testing.T, prs []scenarioPr) (*gitrepo.GitRepo, func(n int) scenarioResult)
+	// rebase, autoMerge and workflowRuns true when the fake does Renovate
+	// rebases, auto-merges PRs when their checks pass, or has workflow runs.
+	rebase, autoMerge, workflowRuns bool
+}
+
+var testForges = []testForge{
+	{
+		name:         "Github",
+		newForge:     newGithubForge,
+		rebase:       true,
+		workflowRuns: true,
+	},
+	{
+		name:         "in-memory",
+		newForge:     newInMemoryForge,
+		workflowRuns: true,
+	},
+	{
+		name:      "GitLab",
+		newForge:  newGitlabForge,
+		rebase:    true,
+		autoMerge: true,
+	},
+	{
+		name:      "Gitea",
+		newForge:  newGiteaForge,
+		rebase:    true,
+		autoMerge: true,
+	},
+}
+
+var lintPassed = githubtest.Status{Context: "lint", State: "success"}
+
+// newGithubForge requires the build check by a ruleset, and the lint status,
+// which every PR passes, by branch protection.
+func newGithubForge(t *testing.T, prs []scenarioPr) (*gitrepo.GitRepo, func(n int) scenarioResult) {
+	s := githubtest.NewServer(t, "example", "widget")
+	s.ProtectedChecks = []string{"lint"}
+	s.RulesetChecks = []string{"build"}
+	for _, p := range prs {
+		pr := &githubtest.PullRequest{
+			Number:     p.Number,
+			Title:      p.Title,
+			Author:     p.Author,
+			Body:       githubtest.RebaseBody,
+			Rebaseable: true,
+			Statuses:   []githubtest.Status{lintPassed},
+		}
+		if p.Build != "" {
+			run := githubtest.CheckRun{Name: "build", AppID: 15368, Status: "completed", Conclusion: p.Build, URL: "https://example.com/build"}
+			if p.Build == "pending" {
+				run.Status, run.Conclusion = "in_progress", ""
+			}
+			pr.CheckRuns = []githubtest.CheckRun{run}
+		}
+		if p.Behind {
+			pr.MergeableState = "behind"
+			pr.Rebaseable = false
+		}
+		if p.WorkflowRun {
+			pr.WorkflowRuns = []*githubtest.WorkflowRun{{Status: "action_required", CheckRuns: pr.CheckRuns}}
+			pr.CheckRuns = nil
+		}
+		s.AddPR(pr)
+	}
+	return fakeRepo(t, s), func(n int) scenarioResult {
+		pr := s.PR(n)
+		return scenarioResult{
+			Merged:      pr.Merged,
+			MergeSHA:    pr.MergeCommitSHA,
+			Method:      pr.MergeMethod,
+			Approved:    slices.Contains(pr.Reviews, "APPROVED"),
+			RunApproved: len(pr.WorkflowRuns) > 0 && pr.WorkflowRuns[0].Approved,
+			Rebases:     pr.Rebases,
+		}
+	}
+}
+
+// newInMemoryForge requires the build check by a branch rule. It has no
+// Renovate to rebase the PRs.
+func newInMemoryForge(t *testing.T, prs []scenarioPr) (*gitrepo.GitRepo, func(n int) scenarioResult) {
+	f := forgetest.New("example", "widget")
+	f.Rules["main"] = &forge.BranchRules{Checks: []forge.RequiredCheck{{Context: "build"}}}
+	for _, p := range prs {
+		pr := &forge.PullRequest{
+			Number:         p.Number,
+			Title:          p.Title,
+			Author:         p.Author,
+			HeadRef:        fmt.Sprintf("renovate/pr-%d", p.Number),
+			Mergeable:      boolPtr(true),
+			MergeableState: "clean",
+		}
+		if pr.Author == "" {
+			pr.Author = "renovate-bot"
+		}
+		f.AddPR(pr)
+		if p.Build != "" {
+			run := &forge.CheckRun{Name: "build", Status: "completed", Conclusion: p.Build, URL: "https://example.com/build"}
+			if p.Build == "pending" {
+				run.Status, run.Conclusion = "in_progress", ""
+			}
+			f.CheckRuns[pr.HeadSHA] = []*forge.CheckRun{run}
+		}
+		if p.WorkflowRun {
+			f.WorkflowRuns = append(f.WorkflowRuns, &forge.WorkflowRun{ID: int64(p.Number), HeadBranch: pr.HeadRef, HeadSHA: pr.HeadSHA, Status: "action_required"})
+		}
+	}
+	return &gitrepo.GitRepo{Forge: f, Owner: "example", Name: "widget"}, func(n int) scenarioResult {
+		f.Mu.Lock()
+		defer f.Mu.Unlock()
+		pr := f.PRs[n]
+		res := scenarioResult{Merged: pr.Merged, MergeSHA: pr.MergeCommitSHA, AutoMerge: pr.AutoMerge, RunApproved: true}
+		for _, r := range f.Reviews[n] {
+			res.Approved = res.Approved || r.State == "APPROVED"
+		}
+		for _, c := range f.Calls {
+			if m, ok := strings.CutPrefix(c, fmt.Sprintf("merge #%d ", n)); ok {
+				res.Method = m
+			}
+		}
+		for _, r := range f.WorkflowRuns {
+			if r.HeadSHA == pr.HeadSHA {
+				res.RunApproved = false
+			}
+		}
+		return res
+	}
+}
+
+// newGitlabForge requires the pipeline, which is the build check, and an
+// approval. GitLab only asks for a rebase when the project fast-forwards, so
+// it does when a PR is behind.
+func newGitlabForge(t *testing.T, prs []scenarioPr) (*gitrepo.GitRepo, func(n int) scenarioResult) {
+	s := gitlabtest.NewServer(t, "infra/mirrors", "widget")
+	s.OnlyAllowMergeIfPipelineSucceeds = true
+	pipelines := map[string]string{"success": "success", "failure": "failed", "pending": "running"}
+	for _, p := range prs {
+		mr := &gitlabtest.MergeRequest{
+			IID:               p.Number,
+			Title:             p.Title,
+			Author:            p.Author,
+			Description:       gitlabtest.RebaseBody,
+			Pipeline:          pipelines[p.Build],
+			NeedRebase:        p.Behind,
+			ApprovalsRequired: 1,
+		}
+		if p.Behind {
+			s.MergeMethod = "ff"
+		}
+		s.AddMR(mr)
+	}
+	f, err := gitlabforge.New(context.Background(), http.DefaultClient, s.BaseURL, s.Owner, s.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &gitrepo.GitRepo{Forge: f, Owner: s.Owner, Name: s.Name}, func(n int) scenarioResult {
+		mr := s.MR(n)
+		// Without squashing, GitLab merges with the project merge method.
+		res := scenarioResult{
+			Merged:    mr.State == "merged",
+			MergeSHA:  mr.MergeCommitSHA,
+			Method:    map[string]string{"merge": MergeMethodMerge, "ff": MergeMethodRebase}[s.MergeMethod],
+			Approved:  len(mr.Approvals) > 0,
+			AutoMerge: mr.MergeWhenPipelineSucceeds,
+			Rebases:   mr.Rebases,
+		}
+		if mr.Squash {
+			res.Method = MergeMethodSquash
+		}
+		return res
+	}
+}
+
+// newGiteaForge requires the ci/build status and an approval by branch
+// protection.
+func newGiteaForge(t *testing.T, prs []scenarioPr) (*gitrepo.GitRepo, func(n int) scenarioResult) {
+	s := giteatest.NewServer(t, "infra", "widget")
+	s.RequiredContexts = []string{"ci/build"}
+	s.RequiredApprovals = 1
+	for _, p := range prs {
+		pr := &giteatest.PullRequest{
+			Number:       p.Number,
+			Title:        p.Title,
+			Author:       p.Author,
+			Body:         giteatest.RebaseBody,
+			HasConflicts: p.Behind,
+		}
+		if p.Build != "" {
+			pr.Statuses = []giteatest.Status{{Context: "ci/build", State: p.Build, URL: "https://example.com/build"}}
+		}
+		s.AddPR(pr)
+	}
+	f, err := giteaforge.New(context.Background(), http.DefaultClient, s.BaseURL, s.Owner, s.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &gitrepo.GitRepo{Forge: f, Owner: s.Owner, Name: s.Name}, func(n int) scenarioResult {
+		pr := s.PR(n)
+		res := scenarioResult{
+			Merged:    pr.Merged,
+			MergeSHA:  pr.MergeCommitSHA,
+			Method:    pr.MergeStyle,
+			AutoMerge: pr.MergeWhenChecksSucceed,
+			Rebases:   pr.Rebases,
+		}
+		for _, r := range pr.Reviews {
+			res.Approved = res.Approved || r.State == "APPROVED"
+		}
+		return res
+	}
+}
+
+func TestMergePRs(t *testing.T) {
+	tests := []struct {
+		name string
+		prs  []scenarioPr
+		opts func(*Options)
+		// skip returns true for the forges that can't run the scenario.
+		skip   func(f testForge) bool
+		err    error
+		merged []int
+		check  func(t *testing.T, pr func(n int) scenarioResult, report *Report)
+	}{
+		{
+			name: "all green",
+			prs: []scenarioPr{
+				{Number: 1, Title: "update module a to v1.2.0", Build: "success"},
+				{Number: 2, Title: "update module b to v2.0.1", Build: "success"},
+			},
+			merged: []int{1, 2},
+			check: func(t *testing.T, pr func(n int) scenarioResult, report *Report) {
+				for _, n := range []int{1, 2} {
+					if res := pr(n); !res.Approved || res.Method != MergeMethodSquash {
+						t.Errorf("#%d got approved %v method %q, want approved and squashed", n, res.Approved, res.Method)
+					}
+				}
+			},
+		},
+		{
+			name: "failing check",
+			prs: []scenarioPr{
+				{Number: 1, Title: "update module a to v1.2.0", Build: "failure"},
+				{Number: 2, Title: "update module b to v2.0.1", Build: "success"},
+			},
+			err:    ErrFailedCheck,
+			merged: []int{2},
+			check: func(t *testing.T, pr func(n int) scenarioResult, report *Report) {
+				if len(report.Failed) != 1 || report.Failed[0].Number != 1 {
+					t.Fatalf("got failed %v, want #1", report.Failed)
+				}
+				if checks := report.Failed[0].Checks; len(checks) != 1 || checks[0].URL == "" {
+					t.Errorf("got failed checks %v, want the build check with its URL", checks)
+				}
+			},
+		},
+		{
+			name: "PR not from a bot",
+			prs: []scenarioPr{
+				{Number: 1, Title: "update module a to v1.2.0", Build: "success"},
+				{Number: 2, Title: "fix the build", Author: "someone", Build: "success"},
+			},
+			merged: []int{1},
+			check: func(t *testing.T, pr func(n int) scenarioResult, report *Report) {
+				if res := pr(2); res.Merged || res.Approved {
+					t.Errorf("got #2 merged %v approved %v, want the PR that is not from a bot left alone", res.Merged, res.Approved)
+				}
+			},
+		},
+		{
+			name: "missing check",
+			prs: []scenarioPr{
+				{Number: 1, Title: "update module a to v1.2.0"},
+			},
+			check: func(t *testing.T, pr func(n int) scenarioResult, report *Report) {
+				if pr(1).Merged {
+					t.Errorf("got #1 merged, want the PR left open")
+				}
+			},
+		},
+		{
+			name: "pending workflow approval",
+			prs: []scenarioPr{
+				{Number: 1, Title: "update actions/checkout action to v4", Build: "success", WorkflowRun: true},
+			},
+			skip:   func(f testForge) bool { return !f.workflowRuns },
+			merged: []int{1},
+			check: func(t *testing.T, pr func(n int) scenarioResult, report *Report) {
+				if !pr(1).RunApproved {
+					t.Errorf("got the workflow run not approved")
+				}
+			},
+		},
+		{
+			name: "rebase",
+			prs: []scenarioPr{
+				{Number: 1, Title: "update module a to v1.2.0", Build: "success", Behind: true},
+			},
+			skip:   func(f testForge) bool { return !f.rebase },
+			merged: []int{1},
+			check: func(t *testing.T, pr func(n int) scenarioResult, report *Report) {
+				if res := pr(1); res.Rebases != 1 {
+					t.Errorf("got %d rebases, want 1", res.Rebases)
+				}
+			},
+		},
+		{
+			name: "rebase merge method",
+			prs: []scenarioPr{
+				{Number: 1, Title: "update module a to v1.2.0", Build: "success", Behind: true},
+			},
+			opts: func(o *Options) {
+				o.MergeMethod = MergeMethodRebase
+			},
+			skip:   func(f testForge) bool { return !f.rebase },
+			merged: []int{1},
+			check: func(t *testing.T, pr func(n int) scenarioResult, report *Report) {
+				if res := pr(1); res.Rebases != 1 || res.Method != MergeMethodRebase {
+					t.Errorf("got %d rebases and merge method %q, want 1 and rebase", res.Rebases, res.Method)
+				}
+			},
+		},
+		{
+			name: "auto-merge",
+			prs: []scenarioPr{
+				{Number: 1, Title: "update module a to v1.2.0", Build: "pending"},
+				{Number: 2, Title: "update module b to v2.0.1", Build: "success"},
+			},
+			opts: func(o *Options) {
+				o.AutoMerge = true
+			},
+			skip:   func(f testForge) bool { return !f.autoMerge },
+			merged: []int{2},
+			check: func(t *testing.T, pr func(n int) scenarioResult, report *Report) {
+				if res := pr(1); !res.AutoMerge || !res.Approved {
+					t.Errorf("got #1 auto-merge %v approved %v, want approved and set to auto-merge", res.AutoMerge, res.Approved)
+				}
+				if len(report.AutoMerge) != 1 || report.AutoMerge[0].Number != 1 || len(report.Queued) != 0 {
+					t.Errorf("got auto-merge %v queued %v, want #1 set to auto-merge", report.AutoMerge, report.Queued)
+				}
+			},
+		},
+	}
+	for _, f := range testForges {
+		for _, tt := range tests {
+			t.Run(f.name+"/"+tt.name, func(t *testing.T) {
+				if tt.skip != nil && tt.skip(f) {
+					t.Skipf("the %v fake can't run this scenario", f.name)
+				}
+				repo, pr := f.newForge(t, tt.prs)
+				opts := fastOptions()
+				if tt.opts != nil {
+					tt.opts(&opts)
+				}
+
+				report, err := MergePRs(context.Background(), repo, opts)
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got error %v, want %v", err, tt.err)
+				}
+				var merged []int
+				for _, m := range report.Merged {
+					merged = append(merged, m.Number)
+					if res := pr(m.Number); !res.Merged || res.MergeSHA != m.SHA {
+						t.Errorf("#%d in the report as merged as %v, but it is merged %v as %v", m.Number, m.SHA, res.Merged, res.MergeSHA)
+					}
+				}
+				if fmt.Sprint(merged) != fmt.Sprint(tt.merged) {
+					t.Fatalf("got merged %v, want %v", merged, tt.merged)
+				}
+				if tt.check != nil {
+					tt.check(t, pr, report)
+				}
+			})
+		}
+	}
+}
+
+func TestMergePRsParallel(t *testing.T) {
+	tests := []struct {
+		name   string
+		prs    []*forge.PullRequest
+		setup  func(f *forgetest.Forge)
+		err    error
+		merged []int
+		calls  []string
+		check  func(t *testing.T, f *forgetest.Forge, report *Report)
+	}{
+		{
+			name: "mixed batch",
+			prs: []*forge.PullRequest{
+				{Number: 1, Title: "update module a to v1.2.0"},
+				{Number: 2, Title: "update module b to v2.0.1"},
+				{Number: 3, Title: "update module c to v0.3.0"},
+			},
+			setup: func(f *forgetest.Forge) {
+				f.CheckRuns["sha-2"][0].Conclusion = "failure"
+			},
+			err:    ErrFailedCheck,
+			merged: []int{1, 3},
+			calls:  []string{"approve #1", "merge #1 squash", "approve #3", "merge #3 squash"},
+			check: func(t *testing.T, f *forgetest.Forge, report *Report) {
+				if len(report.Failed) != 1 || report.Failed[0].Number != 2 {
+					t.Errorf("got failed %v, want #2", report.Failed)
+				}
+			},
+		},
+		{
+			name: "mergeable unknown",
+			prs: []*forge.PullRequest{
+				{Number: 1, Title: "update module a to v1.2.0", Body: githubtest.RebaseBody},
+				{Number: 2, Title: "update module b to v2.0.1"},
+			},
+			setup: func(f *forgetest.Forge) {
+				// #1 becomes mergeable after the check before the merge.
+				f.PRs[1].Mergeable = nil
+				var gets int
+				f.OnGet = func(pr *forge.PullRequest) {
+					if pr.Number != 1 {
+						return
+					}
+					gets++
+					if gets > 2 {
+						pr.Mergeable = boolPtr(true)
+						pr.MergeableState = "clean"
+					}
+				}
+			},
+			merged: []int{2, 1},
+			calls:  []string{"approve #1", "approve #2", "merge #2 squash", "merge #1 squash"},
+			check: func(t *testing.T, f *forgetest.Forge, report *Report) {
+				if len(report.Skipped) != 0 {
+					t.Errorf("got skipped %v, want none", report.Skipped)
+				}
+			},
+		},
+		{
+			name: "merge queue",
+			prs: []*forge.PullRequest{
+				{Number: 1, Title: "update module a to v1.2.0", Body: githubtest.RebaseBody},
+				{Number: 2, Title: "update module b to v2.0.1", Body: githubtest.RebaseBody},
+			},
+			setup: func(f *forgetest.Forge) {
+				f.Rules["main"].MergeQueue = true
+			},
+			calls: []string{"approve #1", "enqueue #1", "approve #2", "enqueue #2"},
+			check: func(t *testing.T, f *forgetest.Forge, report *Report) {
+				if fmt.Sprint(f.Queue) != "[1 2]" {
+					t.Errorf("got queue %v, want [1 2]", f.Queue)
+				}
+				if len(report.Queued) != 2 || len(report.Skipped) != 0 {
+					t.Errorf("got queued %v skipped %v, want #1 and #2 queued", report.Queued, report.Skipped)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := forgetest.New("example", "widget")
+			f.Rules["main"] = &forge.BranchRules{Checks: []forge.RequiredCheck{{Context: "build"}}}
+			for _, pr := range tt.prs {
+				pr.Author = "renovate-bot"
+				pr.Mergeable = boolPtr(true)
+				pr.MergeableState = "clean"
+				f.AddPR(pr)
+				f.CheckRuns[pr.HeadSHA] = []*forge.CheckRun{{Name: "build", Status: "completed", Conclusion: "success"}}
+			}
+			if tt.setup != nil {
+				tt.setup(f)
+			}
+			opts := fastOptions()
+			opts.Parallel = 2
+
+			report, err := MergePRs(context.Background(), &gitrepo.GitRepo{Forge: f, Owner: "example", Name: "widget"}, opts)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			var merged []int
+			for _, m := range report.Merged {
+				merged = append(merged, m.Number)
+			}
+			if fmt.Sprint(merged) != fmt.Sprint(tt.merged) {
+				t.Errorf("got merged %v, want %v", merged, tt.merged)
+			}
+			if strings.Join(f.Calls, ", ") != strings.Join(tt.calls, ", ") {
+				t.Errorf("got calls %q, want %q", f.Calls, tt.calls)
+			}
+			if tt.check != nil {
+				tt.check(t, f, report)
+			}
+		})
+	}
+}
+
+func TestMergePRsDryRun(t *testing.T) {
+	for _, autoMerge := range []bool{false, true} {
+		t.Run(fmt.Sprintf("auto-merge %v", autoMerge), func(t *testing.T) {
+			f := forgetest.New("example", "widget")
+			f.Rules["main"] = &forge.BranchRules{Checks: []forge.RequiredCheck{{Context: "build"}}}
+			f.AddPR(&forge.PullRequest{Number: 1, Title: "update module a to v1.2.0", Author: "renovate-bot", Mergeable: boolPtr(true), MergeableState: "clean"})
+			f.CheckRuns["sha-1"] = []*forge.CheckRun{{Name: "build", Status: "completed", Conclusion: "success"}}
+
+			gitDir := t.TempDir()
+			statePath := filepath.Join(gitDir, StateFile)
+			saved := []byte(`{"repo": "example/widget", "prs": {"1": {"attempts": 3, "headSha": "sha-1"}}}`)
+			if err := os.MkdirAll(filepath.Dir(statePath), 0700); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(statePath, saved, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			opts := fastOptions()
+			opts.DryRun = true
+			opts.AutoMerge = autoMerge
+			report, err := MergePRs(context.Background(), &gitrepo.GitRepo{Forge: f, Owner: "example", Name: "widget", GitDir: gitDir}, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(f.Calls) != 0 {
+				t.Errorf("got calls %q, want no changes in a dry run", f.Calls)
+			}
+			if len(report.Merged) != 0 || len(report.Queued) != 0 || len(report.Planned) != 1 || report.Planned[0].Number != 1 {
+				t.Errorf("got merged %v queued %v planned %v, want #1 planned", report.Merged, report.Queued, report.Planned)
+			}
+			if b, err := os.ReadFile(statePath); err != nil || string(b) != string(saved) {
+				t.Errorf("got state %q, %v, want it unchanged", b, err)
+			}
+		})
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
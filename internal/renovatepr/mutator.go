@@ -0,0 +1,138 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+)
+
+// mutator holds the forge calls that change the state of the repository.
+// The merge logic calls these instead of the forge so that a dry run can
+// replace them with a recorder.
+type mutator interface {
+	// approveWorkflowRun approves a workflow run that is waiting for approval
+	// from a repository owner.
+	approveWorkflowRun(ctx context.Context, run *forge.WorkflowRun) error
+	// approvePr adds an "approve" review with an LGTM message to the PR.
+	approvePr(ctx context.Context, pr *forge.PullRequest) error
+	// mergePr merges the PR using opts.
+	mergePr(ctx context.Context, pr *forge.PullRequest, opts forge.MergeOptions) (*forge.MergeResult, error)
+	// enableAutoMerge turns on auto-merge for the PR using opts.
+	enableAutoMerge(ctx context.Context, pr *forge.PullRequest, opts forge.MergeOptions) error
+	// enqueuePr adds the PR to the merge queue.
+	enqueuePr(ctx context.Context, pr *forge.PullRequest) error
+	// editPrBody replaces the body of the PR.
+	editPrBody(ctx context.Context, pr *forge.PullRequest, body string) error
+	// addLabel adds a label to the PR.
+	addLabel(ctx context.Context, pr *forge.PullRequest, label string) error
+}
+
+// forgeMutator applies changes to the repository through the forge.
+type forgeMutator struct {
+	f forge.Forge
+}
+
+func (m *forgeMutator) approveWorkflowRun(ctx context.Context, run *forge.WorkflowRun) error {
+	log.Printf(" Approving run: %v %v %v", run.URL, run.Status, run.HeadBranch)
+	return m.f.ApproveWorkflowRun(ctx, run)
+}
+
+func (m *forgeMutator) approvePr(ctx context.Context, pr *forge.PullRequest) error {
+	log.Printf("Approving PR #%4d with LGTM message.", pr.Number)
+	return m.f.Approve(ctx, pr, lgtm)
+}
+
+func (m *forgeMutator) mergePr(ctx context.Context, pr *forge.PullRequest, opts forge.MergeOptions) (*forge.MergeResult, error) {
+	return m.f.Merge(ctx, pr, opts)
+}
+
+func (m *forgeMutator) enableAutoMerge(ctx context.Context, pr *forge.PullRequest, opts forge.MergeOptions) error {
+	return m.f.EnableAutoMerge(ctx, pr, opts)
+}
+
+func (m *forgeMutator) enqueuePr(ctx context.Context, pr *forge.PullRequest) error {
+	position, err := m.f.Enqueue(ctx, pr)
+	if err != nil {
+		return err
+	}
+	log.Printf("  added #%d to the merge queue at position %d", pr.Number, position)
+	return nil
+}
+
+func (m *forgeMutator) editPrBody(ctx context.Context, pr *forge.PullRequest, body string) error {
+	return m.f.EditBody(ctx, pr, body)
+}
+
+func (m *forgeMutator) addLabel(ctx context.Context, pr *forge.PullRequest, label string) error {
+	return m.f.AddLabel(ctx, pr, label)
+}
+
+// errDryRun is returned by the dryRunMutator in place of a merge, so that
+// the caller records the merge as planned rather than done.
+var errDryRun = errors.New("dry run")
+
+// dryRunMutator records the changes that would be made to the repository
+// without calling the forge.
+type dryRunMutator struct {
+	// planned holds a description of each change, in the order it was requested.
+	planned []string
+}
+
+// plan records and logs one planned change.
+func (m *dryRunMutator) plan(format string, args ...any) {
+	p := fmt.Sprintf(format, args...)
+	log.Printf("  [dry-run] would %s", p)
+	m.planned = append(m.planned, p)
+}
+
+func (m *dryRunMutator) approveWorkflowRun(_ context.Context, run *forge.WorkflowRun) error {
+	m.plan("approve workflow run %v for %v", run.URL, run.HeadBranch)
+	return nil
+}
+
+func (m *dryRunMutator) approvePr(_ context.Context, pr *forge.PullRequest) error {
+	m.plan("approve PR #%d with LGTM message", pr.Number)
+	return nil
+}
+
+func (m *dryRunMutator) mergePr(_ context.Context, pr *forge.PullRequest, opts forge.MergeOptions) (*forge.MergeResult, error) {
+	m.plan("merge PR #%d via %v method with title %q", pr.Number, opts.Method, opts.Title)
+	return nil, errDryRun
+}
+
+func (m *dryRunMutator) enableAutoMerge(_ context.Context, pr *forge.PullRequest, opts forge.MergeOptions) error {
+	m.plan("enable auto-merge on PR #%d via %v method with title %q", pr.Number, opts.Method, opts.Title)
+	return nil
+}
+
+func (m *dryRunMutator) enqueuePr(_ context.Context, pr *forge.PullRequest) error {
+	m.plan("add PR #%d to the merge queue", pr.Number)
+	return errDryRun
+}
+
+func (m *dryRunMutator) editPrBody(_ context.Context, pr *forge.PullRequest, _ string) error {
+	m.plan("edit the body of PR #%d", pr.Number)
+	return nil
+}
+
+func (m *dryRunMutator) addLabel(_ context.Context, pr *forge.PullRequest, label string) error {
+	m.plan("add label %v to PR #%d", label, pr.Number)
+	return nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+	"github.com/hessjcg/git-gtool/internal/gitrepo"
+)
+
+// prResult is the outcome of evaluating one PR.
+type prResult struct {
+	pr  *forge.PullRequest
+	err error
+}
+
+// parallelStep does one iteration of the parallel mode. It evaluates all
+// open Renovate PRs concurrently, merges the ones that are green one at a
+// time, and then asks Renovate to rebase the rest. Returns true when the
+// command should attempt another step, and error if no PR was merged.
+func parallelStep(ctx context.Context, r *gitrepo.GitRepo, cfg *mergeConfig) (bool, error) {
+	renovatePrs, err := listRenovatePrs(ctx, r, cfg)
+	if err != nil {
+		return false, err
+	}
+	if len(renovatePrs) == 0 {
+		log.Printf("No open Renovate PRs.")
+		return false, nil
+	}
+
+	// Leave the PRs that failed until Renovate pushes a new commit
+	var failed int
+	var prs []*forge.PullRequest
+	for _, pr := range renovatePrs {
+		if why := cfg.state.failure(pr); why != "" {
+			log.Printf("#%4d failed on %.7s: %v, skipping", pr.Number, pr.HeadSHA, why)
+			cfg.report.addSkipped(pr, fmt.Sprintf("failed on %.7s: %v", pr.HeadSHA, why))
+			failed++
+			continue
+		}
+		prs = append(prs, pr)
+	}
+
+	m := &forgeMutator{f: r.Forge}
+	results := evaluatePrs(ctx, r, m, cfg, prs)
+
+	// Merge the green PRs in order. Merges happen one at a time on this
+	// goroutine so that only one change lands on the default branch at once.
+	var merged int
+	var remaining []*forge.PullRequest
+	var pending []*pendingError
+	for _, res := range results {
+		pr := res.pr
+		var p *pendingError
+		switch {
+		case errors.Is(res.err, ErrNoRequiredChecks):
+			return false, res.err
+		case errors.Is(res.err, ErrFailedCheck):
+			log.Printf("#%4d has failed checks, skipping", pr.Number)
+			recordFailure(cfg, pr, res.err)
+			failed++
+			continue
+		case errors.As(res.err, &p):
+			pending = append(pending, p)
+			if !errors.Is(res.err, ErrRebasing) && !errors.Is(res.err, ErrInMergeQueue) {
+				log.Printf("#%4d is not ready: %v", pr.Number, res.err)
+				remaining = append(remaining, pr)
+			}
+			continue
+		case res.err != nil:
+			log.Printf("#%4d is not ready: %v", pr.Number, res.err)
+			remaining = append(remaining, pr)
+			continue
+		}
+
+		err := approvePr(ctx, r, m, pr)
+		if err == nil {
+			err = mergePr(ctx, r, m, cfg, pr)
+		}
+		switch err {
+		case ErrMergeableUnknown:
+			pending = append(pending, waitForMergeable(r, pr, err))
+			continue
+		case ErrInMergeQueue:
+			log.Printf("#%4d added to the merge queue", pr.Number)
+			pending = append(pending, waitForMergeQueue(r, pr, err))
+			continue
+		}
+		if err != nil {
+			log.Printf("#%4d could not be merged: %v", pr.Number, err)
+			cfg.report.addSkipped(pr, err.Error())
+			remaining = append(remaining, pr)
+			continue
+		}
+		merged++
+	}
+
+	// The default branch moved, so the remaining PRs need to be rebased
+	// before they can be merged.
+	if merged > 0 {
+		for _, pr := range remaining {
+			if cfg.rebases.waiting(pr) {
+				continue
+			}
+			log.Printf("Asking Renovate to rebase #%4d %v", pr.Number, pr.Title)
+			if err := requestRebase(ctx, m, cfg, pr); err != nil {
+				log.Printf("  %v", err)
+			}
+		}
+	}
+
+	log.Printf("Merged %d PRs, %d waiting, %d with failed checks", merged, len(remaining), failed)
+	switch {
+	case merged > 0:
+		return true, nil
+	case len(pending) > 0:
+		return true, anyReady(ErrMissingCheck, pending)
+	case len(remaining) > 0:
+		return true, ErrMissingCheck
+	default:
+		return false, ErrFailedCheck
+	}
+}
+
+// evaluatePrs calls evaluatePr for each of prs using a pool of workers.
+// Results are returned in the same order as prs.
+func evaluatePrs(ctx context.Context, r *gitrepo.GitRepo, m mutator, cfg *mergeConfig, prs []*forge.PullRequest) []prResult {
+	workers := cfg.parallel
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]prResult, len(prs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				pr := prs[i]
+				cfg.state.attempt(pr)
+				results[i] = prResult{pr: pr, err: evaluatePr(ctx, r, m, cfg, pr)}
+			}
+		}()
+	}
+	for i := range prs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
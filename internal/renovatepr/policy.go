@@ -0,0 +1,270 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+	"github.com/hessjcg/git-gtool/internal/gitrepo"
+)
+
+const (
+	PolicyAllow  = "allow"
+	PolicyReject = "reject"
+)
+
+// PolicyRule decides whether matching Renovate PRs may be merged unattended.
+// A rule matches a PR when every field that is set matches, and a field
+// matches when any of its values match. Labels, Titles and Paths are
+// patterns like the bot authors: /regex/, a glob or a literal value, which
+// must match the whole value.
+type PolicyRule struct {
+	// Name describes the rule when it rejects a PR.
+	Name string `mapstructure:"name"`
+	// Action is allow or reject. Defaults to reject.
+	Action string `mapstructure:"action"`
+	// Labels patterns for the PR labels.
+	Labels []string `mapstructure:"labels"`
+	// Titles patterns for the PR title, like "update dependency * to v*".
+	Titles []string `mapstructure:"titles"`
+	// UpdateTypes the update types from the table in the PR body, like
+	// major, minor, patch, digest or pin.
+	UpdateTypes []string `mapstructure:"update-types"`
+	// Managers the Renovate package managers, inferred from the files that
+	// the PR changes, like gomod, npm or github-actions.
+	Managers []string `mapstructure:"managers"`
+	// Paths patterns for the files that the PR changes.
+	Paths []string `mapstructure:"paths"`
+}
+
+// policy holds the compiled PolicyRules. The first rule that matches a PR
+// decides, PRs that match no rule are allowed.
+type policy struct {
+	rules []*policyRule
+}
+
+type policyRule struct {
+	name        string
+	allow       bool
+	labels      []*regexp.Regexp
+	titles      []*regexp.Regexp
+	updateTypes []string
+	managers    []string
+	paths       []*regexp.Regexp
+}
+
+// newPolicy validates and compiles rules.
+func newPolicy(rules []PolicyRule) (*policy, error) {
+	p := &policy{}
+	for i, r := range rules {
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("policy rule %d", i+1)
+		}
+		pr := &policyRule{
+			name:        name,
+			updateTypes: r.UpdateTypes,
+			managers:    r.Managers,
+		}
+		switch r.Action {
+		case "", PolicyReject:
+		case PolicyAllow:
+			pr.allow = true
+		default:
+			return nil, fmt.Errorf("%v: unknown action %q, use %v or %v", name, r.Action, PolicyAllow, PolicyReject)
+		}
+		var err error
+		if pr.labels, err = compilePatterns(r.Labels); err != nil {
+			return nil, fmt.Errorf("%v: bad label pattern: %v", name, err)
+		}
+		if pr.titles, err = compilePatterns(r.Titles); err != nil {
+			return nil, fmt.Errorf("%v: bad title pattern: %v", name, err)
+		}
+		if pr.paths, err = compilePatterns(r.Paths); err != nil {
+			return nil, fmt.Errorf("%v: bad path pattern: %v", name, err)
+		}
+		p.rules = append(p.rules, pr)
+	}
+	return p, nil
+}
+
+// compilePatterns compiles patterns that match the whole value.
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := compilePattern(p, "$")
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", p, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// needsFiles returns true when a rule matches on the files a PR changes.
+func (p *policy) needsFiles() bool {
+	for _, r := range p.rules {
+		if len(r.managers) > 0 || len(r.paths) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// prFacts are the properties of a PR that policy rules match.
+type prFacts struct {
+	labels      []string
+	title       string
+	updateTypes []string
+	files       []string
+	managers    []string
+}
+
+// newPrFacts returns the facts about pr. The changed files are only listed
+// when withFiles is true.
+func newPrFacts(ctx context.Context, r *gitrepo.GitRepo, pr *forge.PullRequest, withFiles bool) (*prFacts, error) {
+	f := &prFacts{
+		labels:      pr.Labels,
+		title:       pr.Title,
+		updateTypes: updateTypes(pr.Body),
+	}
+	if !withFiles {
+		return f, nil
+	}
+
+	files, err := listPrFiles(ctx, r, pr)
+	if err != nil {
+		return nil, err
+	}
+	f.files = files
+	f.managers = fileManagers(f.files)
+	return f, nil
+}
+
+// listPrFiles returns the names of the files that pr changes.
+func listPrFiles(ctx context.Context, r *gitrepo.GitRepo, pr *forge.PullRequest) ([]string, error) {
+	return r.Forge.ListFiles(ctx, pr.Number)
+}
+
+// decide returns "" when the policy allows a PR with facts f, or the reason
+// it was rejected.
+func (p *policy) decide(f *prFacts) string {
+	for _, r := range p.rules {
+		why, ok := r.match(f)
+		if !ok {
+			continue
+		}
+		if r.allow {
+			return ""
+		}
+		if len(why) == 0 {
+			return r.name
+		}
+		return fmt.Sprintf("%v: %v", r.name, strings.Join(why, ", "))
+	}
+	return ""
+}
+
+// match returns true when every condition of the rule matches f, and a
+// description of what matched.
+func (r *policyRule) match(f *prFacts) ([]string, bool) {
+	var why []string
+	if len(r.labels) > 0 {
+		l, ok := firstMatch(f.labels, func(v string) bool { return matchAny(r.labels, v) })
+		if !ok {
+			return nil, false
+		}
+		why = append(why, "label "+l)
+	}
+	if len(r.titles) > 0 {
+		if !matchAny(r.titles, f.title) {
+			return nil, false
+		}
+		why = append(why, fmt.Sprintf("title %q", f.title))
+	}
+	if len(r.updateTypes) > 0 {
+		t, ok := firstMatch(f.updateTypes, func(v string) bool { return containsFold(r.updateTypes, v) })
+		if !ok {
+			return nil, false
+		}
+		why = append(why, "update type "+t)
+	}
+	if len(r.managers) > 0 {
+		m, ok := firstMatch(f.managers, func(v string) bool { return containsFold(r.managers, v) })
+		if !ok {
+			return nil, false
+		}
+		why = append(why, "manager "+m)
+	}
+	if len(r.paths) > 0 {
+		p, ok := firstMatch(f.files, func(v string) bool { return matchAny(r.paths, v) })
+		if !ok {
+			return nil, false
+		}
+		why = append(why, "path "+p)
+	}
+	return why, true
+}
+
+// firstMatch returns the first of values accepted by match.
+func firstMatch(values []string, match func(string) bool) (string, bool) {
+	for _, v := range values {
+		if match(v) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+func containsFold(values []string, v string) bool {
+	for _, s := range values {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyPolicy returns the prs that the policy allows. Rejected PRs are
+// logged with the reason the first time they are rejected.
+func applyPolicy(ctx context.Context, r *gitrepo.GitRepo, cfg *mergeConfig, prs []*forge.PullRequest) ([]*forge.PullRequest, error) {
+	if len(cfg.policy.rules) == 0 {
+		return prs, nil
+	}
+	var allowed []*forge.PullRequest
+	for _, pr := range prs {
+		f, err := newPrFacts(ctx, r, pr, cfg.policy.needsFiles())
+		if err != nil {
+			return nil, err
+		}
+		reason := cfg.policy.decide(f)
+		if reason == "" {
+			delete(cfg.rejected, pr.Number)
+			allowed = append(allowed, pr)
+			continue
+		}
+		if cfg.rejected[pr.Number] != reason {
+			log.Printf("#%4d %v rejected by %v, skipping", pr.Number, pr.Title, reason)
+		}
+		cfg.rejected[pr.Number] = reason
+		cfg.report.addSkipped(pr, "rejected by "+reason)
+	}
+	return allowed, nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"testing"
+)
+
+func TestPolicyDecide(t *testing.T) {
+	p, err := newPolicy([]PolicyRule{
+		{Name: "trusted", Action: PolicyAllow, Titles: []string{"update module golang.org/x/*"}},
+		{Name: "no majors", UpdateTypes: []string{"major"}},
+		{Name: "manual", Labels: []string{"do-not-merge", "/hold-.*/"}},
+		{Name: "grpc", Titles: []string{"/.*google.golang.org/grpc .*/"}},
+		{Name: "protobuf", Titles: []string{"/protobuf/"}},
+		{Name: "deploy", Managers: []string{"dockerfile"}, Paths: []string{"deploy/*"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.needsFiles() {
+		t.Errorf("got needsFiles false")
+	}
+
+	tests := []struct {
+		name  string
+		facts prFacts
+		want  string
+	}{
+		{
+			name:  "no rule matches",
+			facts: prFacts{title: "update dependency eslint to v8.40.0", updateTypes: []string{"minor"}},
+		},
+		{
+			name:  "allowed before rejected",
+			facts: prFacts{title: "update module golang.org/x/oauth2 to v1", updateTypes: []string{"major"}},
+		},
+		{
+			name:  "major in group",
+			facts: prFacts{title: "update github actions", updateTypes: []string{"minor", "major"}},
+			want:  "no majors: update type major",
+		},
+		{
+			name:  "label regex",
+			facts: prFacts{title: "update foo", labels: []string{"dependencies", "hold-for-release"}},
+			want:  "manual: label hold-for-release",
+		},
+		{
+			name:  "title regex",
+			facts: prFacts{title: "fix(deps): update module google.golang.org/grpc to v1.55.0"},
+			want:  `grpc: title "fix(deps): update module google.golang.org/grpc to v1.55.0"`,
+		},
+		{
+			name:  "title regex must match the whole title",
+			facts: prFacts{title: "update module google.golang.org/protobuf to v1.30.0"},
+		},
+		{
+			name:  "manager and path",
+			facts: prFacts{title: "update node", files: []string{"deploy/web/Dockerfile"}, managers: []string{"dockerfile"}},
+			want:  "deploy: manager dockerfile, path deploy/web/Dockerfile",
+		},
+		{
+			name:  "manager without path",
+			facts: prFacts{title: "update node", files: []string{"Dockerfile"}, managers: []string{"dockerfile"}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := p.decide(&tc.facts); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewPolicyErrors(t *testing.T) {
+	for _, rules := range [][]PolicyRule{
+		{{Action: "merge"}},
+		{{Labels: []string{"/(/"}}},
+		{{Paths: []string{"/[/"}}},
+	} {
+		if _, err := newPolicy(rules); err == nil {
+			t.Errorf("newPolicy(%+v) got no error", rules)
+		}
+	}
+	p, err := newPolicy([]PolicyRule{{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.decide(&prFacts{title: "anything"}); got != "policy rule 1" {
+		t.Errorf("got %q for a rule that rejects everything", got)
+	}
+}
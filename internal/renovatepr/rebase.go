@@ -0,0 +1,162 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+	"github.com/hessjcg/git-gtool/internal/gitrepo"
+)
+
+const (
+	// RebaseWithCheckbox asks Renovate to rebase by ticking the rebase/retry
+	// checkbox in the PR body.
+	RebaseWithCheckbox = "checkbox"
+	// RebaseWithLabel asks Renovate to rebase by adding a label to the PR.
+	RebaseWithLabel = "label"
+	// DefaultRebaseLabel is Renovate's default rebase label.
+	DefaultRebaseLabel = "rebase"
+
+	// rebaseCheckbox is the unchecked rebase/retry checkbox that Renovate
+	// adds to the PR body.
+	rebaseCheckbox = "- [ ] <!-- rebase-check -->"
+	// rebaseChecked is the checkbox after it was ticked.
+	rebaseChecked = "- [x] <!-- rebase-check -->"
+)
+
+// ErrRebasing is returned while waiting for Renovate to rebase a PR.
+var ErrRebasing = fmt.Errorf("waiting for rebase")
+
+// rebaseTracker remembers the head SHA of each PR when a rebase was
+// requested, so that the PR is not evaluated again until Renovate pushes a
+// new commit. It is safe for concurrent use.
+type rebaseTracker struct {
+	mu      sync.Mutex
+	pending map[int]string
+}
+
+// requested records that a rebase of pr was requested.
+func (t *rebaseTracker) requested(pr *forge.PullRequest) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pending == nil {
+		t.pending = map[int]string{}
+	}
+	t.pending[pr.Number] = pr.HeadSHA
+}
+
+// waiting returns true when a rebase of pr was requested and the PR still
+// has the same head SHA.
+func (t *rebaseTracker) waiting(pr *forge.PullRequest) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sha, ok := t.pending[pr.Number]
+	if !ok {
+		return false
+	}
+	if sha == pr.HeadSHA {
+		return true
+	}
+	delete(t.pending, pr.Number)
+	return false
+}
+
+// needsRebase returns why pr can't be merged with method until it is
+// rebased, or "" if it does not need a rebase.
+func needsRebase(pr *forge.PullRequest, method string) string {
+	switch pr.MergeableState {
+	case "behind":
+		return "it is behind the base branch"
+	case "dirty":
+		return "it has merge conflicts"
+	}
+	if pr.Mergeable != nil && !*pr.Mergeable {
+		return "it has merge conflicts"
+	}
+	if method == MergeMethodRebase && pr.Rebaseable != nil && !*pr.Rebaseable {
+		return "it can't be rebased"
+	}
+	return ""
+}
+
+// rebaseIfStale asks Renovate to rebase pr when it is behind the base branch
+// or has conflicts. Returns ErrRebasing when a rebase was requested, or
+// while Renovate has not yet pushed a new head commit.
+func rebaseIfStale(ctx context.Context, r *gitrepo.GitRepo, m mutator, cfg *mergeConfig, pr *forge.PullRequest) error {
+	if cfg.rebases.waiting(pr) {
+		log.Printf("#%4d waiting for Renovate to rebase from %v", pr.Number, pr.HeadSHA)
+		return ErrRebasing
+	}
+
+	full, err := r.Forge.GetPullRequest(ctx, pr.Number)
+	if err != nil {
+		return err
+	}
+	reason := needsRebase(full, cfg.method)
+	if reason == "" {
+		return nil
+	}
+
+	log.Printf("#%4d needs a rebase, %s", pr.Number, reason)
+	err = requestRebase(ctx, m, cfg, full)
+	if err != nil {
+		return err
+	}
+	return ErrRebasing
+}
+
+// requestRebase asks Renovate to rebase pr, either by ticking the rebase/retry
+// checkbox in the PR body or by adding the rebase label.
+func requestRebase(ctx context.Context, m mutator, cfg *mergeConfig, pr *forge.PullRequest) error {
+	var err error
+	if cfg.rebaseWith == RebaseWithLabel {
+		err = addRebaseLabel(ctx, m, cfg.rebaseLabel, pr)
+	} else {
+		err = tickRebaseCheckbox(ctx, m, pr)
+	}
+	if err != nil {
+		return err
+	}
+	cfg.rebases.requested(pr)
+	return nil
+}
+
+// tickRebaseCheckbox ticks the rebase/retry checkbox in the PR body.
+func tickRebaseCheckbox(ctx context.Context, m mutator, pr *forge.PullRequest) error {
+	body := pr.Body
+	if strings.Contains(body, rebaseChecked) {
+		// Renovate has not yet picked up the last request.
+		return nil
+	}
+	if !strings.Contains(body, rebaseCheckbox) {
+		return fmt.Errorf("PR #%d has no rebase/retry checkbox", pr.Number)
+	}
+	return m.editPrBody(ctx, pr, strings.Replace(body, rebaseCheckbox, rebaseChecked, 1))
+}
+
+// addRebaseLabel adds label to the PR unless it is already there.
+func addRebaseLabel(ctx context.Context, m mutator, label string, pr *forge.PullRequest) error {
+	for _, l := range pr.Labels {
+		if l == label {
+			return nil
+		}
+	}
+	return m.addLabel(ctx, pr, label)
+}
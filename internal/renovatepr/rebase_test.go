@@ -0,0 +1,105 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+)
+
+// editMutator records PR body edits and labels.
+type editMutator struct {
+	dryRunMutator
+	body   string
+	labels []string
+}
+
+func (m *editMutator) editPrBody(_ context.Context, _ *forge.PullRequest, body string) error {
+	m.body = body
+	return nil
+}
+
+func (m *editMutator) addLabel(_ context.Context, _ *forge.PullRequest, label string) error {
+	m.labels = append(m.labels, label)
+	return nil
+}
+
+func TestNeedsRebase(t *testing.T) {
+	tcs := []struct {
+		name   string
+		pr     *forge.PullRequest
+		method string
+		want   bool
+	}{
+		{name: "clean", pr: &forge.PullRequest{MergeableState: "clean", Mergeable: boolPtr(true)}, method: MergeMethodSquash},
+		{name: "unknown", pr: &forge.PullRequest{}, method: MergeMethodSquash},
+		{name: "behind", pr: &forge.PullRequest{MergeableState: "behind"}, method: MergeMethodSquash, want: true},
+		{name: "dirty", pr: &forge.PullRequest{MergeableState: "dirty"}, method: MergeMethodSquash, want: true},
+		{name: "conflict", pr: &forge.PullRequest{Mergeable: boolPtr(false)}, method: MergeMethodSquash, want: true},
+		{name: "not rebaseable squash", pr: &forge.PullRequest{Rebaseable: boolPtr(false)}, method: MergeMethodSquash},
+		{name: "not rebaseable rebase", pr: &forge.PullRequest{Rebaseable: boolPtr(false)}, method: MergeMethodRebase, want: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := needsRebase(tc.pr, tc.method) != ""; got != tc.want {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRequestRebase(t *testing.T) {
+	pr := &forge.PullRequest{
+		Number:  5,
+		Body:    "Some text\n\n---\n\n - [ ] <!-- rebase-check -->If you want to rebase/retry this PR, check this box\n",
+		HeadSHA: "abc",
+	}
+
+	m := &editMutator{}
+	cfg := &mergeConfig{rebaseWith: RebaseWithCheckbox, rebases: &rebaseTracker{}}
+	if err := requestRebase(context.Background(), m, cfg, pr); err != nil {
+		t.Fatal(err)
+	}
+	want := "Some text\n\n---\n\n - [x] <!-- rebase-check -->If you want to rebase/retry this PR, check this box\n"
+	if m.body != want {
+		t.Fatalf("got body %q, want %q", m.body, want)
+	}
+	if !cfg.rebases.waiting(pr) {
+		t.Fatal("got not waiting, want waiting for the rebase")
+	}
+
+	// A new head commit means the rebase is done.
+	pr.HeadSHA = "def"
+	if cfg.rebases.waiting(pr) {
+		t.Fatal("got waiting, want the rebase done after a new head commit")
+	}
+
+	m = &editMutator{}
+	cfg = &mergeConfig{rebaseWith: RebaseWithLabel, rebaseLabel: "rebase", rebases: &rebaseTracker{}}
+	if err := requestRebase(context.Background(), m, cfg, pr); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.labels) != 1 || m.labels[0] != "rebase" || m.body != "" {
+		t.Fatalf("got labels %v and body %q, want only the rebase label", m.labels, m.body)
+	}
+
+	pr.Body = "no checkbox"
+	cfg = &mergeConfig{rebaseWith: RebaseWithCheckbox, rebases: &rebaseTracker{}}
+	if err := requestRebase(context.Background(), &editMutator{}, cfg, pr); err == nil {
+		t.Fatal("got nil, want error for a PR without the checkbox")
+	}
+}
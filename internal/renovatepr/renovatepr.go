@@ -16,379 +16,670 @@ package renovatepr
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"path/filepath"
 	"time"
 
-	"github.com/google/go-github/v51/github"
+	"github.com/hessjcg/git-gtool/internal/forge"
 	"github.com/hessjcg/git-gtool/internal/gitrepo"
-	"github.com/hessjcg/git-gtool/internal/model"
 )
 
 var (
-	approve         = "APPROVE"
 	lgtm            = "LGTM"
 	ErrFailedCheck  = fmt.Errorf("check failed")
 	ErrMissingCheck = fmt.Errorf("check missing")
 )
 
-// MergePRs finds all open PRs submitted by `renovate-bot` and attempts
-// to merge them.
-func MergePRs(ctx context.Context, repo *gitrepo.GitRepo) error {
-	var err error
+// Options configures MergePRs.
+type Options struct {
+	// DryRun when true, prints the actions that would be taken for each
+	// open Renovate PR instead of changing the repository.
+	DryRun bool
+	// AutoMerge when true, approves each open Renovate PR and enables Github
+	// auto-merge on it, then returns instead of merging the PRs one by one.
+	AutoMerge bool
+	// Wait when true with AutoMerge, waits for the PRs to be merged, logging
+	// each one as it lands.
+	Wait bool
+	// Authors are the login patterns of the dependency bots whose PRs
+	// should be merged. Defaults to DefaultAuthors.
+	Authors []string
+	// BranchPrefixes when not empty, limits the PRs to those with a head
+	// branch starting with one of these patterns.
+	BranchPrefixes []string
+	// MergeMethod is one of squash, rebase or merge. Defaults to squash.
+	MergeMethod string
+	// CommitTitle is a Go template for the merge commit title, executed
+	// with CommitData. Defaults to DefaultCommitTitle.
+	CommitTitle string
+	// CommitBody is a Go template for the merge commit body, executed with
+	// CommitData. When empty, Github chooses the commit body.
+	CommitBody string
+	// Parallel when greater than 0, evaluates all open PRs at once using
+	// this many workers, merges the green ones and asks Renovate to rebase
+	// the rest. Otherwise, PRs are merged one at a time.
+	Parallel int
+	// RebaseWith is how to ask Renovate to rebase a PR that is behind the
+	// base branch or has conflicts: checkbox or label. Defaults to checkbox.
+	RebaseWith string
+	// RebaseLabel is the label to add when RebaseWith is label. Defaults to
+	// DefaultRebaseLabel.
+	RebaseLabel string
+	// Timeout when greater than 0, stops merging PRs after this long.
+	Timeout time.Duration
+	// PollInterval is the first wait before polling Github for a change.
+	// Defaults to DefaultPollInterval.
+	PollInterval time.Duration
+	// MaxPollInterval is the longest wait between polls, the wait doubles
+	// after each poll up to this. Defaults to DefaultMaxPollInterval.
+	MaxPollInterval time.Duration
+	// MaxWait is the longest to wait for one change, like checks finishing,
+	// before trying again. Defaults to DefaultMaxWait.
+	MaxWait time.Duration
+	// MaxIterations is the most PRs to attempt. Defaults to
+	// DefaultMaxIterations.
+	MaxIterations int
+	// MaxErrors is the most errors in a row before giving up. Defaults to
+	// DefaultMaxErrors.
+	MaxErrors int
+	// NeutralChecks is what a required check run that concludes as neutral
+	// counts as: success, failure or pending. Defaults to success.
+	NeutralChecks string
+	// SkippedChecks is what a skipped required check run counts as: success,
+	// failure or pending. Defaults to success.
+	SkippedChecks string
+	// Policy rules decide which PRs may be merged unattended. PRs that are
+	// rejected are skipped.
+	Policy []PolicyRule
+	// NoRequiredChecks is what to do when neither branch protection nor the
+	// rulesets of the default branch require any checks. NoChecksFail stops
+	// with ErrNoRequiredChecks. NoChecksReported requires every check
+	// reported on a PR to pass before merging it. Defaults to NoChecksFail.
+	NoRequiredChecks string
+	// Strategy is the name of the strategy from Strategies that orders the
+	// PRs to attempt. Defaults to DefaultStrategy.
+	Strategy string
+	// ResetState when true, discards the session state saved by an earlier
+	// run before starting.
+	ResetState bool
+}
+
+// mergeConfig holds the settings for merging PRs, derived from Options.
+type mergeConfig struct {
+	match    *botMatcher
+	policy   *policy
+	method   string
+	commit   *commitTemplate
+	parallel int
+	checks   CheckPolicy
+	noChecks string
+	strategy Strategy
+
+	rebaseWith  string
+	rebaseLabel string
+	rebases     *rebaseTracker
+
+	waiter        *waiter
+	maxIterations int
+	maxErrors     int
+
+	// merged counts the PRs merged so far.
+	merged int
+	// queued counts the PRs added to the merge queue so far.
+	queued int
+	// rejected holds the reason the policy rejected each PR, by number.
+	rejected map[int]string
+	// state remembers the attempts and failures of each PR.
+	state *sessionState
+	// report collects the outcome of each PR.
+	report *reportBuilder
+}
+
+// newListConfig validates the options that select the PRs and returns a
+// mergeConfig with only what listRenovatePrs needs.
+func newListConfig(opts Options) (*mergeConfig, error) {
+	authors := opts.Authors
+	if len(authors) == 0 {
+		authors = DefaultAuthors
+	}
+	match, err := newBotMatcher(authors, opts.BranchPrefixes)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := newPolicy(opts.Policy)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mergeConfig{
+		match:    match,
+		policy:   policy,
+		rejected: map[int]string{},
+		state:    &sessionState{PRs: map[int]*prState{}},
+		report:   newReportBuilder(),
+	}, nil
+}
+
+// newMergeConfig validates opts and applies the defaults.
+func newMergeConfig(repo *gitrepo.GitRepo, opts Options) (*mergeConfig, error) {
+	cfg, err := newListConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	method := opts.MergeMethod
+	if method == "" {
+		method = MergeMethodSquash
+	}
+	err = checkMergeMethod(repo.Forge.Repository(), method)
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := newCommitTemplate(opts.CommitTitle, opts.CommitBody)
+	if err != nil {
+		return nil, err
+	}
+
+	rebaseWith := opts.RebaseWith
+	switch rebaseWith {
+	case "":
+		rebaseWith = RebaseWithCheckbox
+	case RebaseWithCheckbox, RebaseWithLabel:
+	default:
+		return nil, fmt.Errorf("unknown rebase option %q, use %v or %v", rebaseWith, RebaseWithCheckbox, RebaseWithLabel)
+	}
+	rebaseLabel := opts.RebaseLabel
+	if rebaseLabel == "" {
+		rebaseLabel = DefaultRebaseLabel
+	}
+
+	checks, err := newCheckPolicy(opts.NeutralChecks, opts.SkippedChecks)
+	if err != nil {
+		return nil, err
+	}
+	noChecks := opts.NoRequiredChecks
+	switch noChecks {
+	case "":
+		noChecks = NoChecksFail
+	case NoChecksFail, NoChecksReported:
+	default:
+		return nil, fmt.Errorf("unknown no required checks option %q, use %v or %v", noChecks, NoChecksFail, NoChecksReported)
+	}
+
+	name := opts.Strategy
+	if name == "" {
+		name = DefaultStrategy
+	}
+	strategy, ok := Strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q, use one of %v", name, strategyNames())
+	}
+
+	cfg.method = method
+	cfg.commit = commit
+	cfg.parallel = opts.Parallel
+	cfg.checks = checks
+	cfg.noChecks = noChecks
+	cfg.strategy = strategy
+
+	cfg.rebaseWith = rebaseWith
+	cfg.rebaseLabel = rebaseLabel
+	cfg.rebases = &rebaseTracker{}
+
+	cfg.waiter = &waiter{
+		interval:    orDefault(opts.PollInterval, DefaultPollInterval),
+		maxInterval: orDefault(opts.MaxPollInterval, DefaultMaxPollInterval),
+		maxWait:     orDefault(opts.MaxWait, DefaultMaxWait),
+	}
+	cfg.maxIterations = orDefault(opts.MaxIterations, DefaultMaxIterations)
+	cfg.maxErrors = orDefault(opts.MaxErrors, DefaultMaxErrors)
+	return cfg, nil
+}
+
+// orDefault returns v, or def when v is not greater than 0.
+func orDefault[T int | time.Duration](v, def T) T {
+	if v > 0 {
+		return v
+	}
+	return def
+}
+
+// MergePRs finds all open PRs submitted by the dependency bot authors and
+// attempts to merge them. Returns a Report of what happened to each PR, also
+// when it returns an error after starting.
+func MergePRs(ctx context.Context, repo *gitrepo.GitRepo, opts Options) (*Report, error) {
+	cfg, err := newMergeConfig(repo, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	// Resume from the state saved by an earlier run. A dry run reads it but
+	// leaves it alone.
+	var statePath string
+	if repo.GitDir != "" {
+		statePath = filepath.Join(repo.GitDir, StateFile)
+	}
+	cfg.state, err = loadState(statePath, repo.Owner+"/"+repo.Name, opts.ResetState && !opts.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		cfg.state.path = ""
+	}
+	if n := len(cfg.state.PRs); n > 0 {
+		log.Printf("Resuming the session saved in %v with %d PRs", statePath, n)
+	}
+
+	if opts.AutoMerge {
+		err = autoMergePRs(ctx, repo, cfg, opts.DryRun, opts.Wait)
+		if serr := cfg.state.save(); serr != nil {
+			log.Printf("%v", serr)
+		}
+		return cfg.report.report(0, opts.DryRun), err
+	}
+	if opts.DryRun {
+		err = planPRs(ctx, repo, cfg)
+		return cfg.report.report(0, true), err
+	}
+
+	start := time.Now()
 	var hasMore bool
+	var iterations int
 	errCount := 0
-	for i := 1; i < 100 && errCount < 10; i++ {
+	for i := 1; i <= cfg.maxIterations && errCount < cfg.maxErrors; i++ {
+		iterations = i
 		log.Printf("Merge Renovate PRs iteration %v", i)
-		hasMore, err = mergeStep(ctx, repo)
+		if cfg.parallel > 0 {
+			hasMore, err = parallelStep(ctx, repo, cfg)
+		} else {
+			hasMore, err = mergeStep(ctx, repo, cfg)
+		}
+		if serr := cfg.state.save(); serr != nil {
+			log.Printf("%v", serr)
+		}
+		if ctx.Err() != nil {
+			break
+		}
 		if !hasMore {
 			log.Printf("No more work to do")
 			break
 		}
-		if err != nil {
-			errCount++
-			log.Printf("Error: %v", err)
-			log.Printf("Sleeping for 2 minutes before trying again...")
-			time.Sleep(2 * time.Minute)
-		} else {
+		if err == nil {
 			log.Printf("Successfully merged PR. Attempting to merge another...")
 			errCount = 0
+			continue
+		}
+		if errors.Is(err, ErrFailedCheck) {
+			log.Printf("Trying the next PR.")
+			continue
+		}
+
+		var pending *pendingError
+		if errors.As(err, &pending) {
+			log.Printf("Not ready: %v", err)
+			err = cfg.waiter.wait(ctx, pending)
+		}
+		if err != nil && ctx.Err() == nil {
+			errCount++
+			log.Printf("Error: %v", err)
+			err = cfg.waiter.afterError(ctx, errCount)
+		}
+		if ctx.Err() != nil {
+			break
 		}
 	}
-	return err
-}
 
-// mergeStep Do one iteration, attempting to merge the oldest renovate-bot PR.
-// returns true when the command should attempt another step, and error if there
-// was an error during this step.
-func mergeStep(ctx context.Context, r *gitrepo.GitRepo) (bool, error) {
+	log.Printf("Merged %d PRs in %d iterations and %v", cfg.merged, iterations, time.Since(start).Round(time.Second))
+	if cfg.queued > 0 {
+		log.Printf("Added %d PRs to the merge queue", cfg.queued)
+	}
+	switch {
+	case errors.Is(ctx.Err(), context.Canceled):
+		log.Printf("Stopped.")
+		err = nil
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		err = fmt.Errorf("stopped after the %v timeout", opts.Timeout)
+	}
+	return cfg.report.report(iterations, false), err
+}
 
-	log.Printf("Listing renovate PRs for %v/%v targeting branch %v", r.Owner, r.Name, r.GithubRepo.GetDefaultBranch())
+// planPRs walks the same logic as mergeStep for every open Renovate PR,
+// logging the changes that would be made instead of making them.
+func planPRs(ctx context.Context, r *gitrepo.GitRepo, cfg *mergeConfig) error {
+	renovatePrs, err := listRenovatePrs(ctx, r, cfg)
+	if err != nil {
+		return err
+	}
+	if len(renovatePrs) == 0 {
+		log.Printf("No open Renovate PRs.")
+		return nil
+	}
 
-	// list all open PRs in order
-	g := &model.ListGenerator[github.PullRequest]{
-		Retrieve: func(opts github.ListOptions) ([]*github.PullRequest, *github.Response, error) {
-			return r.Client.PullRequests.List(ctx, r.Owner, r.Name, &github.PullRequestListOptions{
-				Sort:        "created",
-				State:       "open",
-				Base:        r.GithubRepo.GetDefaultBranch(),
-				ListOptions: opts,
-			})
-		},
+	activePr, err := chooseActivePr(ctx, r, cfg, renovatePrs)
+	if err != nil {
+		return err
+	}
+	log.Println()
+	if activePr == nil {
+		log.Printf("Dry run, all PRs failed their checks")
+		return nil
 	}
+	log.Printf("Dry run, next PR to merge would be #%d %v", activePr.Number, activePr.Title)
 
-	// filter all open PRs to just Renovate PRs
-	renovatePrs := make([]*github.PullRequest, 0, 20)
-	for g.HasNext() {
-		pr, err := g.Next()
+	for _, pr := range renovatePrs {
+		log.Println()
+		log.Printf("Plan for #%d %v", pr.Number, pr.Title)
+		m := &dryRunMutator{}
+		_, err := processPr(ctx, r, m, cfg, pr)
 		if err != nil {
-			return false, err
+			log.Printf("  stops with: %v", err)
 		}
-		if pr.GetUser().GetLogin() == "renovate-bot" {
-			renovatePrs = append(renovatePrs, pr)
+		if len(m.planned) == 0 {
+			log.Printf("  no changes planned")
 		}
 	}
+	return nil
+}
+
+// mergeStep does one iteration, attempting to merge the PR chosen by the
+// configured strategy among the matched dependency bot PRs. Returns true when
+// the command should attempt another step, and error if there was an error
+// during this step.
+func mergeStep(ctx context.Context, r *gitrepo.GitRepo, cfg *mergeConfig) (bool, error) {
+	renovatePrs, err := listRenovatePrs(ctx, r, cfg)
+	if err != nil {
+		return false, err
+	}
 
 	if len(renovatePrs) == 0 {
 		log.Printf("No open Renovate PRs.")
 		return false, nil
 	}
 
-	// Determine the Active PR
-	// Use the first Mergable PR and if none found, then use the oldest PR
-	activePr := chooseActivePr(renovatePrs)
-
-	// Approve pending workflow runs
-	err := approveWorkflowRuns(ctx, r.Client, r.Owner, r.Name, activePr)
+	// Determine the Active PR using the configured strategy
+	activePr, err := chooseActivePr(ctx, r, cfg, renovatePrs)
 	if err != nil {
-		return true, err
+		return false, err
+	}
+	if activePr == nil {
+		log.Printf("All open Renovate PRs failed their checks.")
+		return false, ErrFailedCheck
 	}
 
-	// Check Statuses Pass
-	err = checkStatusChecks(ctx, r.Client, r.Owner, r.Name, r.GithubRepo.GetDefaultBranch(), activePr)
-	if err == ErrMissingCheck {
+	cfg.state.attempt(activePr)
+	hasMore, err := processPr(ctx, r, &forgeMutator{f: r.Forge}, cfg, activePr)
+	var pending *pendingError
+	switch {
+	case errors.Is(err, ErrFailedCheck):
+		// Leave this PR until Renovate pushes a new commit
+		recordFailure(cfg, activePr, err)
 		return true, err
+	case err != nil && !errors.As(err, &pending) && !errors.Is(err, ErrNoRequiredChecks):
+		cfg.report.addSkipped(activePr, err.Error())
+	}
+	return hasMore, err
+}
+
+// recordFailure remembers that the checks of pr failed on its head commit.
+func recordFailure(cfg *mergeConfig, pr *forge.PullRequest, err error) {
+	cfg.state.failed(pr, err)
+	var checks []Check
+	var failed *failedChecksError
+	if errors.As(err, &failed) {
+		checks = failed.checks
 	}
+	cfg.report.addFailed(pr, checks)
+}
+
+// listRenovatePrs lists the open PRs submitted by the bots accepted by
+// cfg.match that target the default branch and are allowed by the policy,
+// in the order they were created.
+func listRenovatePrs(ctx context.Context, r *gitrepo.GitRepo, cfg *mergeConfig) ([]*forge.PullRequest, error) {
+	branch := r.Forge.Repository().DefaultBranch
+	log.Printf("Listing renovate PRs for %v/%v targeting branch %v", r.Owner, r.Name, branch)
+
+	// list all open PRs in order
+	prs, err := r.Forge.ListPullRequests(ctx, "open", branch)
 	if err != nil {
+		return nil, err
+	}
+
+	// filter all open PRs to just Renovate PRs
+	renovatePrs := make([]*forge.PullRequest, 0, 20)
+	for _, pr := range prs {
+		if cfg.match.Match(pr) {
+			renovatePrs = append(renovatePrs, pr)
+		}
+	}
+	cfg.state.prune(renovatePrs)
+	return applyPolicy(ctx, r, cfg, renovatePrs)
+}
+
+// processPr evaluates activePr, then approves and merges it as configured by
+// cfg, making changes to the repo through m. Returns true when the command
+// should attempt another step, and error if there was an error during this
+// step.
+func processPr(ctx context.Context, r *gitrepo.GitRepo, m mutator, cfg *mergeConfig, activePr *forge.PullRequest) (bool, error) {
+	err := evaluatePr(ctx, r, m, cfg, activePr)
+	if errors.Is(err, ErrFailedCheck) || errors.Is(err, ErrNoRequiredChecks) {
 		return false, err
 	}
+	if err != nil {
+		return true, err
+	}
 
 	// Approve the PR
-	err = approvePr(ctx, r.Client, r.Owner, r.Name, activePr)
+	err = approvePr(ctx, r, m, activePr)
 	if err != nil {
 		return true, err
 	}
 
-	return true, mergePr(ctx, r.Client, r.Owner, r.Name, activePr)
+	err = mergePr(ctx, r, m, cfg, activePr)
+	switch err {
+	case ErrMergeableUnknown:
+		return true, waitForMergeable(r, activePr, err)
+	case ErrInMergeQueue:
+		return true, waitForMergeQueue(r, activePr, err)
+	}
+	return true, err
 }
 
-func checkStatusChecks(ctx context.Context, client *github.Client, org string, repo string, base string, activePr *github.PullRequest) error {
-	// Holds combined check results from both status checks and workflow check runs.
-	checkResults := map[string]string{}
-
-	// List required status checks for the repo
-	requiredChecks, _, err := client.Repositories.GetRequiredStatusChecks(ctx, org, repo, base)
+// evaluatePr requests a rebase if needed, approves the workflows and checks
+// the statuses of pr. Returns a pendingError when it must wait for Renovate
+// or the checks.
+func evaluatePr(ctx context.Context, r *gitrepo.GitRepo, m mutator, cfg *mergeConfig, pr *forge.PullRequest) error {
+	rules, err := r.Forge.BranchRules(ctx, r.Forge.Repository().DefaultBranch)
 	if err != nil {
 		return err
 	}
-	for _, c := range requiredChecks.Checks {
-		context := c.Context
-		if c.AppID != nil {
-			context = fmt.Sprintf("%s/%d", c.Context, *c.AppID)
+
+	// Leave PRs in the merge queue alone, a rebase would remove them
+	if rules.MergeQueue {
+		queued, err := r.Forge.InMergeQueue(ctx, pr)
+		if err != nil {
+			return err
+		}
+		if queued {
+			return waitForMergeQueue(r, pr, ErrInMergeQueue)
 		}
-		// Set the status check to "missing" by default
-		checkResults[context] = "missing"
 	}
 
-	var count int
-	// Load statuses and update checkResults
-	statuses, err := checkStatuses(ctx, client, org, repo, activePr, count)
+	// Ask Renovate to rebase when the PR is behind or has conflicts
+	err = rebaseIfStale(ctx, r, m, cfg, pr)
+	if err == ErrRebasing {
+		return waitForRebase(r, pr, err)
+	}
 	if err != nil {
 		return err
 	}
-	for _, check := range statuses {
-		checkResults[check.context] = check.conclusion
-		if _, ok := checkResults[check.context]; ok {
-			checkResults[check.context] = check.conclusion
-		}
-	}
 
-	// load workload check runs and update checkResults
-	checks, err := checkCheckRuns(ctx, client, org, repo, activePr)
+	// Approve pending workflow runs
+	err = approveWorkflowRuns(ctx, r, m, cfg.state, pr)
 	if err != nil {
 		return err
 	}
-	for _, check := range checks {
-		context := check.context
-		if check.appId != nil {
-			context = fmt.Sprintf("%s/%d", check.context, *check.appId)
-		}
-		if _, ok := checkResults[context]; ok {
-			checkResults[context] = check.conclusion
-		}
-	}
-	var failedCheck bool
-	var missingCheck bool
-	for context, conclusion := range checkResults {
-		log.Printf("  required check %v: %v", context, conclusion)
-		switch conclusion {
-		case "success":
-			continue // do nothing
-		case "failed":
-			failedCheck = true
-		default:
-			missingCheck = true
-		}
-	}
-	if failedCheck {
-		return ErrFailedCheck
-	}
-	if missingCheck || len(checkResults) == 0 {
-		return ErrMissingCheck
+
+	// Check Statuses Pass
+	err = checkStatusChecks(ctx, r, cfg, rules, pr)
+	if err == ErrMissingCheck {
+		return waitForChecks(r, cfg, pr, err)
 	}
-	return nil
+	return err
 }
 
 // approvePr checks if there is not yet an "approve" review, and adds one.
-func approvePr(ctx context.Context, client *github.Client, org string, repo string, activePr *github.PullRequest) error {
+func approvePr(ctx context.Context, r *gitrepo.GitRepo, m mutator, activePr *forge.PullRequest) error {
 	// Check if the PR has been approved
-	rg := &model.ListGenerator[github.PullRequestReview]{
-		Retrieve: func(opts github.ListOptions) ([]*github.PullRequestReview, *github.Response, error) {
-			return client.PullRequests.ListReviews(ctx, org, repo, activePr.GetNumber(), &opts)
-		},
+	reviews, err := r.Forge.ListReviews(ctx, activePr.Number)
+	if err != nil {
+		return err
 	}
-
-	var approved bool
-	for rg.HasNext() {
-		review, err := rg.Next()
-		if err != nil {
-			return fmt.Errorf("Can't get review: %v", err)
-		}
-		if review.GetState() == "APPROVED" {
-			approved = true
+	for _, review := range reviews {
+		if review.State == "APPROVED" {
+			return nil
 		}
 	}
-	if approved {
-		return nil
-	}
 
 	// Attempt to approve the PR
-	log.Printf("Approving PR #%4d with LGTM message.", activePr.GetNumber())
-	lgtmReview, _, err := client.PullRequests.CreateReview(ctx, org, repo, activePr.GetNumber(), &github.PullRequestReviewRequest{
-		NodeID:   activePr.NodeID,
-		Body:     &lgtm,
-		CommitID: activePr.Head.SHA,
-		Event:    &approve,
-	})
-	if err != nil {
-		return fmt.Errorf("can't create LGTM review: %v/%v %v %v %v", org, repo, activePr.GetNumber(), activePr.GetTitle(), err)
-	}
-	client.PullRequests.SubmitReview(ctx, org, repo, activePr.GetNumber(), lgtmReview.GetID(), &github.PullRequestReviewRequest{
-		NodeID:   activePr.NodeID,
-		CommitID: activePr.Head.SHA,
-		Body:     &lgtm,
-		Event:    &approve,
-	})
-	if err != nil {
-		return fmt.Errorf("can't submit LGTM review: %v/%v %v %v %v", org, repo, activePr.GetNumber(), activePr.GetTitle(), err)
-	}
-	return nil
+	return m.approvePr(ctx, activePr)
 }
 
-// chooseActivePr returns the oldest PR that is mergeable or nil if none exists.
-func chooseActivePr(renovatePrs []*github.PullRequest) *github.PullRequest {
-	var activePr *github.PullRequest
-	for _, pr := range renovatePrs {
-		log.Printf("#%4d %s %s", pr.GetNumber(), pr.GetUser().GetLogin(), pr.GetTitle())
-		if pr.GetMergeable() {
-			activePr = pr
-		}
+// chooseActivePr orders renovatePrs using the configured strategy and returns
+// the first one, or nil when every PR failed its checks on the current head
+// commit.
+func chooseActivePr(ctx context.Context, r *gitrepo.GitRepo, cfg *mergeConfig, renovatePrs []*forge.PullRequest) (*forge.PullRequest, error) {
+	candidates, err := newCandidates(ctx, r, cfg, renovatePrs)
+	if err != nil {
+		return nil, err
 	}
-	if activePr == nil {
-		activePr = renovatePrs[0]
-		log.Println()
-		log.Printf("Attempting to merge PR:")
-		log.Printf("#%d %v", activePr.GetNumber(), activePr.GetTitle())
+	orderCandidates(cfg.strategy, candidates)
+	for _, c := range candidates {
+		if c.RecentFailure {
+			cfg.report.addSkipped(c.PR, fmt.Sprintf("failed on %.7s: %v", c.PR.HeadSHA, cfg.state.failure(c.PR)))
+		}
 	}
 
-	return activePr
-}
-
-type runResult struct {
-	appId      *int64
-	context    string
-	conclusion string
-}
-
-// checkStatuses returns a list of github statuses as run results.
-func checkStatuses(ctx context.Context, client *github.Client, org string, repo string, activePr *github.PullRequest, count int) ([]runResult, error) {
-	var results []runResult
-
-	// Load statuses from github api
-	reqStatusG := &model.PagedListGenerator[github.CombinedStatus, github.RepoStatus]{
-		Retrieve: func(opts github.ListOptions) (*github.CombinedStatus, []*github.RepoStatus, *github.Response, error) {
-			pg, res, err := client.Repositories.GetCombinedStatus(ctx, org, repo, activePr.Head.GetSHA(), &opts)
-			if err != nil {
-				return nil, nil, res, err
-			}
-			return pg, pg.Statuses, res, err
-		},
-	}
-	for reqStatusG.HasNext() {
-		_, status, err := reqStatusG.Next()
-		if err != nil {
-			return nil, fmt.Errorf("can't list workflows: %v/%v %v %v %v", org, repo, activePr.GetNumber(), activePr.GetTitle(), err)
-		}
-		results = append(results, runResult{
-			context:    status.GetContext(),
-			conclusion: status.GetState(),
-		})
+	first := candidates[0]
+	if first.RecentFailure {
+		return nil, nil
 	}
-	return results, nil
+	log.Println()
+	log.Printf("Attempting to merge PR:")
+	log.Printf("#%d %v", first.PR.Number, first.PR.Title)
+	return first.PR, nil
 }
 
 // approveWorkflowRuns determines if there are workflow runs for the current PR
 // head commit that are pending approval from a repository owner, and submits
 // approval to start the workflow runs.
-func approveWorkflowRuns(ctx context.Context, client *github.Client, org string, repo string, activePr *github.PullRequest) error {
-	wfg := &model.PagedListGenerator[github.WorkflowRuns, github.WorkflowRun]{
-		Retrieve: func(opts github.ListOptions) (*github.WorkflowRuns, []*github.WorkflowRun, *github.Response, error) {
-			r, req, err := client.Actions.ListRepositoryWorkflowRuns(ctx, org, repo, &github.ListWorkflowRunsOptions{
-				Event:       "pull_request",
-				Status:      "action_required",
-				Branch:      activePr.Head.GetRef(),
-				ListOptions: opts,
-			})
-			if err != nil {
-				return nil, nil, req, err
-			}
-			return r, r.WorkflowRuns, req, err
-		},
-	}
-
-	for wfg.HasNext() {
-		_, r, err := wfg.Next()
-		if err != nil {
-			return err
-		}
-		if r.GetHeadSHA() != activePr.GetHead().GetSHA() {
+func approveWorkflowRuns(ctx context.Context, r *gitrepo.GitRepo, m mutator, state *sessionState, activePr *forge.PullRequest) error {
+	runs, err := r.Forge.ListPendingWorkflowRuns(ctx, activePr.HeadRef)
+	if err != nil {
+		return err
+	}
+	for _, run := range runs {
+		if run.HeadSHA != activePr.HeadSHA {
 			continue
 		}
 
-		log.Printf(" Approving run: %v %v %v", r.GetURL(), r.GetConclusion(), r.GetHeadBranch())
-		req, err := client.NewRequest("POST", r.GetURL()+"/approve", nil)
+		err = m.approveWorkflowRun(ctx, run)
 		if err != nil {
 			return err
 		}
-		_, err = client.Do(ctx, req, nil)
-		if err != nil {
-			return fmt.Errorf("Can't approve workflow: %v", err)
-		}
+		state.approvedRun(activePr, run.ID)
 	}
 	return nil
 }
 
-// checkCheckRuns returns a list of run results for workflow check runs, which
-// confusingly is a different API from statuses.
-func checkCheckRuns(ctx context.Context, client *github.Client, org string, repo string, activePr *github.PullRequest) ([]runResult, error) {
-	var results []runResult
-
-	// Checks
-	reqStatusG := &model.PagedListGenerator[github.ListCheckRunsResults, github.CheckRun]{
-		Retrieve: func(opts github.ListOptions) (*github.ListCheckRunsResults, []*github.CheckRun, *github.Response, error) {
-			pg, res, err := client.Checks.ListCheckRunsForRef(ctx, org, repo, activePr.Head.GetSHA(), &github.ListCheckRunsOptions{
-				ListOptions: opts,
-			})
-			if err != nil {
-				return nil, nil, res, err
-			}
-			return pg, pg.CheckRuns, res, err
-		},
-	}
-	for reqStatusG.HasNext() {
-		_, status, err := reqStatusG.Next()
-		if err != nil {
-			return nil, fmt.Errorf("can't list check runs: %v/%v %v %v %v", org, repo, activePr.GetNumber(), activePr.GetTitle(), err)
-		}
-		conclusion := status.GetConclusion()
-		if conclusion == "" {
-			conclusion = status.GetStatus()
-		}
-		results = append(results, runResult{
-			appId:      status.GetApp().ID,
-			context:    status.GetName(),
-			conclusion: conclusion,
-		})
+// mergePr attempts to merge this PR onto the default branch using the
+// configured merge method and commit message.
+func mergePr(ctx context.Context, r *gitrepo.GitRepo, m mutator, cfg *mergeConfig, activePr *forge.PullRequest) error {
+	log.Printf("Attempting to merge #%4d %s ", activePr.Number, activePr.Title)
+	activePr, err := r.Forge.GetPullRequest(ctx, activePr.Number)
+	if err != nil {
+		return err
 	}
-	return results, nil
-}
 
-// mergePr attempts to do a rebase+squash of this PR onto the default branch.
-func mergePr(ctx context.Context, client *github.Client, org, repo string, activePr *github.PullRequest) error {
-	log.Printf("Attempting to merge #%4d %s ", activePr.GetNumber(), activePr.GetTitle())
-	activePr, _, err := client.PullRequests.Get(ctx, org, repo, activePr.GetNumber())
+	// When the PR is mergable, attempt to merge it
+	if cfg.method == MergeMethodRebase && (activePr.Rebaseable == nil || !*activePr.Rebaseable) {
+		return fmt.Errorf("unable to merge %v via %v method, it is not rebaseable", activePr.Number, cfg.method)
+	}
+	if activePr.Mergeable == nil {
+		log.Printf("The forge has not yet determined if #%d is mergeable", activePr.Number)
+		return ErrMergeableUnknown
+	}
+	if !*activePr.Mergeable {
+		return fmt.Errorf("unable to merge %v via %v method, it is not mergeable", activePr.Number, cfg.method)
+	}
+
+	// Render the commit message
+	title, body, err := commitMessage(ctx, r, cfg, activePr)
 	if err != nil {
 		return err
 	}
 
-	// When the PR is mergable, attempt to merge it
-	if !activePr.GetRebaseable() {
-		return fmt.Errorf("unable to merge %v via squash method, it is not rebaseable", activePr.GetNumber())
+	// The merge queue merges the PR using the merge method from its rule
+	rules, err := r.Forge.BranchRules(ctx, activePr.BaseRef)
+	if err != nil {
+		return err
 	}
-	mergeResult, _, err := client.PullRequests.Merge(ctx, org, repo, activePr.GetNumber(), activePr.GetState(), &github.PullRequestOptions{
-		MergeMethod: "squash",
-		CommitTitle: activePr.GetTitle(),
+	if rules.MergeQueue {
+		err = m.enqueuePr(ctx, activePr)
+		if errors.Is(err, errDryRun) {
+			cfg.report.addPlanned(activePr)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("unable to add %v to the merge queue: %v", activePr.Number, err)
+		}
+		cfg.queued++
+		cfg.report.addQueued(activePr)
+		return ErrInMergeQueue
+	}
+
+	mergeResult, err := m.mergePr(ctx, activePr, forge.MergeOptions{
+		Method: cfg.method,
+		Title:  title,
+		Body:   body,
+		SHA:    activePr.HeadSHA,
 	})
+	if errors.Is(err, errDryRun) {
+		cfg.report.addPlanned(activePr)
+		return nil
+	}
 	if mergeResult != nil {
-		log.Printf("  merged: %v, %s", mergeResult.GetMerged(), mergeResult.GetMessage())
-		if mergeResult.GetMerged() {
+		log.Printf("  merged: %v, %s", mergeResult.Merged, mergeResult.Message)
+		if mergeResult.Merged {
+			cfg.merged++
+			cfg.state.merged(activePr)
+			cfg.report.addMerged(activePr, mergeResult.SHA)
 			return nil
 		}
-		return fmt.Errorf("unable to merge %v via squash method: %v", activePr.GetNumber(), mergeResult.GetMessage())
+		return fmt.Errorf("unable to merge %v via %v method: %v", activePr.Number, cfg.method, mergeResult.Message)
 	}
 	if err != nil {
-		return fmt.Errorf("unable to merge %v via squash method: %v", activePr.GetNumber(), err)
+		return fmt.Errorf("unable to merge %v via %v method: %v", activePr.Number, cfg.method, err)
 	}
 
 	return nil
 }
+
+// commitMessage renders the merge commit title and body for pr using the
+// configured commit templates.
+func commitMessage(ctx context.Context, r *gitrepo.GitRepo, cfg *mergeConfig, pr *forge.PullRequest) (string, string, error) {
+	commits, err := r.Forge.ListCommits(ctx, pr.Number)
+	if err != nil {
+		return "", "", err
+	}
+	return cfg.commit.render(newCommitData(pr, commits))
+}
@@ -0,0 +1,206 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+)
+
+// Report summarizes what MergePRs did.
+type Report struct {
+	// Merged the PRs that were merged, in the order they were merged.
+	Merged []MergedPr `json:"merged"`
+	// Queued the PRs that were added to the merge queue.
+	Queued []ReportPr `json:"queued"`
+	// AutoMerge the PRs set to auto-merge, which the forge merges when their
+	// checks pass.
+	AutoMerge []ReportPr `json:"autoMerge"`
+	// Failed the PRs whose required checks failed.
+	Failed []FailedPr `json:"failed"`
+	// Skipped the PRs that were left open, and why.
+	Skipped []SkippedPr `json:"skipped"`
+	// Planned the PRs that a dry run would have merged, added to the merge
+	// queue or set to auto-merge.
+	Planned []ReportPr `json:"planned,omitempty"`
+	// DryRun true when nothing was changed.
+	DryRun bool `json:"dryRun,omitempty"`
+	// Iterations the number of iterations of the merge loop.
+	Iterations int `json:"iterations"`
+	// Started when the run started.
+	Started time.Time `json:"started"`
+	// Finished when the run finished.
+	Finished time.Time `json:"finished"`
+}
+
+// ReportPr identifies a PR in the Report.
+type ReportPr struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	URL    string `json:"url"`
+}
+
+// MergedPr is a PR that was merged.
+type MergedPr struct {
+	ReportPr
+	// SHA the merge commit.
+	SHA string `json:"sha"`
+}
+
+// FailedPr is a PR whose required checks failed.
+type FailedPr struct {
+	ReportPr
+	// Checks the checks that failed.
+	Checks []Check `json:"checks"`
+}
+
+// SkippedPr is a PR that was left open.
+type SkippedPr struct {
+	ReportPr
+	// Reason why the PR was skipped.
+	Reason string `json:"reason"`
+}
+
+// Duration returns the time spent on the run.
+func (r *Report) Duration() time.Duration {
+	return r.Finished.Sub(r.Started)
+}
+
+// reportBuilder collects the outcome of each PR during a run. A later outcome
+// replaces an earlier one for the same PR.
+type reportBuilder struct {
+	started   time.Time
+	merged    []MergedPr
+	queued    map[int]ReportPr
+	autoMerge map[int]ReportPr
+	planned   map[int]ReportPr
+	failed    map[int]FailedPr
+	skipped   map[int]SkippedPr
+}
+
+func newReportBuilder() *reportBuilder {
+	return &reportBuilder{
+		started:   time.Now(),
+		queued:    map[int]ReportPr{},
+		autoMerge: map[int]ReportPr{},
+		planned:   map[int]ReportPr{},
+		failed:    map[int]FailedPr{},
+		skipped:   map[int]SkippedPr{},
+	}
+}
+
+func reportPr(pr *forge.PullRequest) ReportPr {
+	return ReportPr{Number: pr.Number, Title: pr.Title, URL: pr.URL}
+}
+
+// forget removes the earlier outcome of pr.
+func (b *reportBuilder) forget(pr *forge.PullRequest) {
+	delete(b.queued, pr.Number)
+	delete(b.autoMerge, pr.Number)
+	delete(b.planned, pr.Number)
+	delete(b.failed, pr.Number)
+	delete(b.skipped, pr.Number)
+}
+
+func (b *reportBuilder) addMerged(pr *forge.PullRequest, sha string) {
+	b.forget(pr)
+	b.merged = append(b.merged, MergedPr{ReportPr: reportPr(pr), SHA: sha})
+}
+
+func (b *reportBuilder) addQueued(pr *forge.PullRequest) {
+	b.forget(pr)
+	b.queued[pr.Number] = reportPr(pr)
+}
+
+func (b *reportBuilder) addAutoMerge(pr *forge.PullRequest) {
+	b.forget(pr)
+	b.autoMerge[pr.Number] = reportPr(pr)
+}
+
+func (b *reportBuilder) addPlanned(pr *forge.PullRequest) {
+	b.forget(pr)
+	b.planned[pr.Number] = reportPr(pr)
+}
+
+func (b *reportBuilder) addFailed(pr *forge.PullRequest, checks []Check) {
+	b.forget(pr)
+	b.failed[pr.Number] = FailedPr{ReportPr: reportPr(pr), Checks: checks}
+}
+
+// addSkipped records why pr was skipped, unless it already failed this run.
+func (b *reportBuilder) addSkipped(pr *forge.PullRequest, reason string) {
+	if _, ok := b.failed[pr.Number]; ok {
+		return
+	}
+	b.forget(pr)
+	b.skipped[pr.Number] = SkippedPr{ReportPr: reportPr(pr), Reason: reason}
+}
+
+// report returns the Report, with the PRs in each list ordered by number.
+func (b *reportBuilder) report(iterations int, dryRun bool) *Report {
+	r := &Report{
+		Merged:     b.merged,
+		Queued:     sortedValues(b.queued, func(p ReportPr) int { return p.Number }),
+		AutoMerge:  sortedValues(b.autoMerge, func(p ReportPr) int { return p.Number }),
+		Planned:    sortedValues(b.planned, func(p ReportPr) int { return p.Number }),
+		Failed:     sortedValues(b.failed, func(p FailedPr) int { return p.Number }),
+		Skipped:    sortedValues(b.skipped, func(p SkippedPr) int { return p.Number }),
+		DryRun:     dryRun,
+		Iterations: iterations,
+		Started:    b.started,
+		Finished:   time.Now(),
+	}
+	if r.Merged == nil {
+		r.Merged = []MergedPr{}
+	}
+	return r
+}
+
+func sortedValues[T any](m map[int]T, number func(T) int) []T {
+	values := make([]T, 0, len(m))
+	for _, v := range m {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return number(values[i]) < number(values[j])
+	})
+	return values
+}
+
+// failedChecksError is returned when required checks failed. It wraps
+// ErrFailedCheck.
+type failedChecksError struct {
+	checks []Check
+}
+
+func (e *failedChecksError) Error() string {
+	var names []string
+	seen := map[string]bool{}
+	for _, c := range e.checks {
+		if !seen[c.Name] {
+			seen[c.Name] = true
+			names = append(names, c.Name)
+		}
+	}
+	return fmt.Sprintf("%v: %v", ErrFailedCheck, strings.Join(names, ", "))
+}
+
+func (e *failedChecksError) Unwrap() error {
+	return ErrFailedCheck
+}
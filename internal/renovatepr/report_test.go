@@ -0,0 +1,70 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReportBuilder(t *testing.T) {
+	b := newReportBuilder()
+	b.addSkipped(statePr(1, "aaa"), "rejected by no major updates")
+	b.addFailed(statePr(2, "bbb"), []Check{{Name: "test", URL: "https://example.com/test"}})
+	b.addSkipped(statePr(2, "bbb"), "failed on bbb")
+	b.addSkipped(statePr(3, "ccc"), "not mergeable")
+	b.addMerged(statePr(3, "ccc"), "1234567890")
+	b.addQueued(statePr(4, "ddd"))
+	b.addPlanned(statePr(5, "eee"))
+	b.addQueued(statePr(6, "fff"))
+	b.addAutoMerge(statePr(6, "fff"))
+
+	r := b.report(2, false)
+	if len(r.Merged) != 1 || r.Merged[0].Number != 3 || r.Merged[0].SHA != "1234567890" {
+		t.Errorf("got merged %v, want #3", r.Merged)
+	}
+	if len(r.Queued) != 1 || r.Queued[0].Number != 4 {
+		t.Errorf("got queued %v, want #4", r.Queued)
+	}
+	if len(r.AutoMerge) != 1 || r.AutoMerge[0].Number != 6 {
+		t.Errorf("got auto-merge %v, want #6", r.AutoMerge)
+	}
+	if len(r.Planned) != 1 || r.Planned[0].Number != 5 {
+		t.Errorf("got planned %v, want #5", r.Planned)
+	}
+	if len(r.Failed) != 1 || r.Failed[0].Number != 2 || r.Failed[0].Checks[0].Name != "test" {
+		t.Errorf("got failed %v, want #2", r.Failed)
+	}
+	if len(r.Skipped) != 1 || r.Skipped[0].Number != 1 {
+		t.Errorf("got skipped %v, want #1", r.Skipped)
+	}
+	if r.Iterations != 2 || r.Duration() < 0 {
+		t.Errorf("got %v iterations in %v", r.Iterations, r.Duration())
+	}
+}
+
+func TestFailedChecksError(t *testing.T) {
+	var err error = &failedChecksError{checks: []Check{
+		{Name: "build", Result: "failure"},
+		{Name: "test", Result: "timed_out"},
+		{Name: "build", Result: "cancelled"},
+	}}
+	if !errors.Is(err, ErrFailedCheck) {
+		t.Errorf("got %v, want it to wrap ErrFailedCheck", err)
+	}
+	if got, want := err.Error(), "check failed: build, test"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"fmt"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+)
+
+const (
+	// NoChecksFail stops with ErrNoRequiredChecks when the base branch has no
+	// required checks.
+	NoChecksFail = "fail"
+	// NoChecksReported requires all the checks reported on the PR to pass
+	// when the base branch has no required checks.
+	NoChecksReported = "reported"
+)
+
+var (
+	ErrNoRequiredChecks = fmt.Errorf("no required checks configured")
+	ErrInMergeQueue     = fmt.Errorf("in the merge queue")
+)
+
+// reportedChecks returns the checks as required checks, used when the
+// branch has no required checks and the policy is NoChecksReported.
+func reportedChecks(checks []Check) []forge.RequiredCheck {
+	rules := &forge.BranchRules{}
+	for _, c := range checks {
+		req := forge.RequiredCheck{Context: c.Name}
+		if c.AppID != 0 {
+			id := c.AppID
+			req.AppID = &id
+		}
+		rules.AddCheck(req)
+	}
+	return rules.Checks
+}
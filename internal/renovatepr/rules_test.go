@@ -0,0 +1,31 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import "testing"
+
+func TestReportedChecks(t *testing.T) {
+	required := reportedChecks(recordedChecks(t))
+	if len(required) != 15 {
+		t.Errorf("got %d reported checks, want 15", len(required))
+	}
+	err := checksError(evaluateChecks(required, recordedChecks(t), DefaultCheckPolicy))
+	if err != ErrFailedCheck {
+		t.Errorf("got %v, want %v", err, ErrFailedCheck)
+	}
+	if err := checksError(evaluateChecks(reportedChecks(nil), nil, DefaultCheckPolicy)); err != ErrMissingCheck {
+		t.Errorf("got %v with no reported checks, want %v", err, ErrMissingCheck)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+)
+
+// StateFile is the session state file, relative to the git dir.
+const StateFile = "gtool/renovate-state.json"
+
+// sessionState remembers what happened to each PR across runs, so that an
+// interrupted run can be resumed. It is safe for concurrent use.
+type sessionState struct {
+	mu sync.Mutex
+	// path the state file, or "" to keep the state in memory only.
+	path string
+
+	// Repo the owner/name of the repository the state belongs to.
+	Repo string `json:"repo"`
+	// PRs the state of each PR, by number.
+	PRs map[int]*prState `json:"prs"`
+}
+
+// prState is the saved state of one PR.
+type prState struct {
+	// Attempts the number of times the PR was evaluated for merging.
+	Attempts int `json:"attempts"`
+	// HeadSHA the head commit when the PR was last evaluated.
+	HeadSHA string `json:"headSha"`
+	// FailedSHA the head commit when the PR last failed.
+	FailedSHA string `json:"failedSha,omitempty"`
+	// Failure the reason the PR last failed.
+	Failure string `json:"failure,omitempty"`
+	// ApprovedRuns the IDs of the workflow runs approved for the PR.
+	ApprovedRuns []int64 `json:"approvedRuns,omitempty"`
+	// Updated when the PR state last changed.
+	Updated time.Time `json:"updated"`
+}
+
+// loadState reads the state for repo from path. A missing file, or one
+// that belongs to another repository, gives an empty state. When reset is
+// true, the saved state is discarded.
+func loadState(path, repo string, reset bool) (*sessionState, error) {
+	empty := &sessionState{path: path, Repo: repo, PRs: map[int]*prState{}}
+	if path == "" {
+		return empty, nil
+	}
+	if reset {
+		err := os.Remove(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("can't reset the session state: %v", err)
+		}
+		return empty, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return empty, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read the session state: %v", err)
+	}
+	s := &sessionState{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("can't read the session state %v: %v, use --reset to discard it", path, err)
+	}
+	if s.Repo != repo || s.PRs == nil {
+		return empty, nil
+	}
+	s.path = path
+	return s, nil
+}
+
+// save writes the state file, replacing it atomically.
+func (s *sessionState) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("can't save the session state: %v", err)
+	}
+	f, err := os.CreateTemp(dir, "tmp-*")
+	if err != nil {
+		return fmt.Errorf("can't save the session state: %v", err)
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("can't save the session state: %v", err)
+	}
+	return nil
+}
+
+// get returns the state of pr, adding it when missing. A new head commit
+// clears the last failure. Must be called with s.mu held.
+func (s *sessionState) get(pr *forge.PullRequest) *prState {
+	p, ok := s.PRs[pr.Number]
+	if !ok {
+		p = &prState{}
+		s.PRs[pr.Number] = p
+	}
+	if sha := pr.HeadSHA; p.HeadSHA != sha {
+		p.HeadSHA = sha
+		p.FailedSHA = ""
+		p.Failure = ""
+	}
+	p.Updated = time.Now()
+	return p
+}
+
+// attempt records that pr is being evaluated for merging.
+func (s *sessionState) attempt(pr *forge.PullRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.get(pr).Attempts++
+}
+
+// failed records that pr failed on its head commit because of err.
+func (s *sessionState) failed(pr *forge.PullRequest, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.get(pr)
+	p.FailedSHA = pr.HeadSHA
+	p.Failure = err.Error()
+}
+
+// approvedRun records that the workflow run with id was approved for pr.
+func (s *sessionState) approvedRun(pr *forge.PullRequest, id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.get(pr)
+	p.ApprovedRuns = append(p.ApprovedRuns, id)
+}
+
+// merged forgets pr once it has been merged.
+func (s *sessionState) merged(pr *forge.PullRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.PRs, pr.Number)
+}
+
+// failure returns the reason pr failed on its current head commit, or ""
+// when it has not.
+func (s *sessionState) failure(pr *forge.PullRequest) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.PRs[pr.Number]
+	if !ok || p.FailedSHA == "" || p.FailedSHA != pr.HeadSHA {
+		return ""
+	}
+	return p.Failure
+}
+
+// prune forgets the PRs that are no longer open.
+func (s *sessionState) prune(open []*forge.PullRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keep := map[int]bool{}
+	for _, pr := range open {
+		keep[pr.Number] = true
+	}
+	for n := range s.PRs {
+		if !keep[n] {
+			delete(s.PRs, n)
+		}
+	}
+}
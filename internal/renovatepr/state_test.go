@@ -0,0 +1,119 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+)
+
+func statePr(number int, sha string) *forge.PullRequest {
+	return &forge.PullRequest{Number: number, HeadSHA: sha}
+}
+
+func TestSessionState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), StateFile)
+	s, err := loadState(path, "owner/repo", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.attempt(statePr(1, "aaa"))
+	s.attempt(statePr(1, "aaa"))
+	s.failed(statePr(1, "aaa"), fmt.Errorf("check failed: test"))
+	s.attempt(statePr(2, "bbb"))
+	s.approvedRun(statePr(2, "bbb"), 42)
+	s.attempt(statePr(3, "ccc"))
+	s.merged(statePr(3, "ccc"))
+	if err := s.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = loadState(path, "owner/repo", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(s.PRs); got != 2 {
+		t.Fatalf("got %v PRs, want 2", got)
+	}
+	if got := s.PRs[1].Attempts; got != 2 {
+		t.Errorf("got %v attempts, want 2", got)
+	}
+	if got := s.failure(statePr(1, "aaa")); got != "check failed: test" {
+		t.Errorf("got failure %q on the same commit", got)
+	}
+	if got := s.failure(statePr(1, "ddd")); got != "" {
+		t.Errorf("got failure %q on a new commit, want none", got)
+	}
+	if got := s.PRs[2].ApprovedRuns; len(got) != 1 || got[0] != 42 {
+		t.Errorf("got approved runs %v, want [42]", got)
+	}
+
+	// A new head commit clears the failure
+	s.attempt(statePr(1, "ddd"))
+	if got := s.failure(statePr(1, "ddd")); got != "" {
+		t.Errorf("got failure %q after a new commit, want none", got)
+	}
+
+	s.prune([]*forge.PullRequest{statePr(2, "bbb")})
+	if _, ok := s.PRs[1]; ok {
+		t.Errorf("got closed PR #1 after prune")
+	}
+}
+
+func TestLoadState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), StateFile)
+	s, _ := loadState(path, "owner/repo", false)
+	s.failed(statePr(1, "aaa"), ErrFailedCheck)
+	if err := s.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		repo  string
+		reset bool
+		want  int
+	}{
+		{name: "same repo", repo: "owner/repo", want: 1},
+		{name: "other repo", repo: "owner/other", want: 0},
+		{name: "reset", repo: "owner/repo", reset: true, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := loadState(path, tt.repo, tt.reset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(s.PRs); got != tt.want {
+				t.Errorf("got %v PRs, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("got state file after reset, err %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadState(path, "owner/repo", false); err == nil {
+		t.Errorf("got no error for a corrupt state file")
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"context"
+	"log"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+	"github.com/hessjcg/git-gtool/internal/gitrepo"
+)
+
+// DefaultStrategy is the name of the strategy used when none is configured.
+const DefaultStrategy = "score"
+
+// Candidate is an open Renovate PR considered for the next merge.
+type Candidate struct {
+	// PR the pull request.
+	PR *forge.PullRequest
+	// Checks the combined state of the required checks: success, failure
+	// or pending.
+	Checks CheckState
+	// Updates the dependency updates parsed from the PR body.
+	Updates []DependencyUpdate
+	// LockFileOnly true when the PR only changes lock files.
+	LockFileOnly bool
+	// RecentFailure true when the checks failed on the current head commit.
+	RecentFailure bool
+}
+
+// Strategy decides the order to attempt PRs in.
+type Strategy interface {
+	// Less returns true when a should be attempted before b.
+	Less(a, b *Candidate) bool
+	// Describe explains the position of c in the order.
+	Describe(c *Candidate) string
+}
+
+// Strategies are the strategies that may be chosen by name in Options.
+var Strategies = map[string]Strategy{
+	"score":  ScoreStrategy{},
+	"oldest": OldestStrategy{},
+}
+
+// strategyNames returns the names of the Strategies in order.
+func strategyNames() []string {
+	var names []string
+	for n := range Strategies {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ScoreStrategy prefers PRs whose required checks already passed, then
+// patch before minor before major updates, then PRs that only change lock
+// files. PRs that failed on their current head commit go last. Ties keep
+// the oldest PR first.
+type ScoreStrategy struct{}
+
+func (ScoreStrategy) Less(a, b *Candidate) bool {
+	if a.RecentFailure != b.RecentFailure {
+		return b.RecentFailure
+	}
+	if ca, cb := checksRank(a.Checks), checksRank(b.Checks); ca != cb {
+		return ca < cb
+	}
+	if ua, ub := updateRank(a.Updates), updateRank(b.Updates); ua != ub {
+		return ua < ub
+	}
+	return a.LockFileOnly && !b.LockFileOnly
+}
+
+func (ScoreStrategy) Describe(c *Candidate) string {
+	var d []string
+	if c.RecentFailure {
+		d = append(d, "failed recently")
+	}
+	d = append(d, "checks "+string(c.Checks))
+	if t := worstUpdate(c.Updates); t != "" {
+		d = append(d, t)
+	}
+	if c.LockFileOnly {
+		d = append(d, "lock files only")
+	}
+	return strings.Join(d, ", ")
+}
+
+// OldestStrategy attempts the oldest PR first, leaving PRs that failed on
+// their current head commit for last.
+type OldestStrategy struct{}
+
+func (OldestStrategy) Less(a, b *Candidate) bool {
+	return !a.RecentFailure && b.RecentFailure
+}
+
+func (OldestStrategy) Describe(c *Candidate) string {
+	if c.RecentFailure {
+		return "failed recently"
+	}
+	return "created " + c.PR.CreatedAt.Format("2006-01-02")
+}
+
+// checksRank orders check states from most to least ready to merge.
+func checksRank(s CheckState) int {
+	switch s {
+	case CheckSuccess:
+		return 0
+	case CheckPending:
+		return 1
+	}
+	return 2
+}
+
+// updateRanks orders the update types from least to most risky.
+var updateRanks = map[string]int{
+	UpdatePin:    0,
+	UpdateDigest: 0,
+	UpdatePatch:  0,
+	UpdateMinor:  1,
+	UpdateMajor:  2,
+}
+
+// updateRank returns the rank of the riskiest update in a PR. Unknown update
+// types rank between minor and major.
+func updateRank(updates []DependencyUpdate) int {
+	var rank int
+	for _, u := range updates {
+		r, ok := updateRanks[u.UpdateType]
+		if !ok {
+			r = 1
+		}
+		if r > rank {
+			rank = r
+		}
+	}
+	return rank
+}
+
+// worstUpdate returns the riskiest update type in a PR.
+func worstUpdate(updates []DependencyUpdate) string {
+	var worst string
+	rank := -1
+	for _, u := range updates {
+		if r, ok := updateRanks[u.UpdateType]; ok && r > rank {
+			worst, rank = u.UpdateType, r
+		}
+	}
+	return worst
+}
+
+// lockFiles are the file names of package manager lock files.
+var lockFiles = map[string]bool{
+	"go.sum":              true,
+	"package-lock.json":   true,
+	"npm-shrinkwrap.json": true,
+	"yarn.lock":           true,
+	"pnpm-lock.yaml":      true,
+	"Cargo.lock":          true,
+	"Gemfile.lock":        true,
+	"poetry.lock":         true,
+	"Pipfile.lock":        true,
+	"composer.lock":       true,
+	"gradle.lockfile":     true,
+	".terraform.lock.hcl": true,
+}
+
+// onlyLockFiles returns true when every file is a lock file.
+func onlyLockFiles(files []string) bool {
+	for _, f := range files {
+		if !lockFiles[path.Base(f)] {
+			return false
+		}
+	}
+	return len(files) > 0
+}
+
+// newCandidates loads the check state and changed files of each of prs.
+func newCandidates(ctx context.Context, r *gitrepo.GitRepo, cfg *mergeConfig, prs []*forge.PullRequest) ([]*Candidate, error) {
+	rules, err := r.Forge.BranchRules(ctx, r.Forge.Repository().DefaultBranch)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []*Candidate
+	for _, pr := range prs {
+		c := &Candidate{
+			PR:            pr,
+			Updates:       ParseUpdates(pr.Body),
+			RecentFailure: cfg.state.failure(pr) != "",
+		}
+
+		results, err := requiredCheckResults(ctx, r, cfg, rules, pr)
+		switch {
+		case err == ErrNoRequiredChecks:
+			c.Checks = CheckPending
+		case err != nil:
+			return nil, err
+		default:
+			switch checksError(results) {
+			case nil:
+				c.Checks = CheckSuccess
+			case ErrFailedCheck:
+				c.Checks = CheckFailure
+			default:
+				c.Checks = CheckPending
+			}
+		}
+
+		files, err := listPrFiles(ctx, r, pr)
+		if err != nil {
+			return nil, err
+		}
+		c.LockFileOnly = onlyLockFiles(files)
+
+		candidates = append(candidates, c)
+	}
+	return candidates, nil
+}
+
+// orderCandidates sorts candidates using the strategy, keeping the list
+// order for ties, and logs the order.
+func orderCandidates(s Strategy, candidates []*Candidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return s.Less(candidates[i], candidates[j])
+	})
+	log.Printf("PRs in the order they will be attempted:")
+	for i, c := range candidates {
+		log.Printf("%3d. #%4d %s (%s)", i+1, c.PR.Number, c.PR.Title, s.Describe(c))
+	}
+}
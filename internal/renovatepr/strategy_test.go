@@ -0,0 +1,155 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"testing"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+)
+
+func candidate(number int, checks CheckState, updateType string, lockFileOnly, recentFailure bool) *Candidate {
+	c := &Candidate{
+		PR:            &forge.PullRequest{Number: number},
+		Checks:        checks,
+		LockFileOnly:  lockFileOnly,
+		RecentFailure: recentFailure,
+	}
+	if updateType != "" {
+		c.Updates = []DependencyUpdate{{UpdateType: updateType}}
+	}
+	return c
+}
+
+func order(candidates []*Candidate) []int {
+	var numbers []int
+	for _, c := range candidates {
+		numbers = append(numbers, c.PR.Number)
+	}
+	return numbers
+}
+
+func TestOrderCandidates(t *testing.T) {
+	tests := []struct {
+		name       string
+		strategy   Strategy
+		candidates []*Candidate
+		want       []int
+	}{
+		{
+			name:     "green checks first",
+			strategy: ScoreStrategy{},
+			candidates: []*Candidate{
+				candidate(1, CheckFailure, UpdatePatch, false, false),
+				candidate(2, CheckPending, UpdatePatch, false, false),
+				candidate(3, CheckSuccess, UpdateMajor, false, false),
+			},
+			want: []int{3, 2, 1},
+		},
+		{
+			name:     "patch before minor before major",
+			strategy: ScoreStrategy{},
+			candidates: []*Candidate{
+				candidate(1, CheckSuccess, UpdateMajor, false, false),
+				candidate(2, CheckSuccess, UpdateMinor, false, false),
+				candidate(3, CheckSuccess, "", false, false),
+				candidate(4, CheckSuccess, UpdateDigest, false, false),
+			},
+			want: []int{3, 4, 2, 1},
+		},
+		{
+			name:     "lock files only first",
+			strategy: ScoreStrategy{},
+			candidates: []*Candidate{
+				candidate(1, CheckSuccess, UpdatePatch, false, false),
+				candidate(2, CheckSuccess, UpdatePatch, true, false),
+				candidate(3, CheckSuccess, UpdatePatch, false, false),
+			},
+			want: []int{2, 1, 3},
+		},
+		{
+			name:     "recent failures last",
+			strategy: ScoreStrategy{},
+			candidates: []*Candidate{
+				candidate(1, CheckSuccess, UpdatePatch, true, true),
+				candidate(2, CheckFailure, UpdateMajor, false, false),
+			},
+			want: []int{2, 1},
+		},
+		{
+			name:     "oldest keeps the list order",
+			strategy: OldestStrategy{},
+			candidates: []*Candidate{
+				candidate(1, CheckFailure, UpdateMajor, false, true),
+				candidate(2, CheckFailure, UpdateMajor, false, false),
+				candidate(3, CheckSuccess, UpdatePatch, true, false),
+			},
+			want: []int{2, 3, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderCandidates(tt.strategy, tt.candidates)
+			got := order(tt.candidates)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateRank(t *testing.T) {
+	tests := []struct {
+		types []string
+		want  int
+	}{
+		{want: 0},
+		{types: []string{UpdatePatch, UpdatePin}, want: 0},
+		{types: []string{UpdatePatch, UpdateMinor}, want: 1},
+		{types: []string{"replacement"}, want: 1},
+		{types: []string{UpdateMinor, UpdateMajor, UpdatePatch}, want: 2},
+	}
+	for _, tt := range tests {
+		var updates []DependencyUpdate
+		for _, u := range tt.types {
+			updates = append(updates, DependencyUpdate{UpdateType: u})
+		}
+		if got := updateRank(updates); got != tt.want {
+			t.Errorf("updateRank(%v) got %v, want %v", tt.types, got, tt.want)
+		}
+	}
+}
+
+func TestOnlyLockFiles(t *testing.T) {
+	tests := []struct {
+		files []string
+		want  bool
+	}{
+		{want: false},
+		{files: []string{"go.sum"}, want: true},
+		{files: []string{"web/package-lock.json", "yarn.lock"}, want: true},
+		{files: []string{"go.mod", "go.sum"}, want: false},
+	}
+	for _, tt := range tests {
+		if got := onlyLockFiles(tt.files); got != tt.want {
+			t.Errorf("onlyLockFiles(%v) got %v, want %v", tt.files, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The update types that Renovate reports.
+const (
+	UpdateMajor  = "major"
+	UpdateMinor  = "minor"
+	UpdatePatch  = "patch"
+	UpdateDigest = "digest"
+	UpdatePin    = "pin"
+)
+
+var (
+	// changePattern matches the versions in the Change column of the table,
+	// like `v1.2.3` -> `v1.3.0`.
+	changePattern = regexp.MustCompile("`([^`]+)`\\s*(?:->|→)\\s*`([^`]+)`")
+	// digestPattern matches 7 to 64 lowercase hex digits, with an optional
+	// sha256: prefix, like a git commit or docker image digest. It also
+	// matches a date version like 20230115, so callers check for a letter.
+	digestPattern = regexp.MustCompile(`^(sha256:)?[0-9a-f]{7,64}$`)
+	// versionPattern matches the numeric parts at the start of a version.
+	versionPattern = regexp.MustCompile(`^[vV]?(\d+)(?:\.(\d+))?(?:\.(\d+))?`)
+	// linkPattern matches a markdown link at the start of a cell.
+	linkPattern = regexp.MustCompile(`^\[([^\]]+)\]\(([^)]+)\)`)
+	// datasourcePattern matches the datasource in the merge confidence badge
+	// urls, from the current and the older badge service.
+	datasourcePattern = regexp.MustCompile(`(?:/api/mc/badges/[a-z]+|badges\.renovateapi\.com/packages)/([a-z0-9-]+)/`)
+)
+
+// DependencyUpdate is one dependency updated by a Renovate PR, parsed from
+// the table in the PR body.
+type DependencyUpdate struct {
+	// Package the package name.
+	Package string `json:"package"`
+	// URL the link to the package source, when the table has one.
+	URL string `json:"url,omitempty"`
+	// Datasource where Renovate looks up the package versions, like go or
+	// npm. Only known when the table has merge confidence badges.
+	Datasource string `json:"datasource,omitempty"`
+	// DepType the Type column, like action or require.
+	DepType string `json:"depType,omitempty"`
+	// From the current version.
+	From string `json:"from"`
+	// To the new version.
+	To string `json:"to"`
+	// UpdateType one of the Update constants, or "" when not known.
+	UpdateType string `json:"updateType,omitempty"`
+	// Grouped true when the PR updates more than one dependency.
+	Grouped bool `json:"grouped"`
+}
+
+// ParseUpdates returns the dependency updates from the table in a Renovate
+// PR body. The update type is read from the Update column when Renovate
+// includes it, and otherwise found by comparing the versions.
+func ParseUpdates(body string) []DependencyUpdate {
+	rows := bodyTable(body)
+	updates := make([]DependencyUpdate, 0, len(rows))
+	for _, row := range rows {
+		u := DependencyUpdate{
+			DepType:    row["type"],
+			UpdateType: strings.ToLower(row["update"]),
+			Grouped:    len(rows) > 1,
+		}
+		u.Package, u.URL = packageCell(row["package"])
+		if m := changePattern.FindStringSubmatch(row["change"]); m != nil {
+			u.From, u.To = m[1], m[2]
+		}
+		if u.UpdateType == "" {
+			u.UpdateType = compareVersions(u.From, u.To)
+		}
+		for _, c := range row {
+			if m := datasourcePattern.FindStringSubmatch(c); m != nil {
+				u.Datasource = m[1]
+				break
+			}
+		}
+		updates = append(updates, u)
+	}
+	return updates
+}
+
+// packageCell returns the package name and link from the Package column,
+// like [name](url) ([source](url)).
+func packageCell(cell string) (string, string) {
+	if m := linkPattern.FindStringSubmatch(cell); m != nil {
+		return strings.Trim(m[1], "`"), m[2]
+	}
+	name, _, _ := strings.Cut(cell, " (")
+	return strings.Trim(name, "`"), ""
+}
+
+// updateTypes returns the update type of each dependency updated by a
+// Renovate PR with body. Types that can't be determined are left out.
+func updateTypes(body string) []string {
+	var types []string
+	for _, u := range ParseUpdates(body) {
+		if u.UpdateType != "" {
+			types = append(types, u.UpdateType)
+		}
+	}
+	return types
+}
+
+// bodyTable returns the rows of the first table in a Renovate PR body that
+// has a Package column, keyed by the lower case column names.
+func bodyTable(body string) []map[string]string {
+	var header []string
+	var rows []map[string]string
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "|") {
+			if header != nil {
+				break
+			}
+			continue
+		}
+		cells := tableCells(line)
+		switch {
+		case header == nil:
+			if len(cells) > 0 && strings.EqualFold(cells[0], "package") {
+				header = cells
+			}
+		case strings.Trim(line, "|-: ") == "":
+			// the separator below the header
+		default:
+			row := map[string]string{}
+			for i, c := range cells {
+				if i < len(header) {
+					row[strings.ToLower(header[i])] = c
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// tableCells splits a markdown table row into its trimmed cells.
+func tableCells(line string) []string {
+	line = strings.TrimPrefix(strings.TrimSuffix(line, "|"), "|")
+	cells := strings.Split(line, "|")
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+	}
+	return cells
+}
+
+// compareVersions returns the update type for a change from one version to
+// another, or "" when the versions can't be compared.
+func compareVersions(from, to string) string {
+	if from == "" || to == "" {
+		return ""
+	}
+	if digestPattern.MatchString(to) && strings.ContainsAny(to, "abcdef") {
+		return UpdateDigest
+	}
+	fv, tv := versionPattern.FindStringSubmatch(from), versionPattern.FindStringSubmatch(to)
+	if fv == nil || tv == nil {
+		return ""
+	}
+	for i, t := range []string{UpdateMajor, UpdateMinor, UpdatePatch} {
+		f, _ := strconv.Atoi(fv[i+1])
+		n, _ := strconv.Atoi(tv[i+1])
+		if f != n {
+			return t
+		}
+	}
+	return UpdatePatch
+}
+
+// managerFiles maps the files that Renovate updates to the name of its
+// package manager.
+var managerFiles = map[string]string{
+	"go.mod":                    "gomod",
+	"go.sum":                    "gomod",
+	"package.json":              "npm",
+	"package-lock.json":         "npm",
+	"npm-shrinkwrap.json":       "npm",
+	"yarn.lock":                 "npm",
+	"pnpm-lock.yaml":            "npm",
+	"pom.xml":                   "maven",
+	"build.gradle":              "gradle",
+	"build.gradle.kts":          "gradle",
+	"settings.gradle":           "gradle",
+	"libs.versions.toml":        "gradle",
+	"gradle-wrapper.properties": "gradle-wrapper",
+	"requirements.txt":          "pip_requirements",
+	"Pipfile":                   "pipenv",
+	"Pipfile.lock":              "pipenv",
+	"poetry.lock":               "poetry",
+	"pyproject.toml":            "pep621",
+	"Cargo.toml":                "cargo",
+	"Cargo.lock":                "cargo",
+	"Gemfile":                   "bundler",
+	"Gemfile.lock":              "bundler",
+	"composer.json":             "composer",
+	"composer.lock":             "composer",
+	".terraform.lock.hcl":       "terraform",
+	"Chart.yaml":                "helmv3",
+	".pre-commit-config.yaml":   "pre-commit",
+	"WORKSPACE":                 "bazel",
+	"MODULE.bazel":              "bazel-module",
+	"action.yml":                "github-actions",
+	"action.yaml":               "github-actions",
+}
+
+// fileManager returns the Renovate package manager that updates file, or ""
+// when it is not known.
+func fileManager(file string) string {
+	base := path.Base(file)
+	switch {
+	case strings.HasPrefix(file, ".github/workflows/"):
+		return "github-actions"
+	case base == "Dockerfile" || strings.HasPrefix(base, "Dockerfile.") || strings.HasSuffix(base, ".dockerfile"):
+		return "dockerfile"
+	case strings.HasPrefix(base, "docker-compose") && (strings.HasSuffix(base, ".yml") || strings.HasSuffix(base, ".yaml")):
+		return "docker-compose"
+	case strings.HasPrefix(base, "requirements") && strings.HasSuffix(base, ".txt"):
+		return "pip_requirements"
+	case strings.HasSuffix(base, ".tf"):
+		return "terraform"
+	}
+	return managerFiles[base]
+}
+
+// fileManagers returns the package managers of the files changed by a PR,
+// without duplicates.
+func fileManagers(files []string) []string {
+	var managers []string
+	seen := map[string]bool{}
+	for _, f := range files {
+		m := fileManager(f)
+		if m != "" && !seen[m] {
+			seen[m] = true
+			managers = append(managers, m)
+		}
+	}
+	return managers
+}
@@ -0,0 +1,118 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readBody returns the recorded Renovate PR body in testdata/name.
+func readBody(t *testing.T, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestUpdateTypes(t *testing.T) {
+	for name, want := range map[string][]string{
+		"pr_body_single.md": {UpdateMinor},
+		"pr_body_group.md":  {UpdateMajor, UpdateMinor, UpdateDigest, UpdatePatch},
+	} {
+		got := updateTypes(readBody(t, name))
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%v: got %v, want %v", name, got, want)
+		}
+	}
+	if got := updateTypes("no table here"); len(got) != 0 {
+		t.Errorf("got %v for a body without a table", got)
+	}
+}
+
+func TestParseUpdates(t *testing.T) {
+	for name, want := range map[string][]DependencyUpdate{
+		"pr_body_single.md": {{
+			Package:    "golang.org/x/oauth2",
+			URL:        "https://togithub.com/golang/oauth2",
+			Datasource: "go",
+			From:       "v0.7.0",
+			To:         "v0.8.0",
+			UpdateType: UpdateMinor,
+		}},
+		"pr_body_group.md": {
+			{Package: "actions/checkout", URL: "https://togithub.com/actions/checkout", DepType: "action", From: "v3", To: "v4", UpdateType: UpdateMajor, Grouped: true},
+			{Package: "actions/setup-go", URL: "https://togithub.com/actions/setup-go", DepType: "action", From: "v4.0.0", To: "v4.1.0", UpdateType: UpdateMinor, Grouped: true},
+			{Package: "google/osv-scanner-action", URL: "https://togithub.com/google/osv-scanner-action", DepType: "action", From: "b00f71e", To: "1f1242b", UpdateType: UpdateDigest, Grouped: true},
+			{Package: "golang", DepType: "final", From: "1.20.4-alpine", To: "1.20.5-alpine", UpdateType: UpdatePatch, Grouped: true},
+		},
+	} {
+		got := ParseUpdates(readBody(t, name))
+		if len(got) != len(want) {
+			t.Fatalf("%v: got %d updates, want %d", name, len(got), len(want))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%v: got update %+v, want %+v", name, got[i], want[i])
+			}
+		}
+	}
+}
+
+func TestPackageCell(t *testing.T) {
+	for cell, want := range map[string][2]string{
+		"[@types/node](https://togithub.com/DefinitelyTyped/DefinitelyTyped) ([source](https://togithub.com/x))": {"@types/node", "https://togithub.com/DefinitelyTyped/DefinitelyTyped"},
+		"golang":                                {"golang", ""},
+		"`node` ([source](https://github.com))": {"node", ""},
+	} {
+		name, url := packageCell(cell)
+		if name != want[0] || url != want[1] {
+			t.Errorf("packageCell(%q) got %q %q, want %q", cell, name, url, want)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, tc := range []struct{ from, to, want string }{
+		{"v1.2.3", "v2.0.0", UpdateMajor},
+		{"1.2.3", "1.3.0", UpdateMinor},
+		{"1.2.3", "1.2.4", UpdatePatch},
+		{"v3", "v4", UpdateMajor},
+		{"1.20.4-alpine", "1.20.5-alpine", UpdatePatch},
+		{"b00f71e", "1f1242b", UpdateDigest},
+		{"20230401", "20230501", UpdateMajor},
+		{"latest", "stable", ""},
+		{"", "", ""},
+	} {
+		if got := compareVersions(tc.from, tc.to); got != tc.want {
+			t.Errorf("compareVersions(%q, %q) got %q, want %q", tc.from, tc.to, got, tc.want)
+		}
+	}
+}
+
+func TestFileManagers(t *testing.T) {
+	got := fileManagers([]string{
+		"go.mod", "go.sum", ".github/workflows/tests.yaml", "build/Dockerfile",
+		"web/package.json", "web/yarn.lock", "infra/main.tf", "README.md",
+	})
+	want := []string{"gomod", "github-actions", "dockerfile", "npm", "terraform"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hessjcg/git-gtool/internal/forge"
+	"github.com/hessjcg/git-gtool/internal/gitrepo"
+)
+
+const (
+	DefaultPollInterval    = 10 * time.Second
+	DefaultMaxPollInterval = 2 * time.Minute
+	DefaultMaxWait         = 30 * time.Minute
+	DefaultMaxIterations   = 100
+	DefaultMaxErrors       = 10
+)
+
+var (
+	// ErrMergeableUnknown is returned when Github has not yet computed
+	// whether a PR is mergeable.
+	ErrMergeableUnknown = fmt.Errorf("mergeability not yet known")
+	// ErrWaitTimeout is returned when a wait takes longer than the max wait.
+	ErrWaitTimeout = fmt.Errorf("timed out waiting")
+)
+
+// pendingError is returned by a step that can't continue until something
+// changes on Github, like a check run finishing. ready polls for the change.
+type pendingError struct {
+	err   error
+	what  string
+	ready func(ctx context.Context) (bool, error)
+}
+
+func (e *pendingError) Error() string {
+	return e.err.Error()
+}
+
+func (e *pendingError) Unwrap() error {
+	return e.err
+}
+
+// waiter polls until a pendingError is ready, with exponential backoff
+// between polls.
+type waiter struct {
+	// interval the wait before the first poll.
+	interval time.Duration
+	// maxInterval the longest wait between polls.
+	maxInterval time.Duration
+	// maxWait the longest time to wait before giving up.
+	maxWait time.Duration
+	// sleep waits for d or until ctx is done. Replaced in tests.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// wait polls p.ready until it returns true, ctx is done, or maxWait passes.
+func (w *waiter) wait(ctx context.Context, p *pendingError) error {
+	log.Printf("Waiting for %v...", p.what)
+	var waited time.Duration
+	d := w.interval
+	for {
+		if err := w.sleepFor(ctx, d); err != nil {
+			return err
+		}
+		waited += d
+
+		ok, err := p.ready(ctx)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if waited >= w.maxWait {
+			return fmt.Errorf("%w for %v after %v", ErrWaitTimeout, p.what, waited)
+		}
+		d = w.backoff(d)
+	}
+}
+
+// afterError waits before retrying after errCount errors in a row.
+func (w *waiter) afterError(ctx context.Context, errCount int) error {
+	d := w.interval
+	for i := 1; i < errCount; i++ {
+		d = w.backoff(d)
+	}
+	log.Printf("Waiting %v before trying again...", d)
+	return w.sleepFor(ctx, d)
+}
+
+// backoff returns the next poll interval after d.
+func (w *waiter) backoff(d time.Duration) time.Duration {
+	d *= 2
+	if d > w.maxInterval {
+		return w.maxInterval
+	}
+	return d
+}
+
+func (w *waiter) sleepFor(ctx context.Context, d time.Duration) error {
+	if w.sleep != nil {
+		return w.sleep(ctx, d)
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// anyReady returns a pendingError that is ready when any of pending is ready.
+func anyReady(err error, pending []*pendingError) *pendingError {
+	return &pendingError{
+		err:  err,
+		what: fmt.Sprintf("%d PRs", len(pending)),
+		ready: func(ctx context.Context) (bool, error) {
+			for _, p := range pending {
+				ok, err := p.ready(ctx)
+				if err != nil || ok {
+					return ok, err
+				}
+			}
+			return false, nil
+		},
+	}
+}
+
+// headChanged returns true when the head commit of the PR is no longer sha.
+func headChanged(ctx context.Context, r *gitrepo.GitRepo, pr *forge.PullRequest, sha string) (bool, *forge.PullRequest, error) {
+	full, err := r.Forge.GetPullRequest(ctx, pr.Number)
+	if err != nil {
+		return false, nil, err
+	}
+	return full.HeadSHA != sha, full, nil
+}
+
+// waitForRebase returns a pendingError that is ready when Renovate pushes a
+// new head commit to pr.
+func waitForRebase(r *gitrepo.GitRepo, pr *forge.PullRequest, err error) *pendingError {
+	sha := pr.HeadSHA
+	return &pendingError{
+		err:  err,
+		what: fmt.Sprintf("Renovate to rebase #%d", pr.Number),
+		ready: func(ctx context.Context) (bool, error) {
+			changed, _, err := headChanged(ctx, r, pr, sha)
+			return changed, err
+		},
+	}
+}
+
+// waitForChecks returns a pendingError that is ready when the required
+// checks for the head commit of pr finish, or the head commit changes.
+func waitForChecks(r *gitrepo.GitRepo, cfg *mergeConfig, pr *forge.PullRequest, err error) *pendingError {
+	sha := pr.HeadSHA
+	return &pendingError{
+		err:  err,
+		what: fmt.Sprintf("checks on #%d at %v", pr.Number, sha),
+		ready: func(ctx context.Context) (bool, error) {
+			changed, _, err := headChanged(ctx, r, pr, sha)
+			if err != nil || changed {
+				return changed, err
+			}
+			rules, err := r.Forge.BranchRules(ctx, r.Forge.Repository().DefaultBranch)
+			if err != nil {
+				return false, err
+			}
+			results, err := requiredCheckResults(ctx, r, cfg, rules, pr)
+			if err != nil {
+				return false, err
+			}
+			return checksError(results) != ErrMissingCheck, nil
+		},
+	}
+}
+
+// waitForMergeable returns a pendingError that is ready when Github has
+// computed whether pr is mergeable.
+func waitForMergeable(r *gitrepo.GitRepo, pr *forge.PullRequest, err error) *pendingError {
+	sha := pr.HeadSHA
+	return &pendingError{
+		err:  err,
+		what: fmt.Sprintf("the forge to check if #%d is mergeable", pr.Number),
+		ready: func(ctx context.Context) (bool, error) {
+			changed, full, err := headChanged(ctx, r, pr, sha)
+			if err != nil {
+				return false, err
+			}
+			return changed || full.Mergeable != nil, nil
+		},
+	}
+}
+
+// waitForMergeQueue returns a pendingError that is ready when pr leaves the
+// merge queue, either merged or removed by Github.
+func waitForMergeQueue(r *gitrepo.GitRepo, pr *forge.PullRequest, err error) *pendingError {
+	return &pendingError{
+		err:  err,
+		what: fmt.Sprintf("the merge queue to merge #%d", pr.Number),
+		ready: func(ctx context.Context) (bool, error) {
+			queued, err := r.Forge.InMergeQueue(ctx, pr)
+			return !queued, err
+		},
+	}
+}
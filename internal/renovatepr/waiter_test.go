@@ -0,0 +1,126 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package renovatepr
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testWaiter returns a waiter that records sleeps instead of sleeping.
+func testWaiter(sleeps *[]time.Duration) *waiter {
+	return &waiter{
+		interval:    10 * time.Second,
+		maxInterval: time.Minute,
+		maxWait:     5 * time.Minute,
+		sleep: func(ctx context.Context, d time.Duration) error {
+			*sleeps = append(*sleeps, d)
+			return ctx.Err()
+		},
+	}
+}
+
+func TestWaiterBackoff(t *testing.T) {
+	var sleeps []time.Duration
+	w := testWaiter(&sleeps)
+	polls := 0
+	err := w.wait(context.Background(), &pendingError{
+		err:  ErrMissingCheck,
+		what: "test",
+		ready: func(context.Context) (bool, error) {
+			polls++
+			return polls == 5, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute}
+	if !reflect.DeepEqual(sleeps, want) {
+		t.Fatalf("got sleeps %v, want %v", sleeps, want)
+	}
+}
+
+func TestWaiterMaxWait(t *testing.T) {
+	var sleeps []time.Duration
+	w := testWaiter(&sleeps)
+	err := w.wait(context.Background(), &pendingError{
+		err:   ErrMissingCheck,
+		what:  "test",
+		ready: func(context.Context) (bool, error) { return false, nil },
+	})
+	if !errors.Is(err, ErrWaitTimeout) {
+		t.Fatalf("got %v, want ErrWaitTimeout", err)
+	}
+	var total time.Duration
+	for _, d := range sleeps {
+		total += d
+	}
+	if total < w.maxWait || total > w.maxWait+w.maxInterval {
+		t.Fatalf("got total wait %v, want about %v", total, w.maxWait)
+	}
+}
+
+func TestWaiterCancel(t *testing.T) {
+	var sleeps []time.Duration
+	w := testWaiter(&sleeps)
+	ctx, cancel := context.WithCancel(context.Background())
+	err := w.wait(ctx, &pendingError{
+		err:  ErrMissingCheck,
+		what: "test",
+		ready: func(context.Context) (bool, error) {
+			cancel()
+			return false, nil
+		},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if len(sleeps) != 2 {
+		t.Fatalf("got %d sleeps, want 2", len(sleeps))
+	}
+}
+
+func TestWaiterAfterError(t *testing.T) {
+	var sleeps []time.Duration
+	w := testWaiter(&sleeps)
+	for i := 1; i <= 4; i++ {
+		w.afterError(context.Background(), i)
+	}
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute}
+	if !reflect.DeepEqual(sleeps, want) {
+		t.Fatalf("got sleeps %v, want %v", sleeps, want)
+	}
+}
+
+func TestAnyReady(t *testing.T) {
+	notReady := &pendingError{ready: func(context.Context) (bool, error) { return false, nil }}
+	ready := &pendingError{ready: func(context.Context) (bool, error) { return true, nil }}
+
+	p := anyReady(ErrMissingCheck, []*pendingError{notReady, notReady})
+	if ok, _ := p.ready(context.Background()); ok {
+		t.Fatal("got ready, want not ready")
+	}
+	p = anyReady(ErrMissingCheck, []*pendingError{notReady, ready})
+	if ok, _ := p.ready(context.Background()); !ok {
+		t.Fatal("got not ready, want ready")
+	}
+	if !errors.Is(p, ErrMissingCheck) {
+		t.Fatal("got error not wrapping ErrMissingCheck")
+	}
+}